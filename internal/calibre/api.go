@@ -1,17 +1,20 @@
 package calibre
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"io/ioutil"
+	"maps"
 	"math/rand"
+	"mime"
 	"net/http"
 	"os"
 	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -19,22 +22,37 @@ import (
 	"github.com/jianyun8023/calibre-api/pkg/content"
 	"github.com/jianyun8023/calibre-api/pkg/log"
 	"github.com/kapmahc/epub"
-	"github.com/meilisearch/meilisearch-go"
 	"github.com/spf13/cast"
 )
 
 type Api struct {
 	config     *Config
 	contentApi *content.Api
-	client     *meilisearch.Client
+	backend    SearchBackend
 	baseDir    string
 	http       *client.Client
-	useIndex   string
+	state      *stateStore
+	jobs       *jobManager
+	// savedSearches 保存的搜索，通过 view 参数使用
+	savedSearches *savedSearchStore
+
+	// settingsMu 保护 config.Search.Settings，同义词和停用词可以通过接口修改
+	settingsMu sync.RWMutex
+
+	// libMu 保护 libraries 和 defaultLibrary，刷新书库时只在替换书库列表时加写锁
+	libMu          sync.RWMutex
+	libraries      map[string]*library
+	defaultLibrary string
+	// loadMu 串行执行书库发现，避免并发刷新重复创建索引
+	loadMu sync.Mutex
 }
 
 func (c *Api) SetupRouter(r *gin.Engine) {
 
 	base := r.Group("/api")
+	base.GET("/libraries", c.listLibraries)
+	base.POST("/libraries/refresh", c.refreshLibraries)
+	base.Use(c.withLibrary)
 	base.GET("/get/cover/:id", c.getCover)
 	base.GET("/proxy/cover/*path", c.proxyCover)
 	base.GET("/download/book/:id", c.getBookFile)
@@ -44,57 +62,73 @@ func (c *Api) SetupRouter(r *gin.Engine) {
 	base.GET("/book/content", c.getBookContentByQuery)
 	base.POST("/book/:id/delete", c.deleteBook)
 	base.POST("/book/:id/update", c.updateMetadata)
+	base.POST("/books/upload", c.uploadBooks)
+	base.GET("/custom-columns", c.listCustomColumns)
 	base.GET("/search", c.search)
 	base.GET("/metadata/isbn/:isbn", c.getIsbn)
 	base.GET("/metadata/search", c.queryMetadata)
 	base.POST("/search", c.search)
+	base.GET("/search/fulltext", c.searchFullText)
 	base.GET("/publisher", c.listPublisher)
+	base.GET("/facets", c.listFacets)
+	base.GET("/series", c.listSeries)
+	base.GET("/series/:name", c.getSeriesBooks)
+	base.GET("/duplicates", c.listDuplicates)
+	base.GET("/suggest", c.suggest)
+	base.GET("/saved-searches", c.listSavedSearches)
+	base.POST("/saved-searches", c.saveSavedSearch)
+	base.DELETE("/saved-searches/:name", c.deleteSavedSearch)
 	// 最近更新Recently
 	base.GET("/recently", c.recently)
 	base.GET("/random", c.random)
 	base.POST("/index/update", c.updateIndex)
+	base.GET("/index/jobs/:id", c.getIndexJob)
+	base.GET("/index/status", c.getIndexStatus)
+	base.POST("/index/fulltext", c.updateFullTextIndex)
 	base.POST("/index/switch", c.switchIndex)
+	base.GET("/index/export", c.exportIndex)
+	base.POST("/index/import", c.importIndex)
+	base.GET("/index/synonyms", c.getSynonyms)
+	base.PUT("/index/synonyms", c.updateSynonyms)
+	base.GET("/index/stopwords", c.getStopWords)
+	base.PUT("/index/stopwords", c.updateStopWords)
 
 	// Enhanced Tools MCP 端点
 	base.GET("/mcp/tools/enhanced", c.getEnhancedTools)
 	base.POST("/mcp/tools/enhanced/:tool", c.executeEnhancedTool)
 }
 
-func (c *Api) currentIndex() *meilisearch.Index {
-	return c.client.Index(c.useIndex)
-}
-
 func NewClient(config *Config) *Api {
-	client := meilisearch.NewClient(meilisearch.ClientConfig{
-		Host:   config.Search.Host,
-		APIKey: config.Search.APIKey,
-	})
-
 	baseDir := config.TmpDir
 	if !Exists(baseDir) {
 		os.MkdirAll(baseDir, fs.ModePerm)
 	}
 
-	//index := client.Index(config.Search.Index)
-	_, err := ensureIndexExists(client, config.Search.Index)
+	backend, err := newSearchBackend(config)
 	if err != nil {
 		log.Fatal(err)
 	}
-	_, err = ensureIndexExists(client, config.Search.Index+"-bak")
-	if err != nil {
-		log.Fatal(err)
-	}
-	newClient, err := content.NewClient(config.Content.Server)
+	newClient, err := content.NewClient(config.Content.Server, config.Content.auth())
 	if err != nil {
 		log.Fatal(err)
 	}
 	api := Api{
 		config:     config,
-		client:     client,
+		backend:    backend,
 		baseDir:    config.TmpDir,
 		contentApi: &newClient,
 		http:       newClient.Client,
-		useIndex:   config.Search.Index,
+		state:      loadStateStore(config.TmpDir),
+		jobs:       newJobManager(),
+		libraries:  map[string]*library{},
+
+		savedSearches: loadSavedSearchStore(config.TmpDir),
+	}
+	if err := api.loadLibraries(); err != nil {
+		log.Warnf("discover calibre libraries failed, use library %q: %v", defaultLibraryID, err)
+		if err := api.useFallbackLibrary(); err != nil {
+			log.Fatal(err)
+		}
 	}
 
 	// 初始化 SSE MCP 服务器（在 HTTP 模式下默认启用）
@@ -108,51 +142,8 @@ func NewClient(config *Config) *Api {
 	return &api
 }
 
-// ensureIndexExists checks if a Meilisearch index exists, and if not, creates it and updates its settings.
-//
-// Parameters:
-// - client: A pointer to the Meilisearch client.
-// - indexName: The name of the index to check or create.
-//
-// Returns:
-// - A pointer to the Meilisearch index.
-// - An error if the index creation or settings update fails.
-func ensureIndexExists(client *meilisearch.Client, indexName string) (*meilisearch.Index, error) {
-	index := client.Index(indexName)
-
-	// Fetch index information to check if it exists
-	log.Infof("Checking if index %q exists", indexName)
-	_, err := index.FetchInfo()
-	if err != nil {
-		log.Infof("Failed to fetch index info for %q: %v", indexName, err)
-		// Index does not exist, create it
-		log.Infof("Creating index %q", indexName)
-		_, err = client.CreateIndex(&meilisearch.IndexConfig{
-			Uid:        indexName,
-			PrimaryKey: "id",
-		})
-		if err != nil {
-			return nil, fmt.Errorf("failed to create index: %w", err)
-		}
-		log.Infof("Index %q created", indexName)
-		// Update index settings
-		log.Infof("Updating index settings for %q", indexName)
-		_, err = index.UpdateSettings(&meilisearch.Settings{
-			//RankingRules:         []string{"typo", "words", "proximity", "attribute", "exactness"},
-			DisplayedAttributes:  []string{"*"},
-			FilterableAttributes: []string{"authors", "file_path", "id", "last_modified", "pubdate", "publisher", "isbn", "tags"},
-			SearchableAttributes: []string{"title", "authors", "isbn", "publisher"},
-			SortableAttributes:   []string{"authors_sort", "id", "last_modified", "pubdate", "publisher"},
-		})
-		if err != nil {
-			return nil, fmt.Errorf("failed to update index settings: %w", err)
-		}
-	}
-	return index, nil
-}
-
 func (c *Api) search(r *gin.Context) {
-	var req = meilisearch.SearchRequest{}
+	var req = SearchQuery{}
 	err2 := r.Bind(&req)
 	if err2 != nil {
 		log.Infof("====== Only Bind By Query String ======\n%v", err2)
@@ -162,38 +153,50 @@ func (c *Api) search(r *gin.Context) {
 	if q == "" {
 		q = r.PostForm("q")
 	}
-	log.Infof("search query: %s", q)
-	search, err := c.currentIndex().Search(q, &req)
-
-	books := make([]Book, len(search.Hits))
-	for i := range search.Hits {
-		tmp := search.Hits[i].(map[string]interface{})
-		jsonb, err := json.Marshal(tmp)
-		if err != nil {
-			// do error check
-			fmt.Println(err)
-			return
-		}
-
-		book := Book{}
-		if err := json.Unmarshal(jsonb, &book); err != nil {
-			// do error check
-			fmt.Println(err)
-			return
-		}
-		books[i] = book
+	if q != "" {
+		req.Query = q
+	}
+	if req.Limit == 0 {
+		req.Limit = 20
+	}
+	if !c.applyView(r, &req, true) {
+		return
+	}
+	if err := applyQuery(&req); err != nil {
+		r.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	req.Facets, err2 = parseFacets(req.Facets)
+	if err2 != nil {
+		r.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err2.Error()})
+		return
+	}
+	req.AttributesToRetrieve = splitAttributes(req.AttributesToRetrieve)
+	req.AttributesToHighlight = splitAttributes(req.AttributesToHighlight)
+	req.AttributesToCrop = splitAttributes(req.AttributesToCrop)
+	log.Infof("search query: %s", req.Query)
+	search, err := c.backend.Search(c.lib(r).currentIndex(), &req)
+	if err != nil {
+		r.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error()})
+		return
 	}
 
+	books, err := decodeSearchRecords(search.Hits, &req)
 	if err != nil {
-		r.JSON(http.StatusInternalServerError, err)
+		r.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error()})
+		return
+	}
+	data := map[string]interface{}{
+		"records": &books,
+		"total":   search.Total,
+		"limit":   search.Limit,
+		"offset":  search.Offset,
+	}
+	if len(req.Facets) > 0 {
+		data["facets"] = sortFacets(search.FacetDistribution, 0)
 	}
 	r.JSON(http.StatusOK, gin.H{
-		"data": map[string]interface{}{
-			"records": &books,
-			"total":   search.EstimatedTotalHits,
-			"limit":   search.Limit,
-			"offset":  search.Offset,
-		},
+		"data": data,
 		"code": 200,
 	})
 }
@@ -202,7 +205,7 @@ func (c *Api) search(r *gin.Context) {
 func (c *Api) getBook(r *gin.Context) {
 	id := r.Param("id")
 	var book Book
-	err := c.currentIndex().GetDocument(id, nil, &book)
+	err := c.backend.GetDocument(c.lib(r).currentIndex(), id, &book)
 
 	if err != nil {
 		// 返回文件找不到
@@ -223,16 +226,23 @@ func (c *Api) getBook(r *gin.Context) {
 // 删除书籍接口
 func (c *Api) deleteBook(r *gin.Context) {
 	id := r.Param("id")
+	lib := c.lib(r)
 
-	err := c.contentApi.DeleteBooks([]string{id}, "")
-	if err != nil {
+	err := c.contentApi.DeleteBooks([]string{id}, lib.id)
+	if errors.Is(err, content.ErrAuth) {
+		r.JSON(http.StatusBadGateway, gin.H{
+			"message": err.Error(),
+			"code":    http.StatusBadGateway,
+		})
+		return
+	} else if err != nil {
 		r.JSON(http.StatusOK, gin.H{
 			"message": "book not found" + err.Error(),
 			"code":    http.StatusNotFound,
 		})
 		return
 	}
-	_, err = c.currentIndex().DeleteDocument(id)
+	_, err = c.backend.Delete(lib.currentIndex(), []string{id})
 	if err != nil {
 		// 返回文件找不到
 		r.JSON(http.StatusOK, gin.H{
@@ -241,6 +251,10 @@ func (c *Api) deleteBook(r *gin.Context) {
 		})
 		return
 	}
+	lib.suggest.Store(nil)
+	if _, err := c.deleteFullText(lib, []int64{cast.ToInt64(id)}); err != nil {
+		log.Warnf("delete full text of book %s error: %v", id, err)
+	}
 	r.JSON(http.StatusOK, gin.H{
 		"data":    true,
 		"message": "ok",
@@ -251,8 +265,9 @@ func (c *Api) deleteBook(r *gin.Context) {
 // 获取书籍目录接口
 func (c *Api) getBookToc(r *gin.Context) {
 	id := strings.TrimSuffix(r.Param("id"), ".epub")
+	lib := c.lib(r)
 
-	filepath, _ := c.getFileOrCache(id)
+	filepath, _ := c.getFileOrCache(lib, id)
 	book, _ := epub.Open(filepath)
 	points := c.expansionTree(book.Ncx.Points)
 	var p []epub.NavPoint
@@ -261,7 +276,7 @@ func (c *Api) getBookToc(r *gin.Context) {
 		p = append(p, epub.NavPoint{
 			Text: point.Text,
 			Content: epub.Content{
-				Src: path.Join("/read/"+id+"/file", path.Dir(book.Container.Rootfile.Path), point.Content.Src),
+				Src: path.Join("/read/"+id+"/file", path.Dir(book.Container.Rootfile.Path), point.Content.Src) + lib.query(),
 			},
 		})
 	}
@@ -295,14 +310,15 @@ func (c *Api) getBookContent(r *gin.Context) {
 
 	//path1 := path.Join(c.Query("baseDir"), c.Query("path"))
 	path1 := r.Param("path")
+	lib := c.lib(r)
 	var book Book
-	err := c.currentIndex().GetDocument(id, nil, &book)
+	err := c.backend.GetDocument(lib.currentIndex(), id, &book)
 	if err != nil {
 		r.JSON(http.StatusInternalServerError, err)
 	} else {
-		filepath, _ := c.getFileOrCache(id)
+		filepath, _ := c.getFileOrCache(lib, id)
 
-		destDir := path.Join(c.baseDir, id)
+		destDir := path.Join(c.cacheDir(lib), id)
 
 		if Exists(destDir) {
 			s, _ := ioutil.ReadDir(destDir)
@@ -342,8 +358,9 @@ func (c *Api) getBookContentByQuery(r *gin.Context) {
 		filePath = "OEBPS/content.opf" // 默认返回 OPF 文件
 	}
 
+	lib := c.lib(r)
 	var book Book
-	err := c.currentIndex().GetDocument(id, nil, &book)
+	err := c.backend.GetDocument(lib.currentIndex(), id, &book)
 	if err != nil {
 		r.JSON(http.StatusInternalServerError, gin.H{
 			"code":    500,
@@ -353,7 +370,7 @@ func (c *Api) getBookContentByQuery(r *gin.Context) {
 	}
 
 	// 获取或缓存书籍文件
-	filepath, err := c.getFileOrCache(id)
+	filepath, err := c.getFileOrCache(lib, id)
 	if err != nil {
 		r.JSON(http.StatusInternalServerError, gin.H{
 			"code":    500,
@@ -363,7 +380,7 @@ func (c *Api) getBookContentByQuery(r *gin.Context) {
 	}
 
 	// 解压目录
-	destDir := path.Join(c.baseDir, id)
+	destDir := path.Join(c.cacheDir(lib), id)
 	if !Exists(destDir) {
 		os.MkdirAll(destDir, fs.ModePerm)
 	}
@@ -399,33 +416,87 @@ func (c *Api) getBookContentByQuery(r *gin.Context) {
 	r.FileFromFS(filePath, http.Dir(destDir))
 }
 
-func (c *Api) getFile(id string) (int64, io.ReadCloser, error) {
-	size, reader, err := c.contentApi.GetBook(id, "library")
+func (c *Api) getFile(lib *library, id string) (int64, io.ReadCloser, error) {
+	size, reader, err := c.contentApi.GetBook(id, lib.id)
 	return size, reader, err
 }
 
+// getBookFile 下载书籍文件，id 可带格式后缀（如 123.pdf），不带后缀时按 EPUB、AZW3、MOBI、PDF 的顺序选择已有格式
 func (c *Api) getBookFile(r *gin.Context) {
-	filesuffix := path.Ext(r.Param("id"))
-	id := strings.TrimSuffix(r.Param("id"), filesuffix)
+	format := strings.TrimPrefix(path.Ext(r.Param("id")), ".")
+	id := strings.TrimSuffix(r.Param("id"), path.Ext(r.Param("id")))
+	lib := c.lib(r)
 
-	size, reader, err := c.contentApi.GetBook(id, "library")
-	if err != nil {
+	var book Book
+	if err := c.backend.GetDocument(lib.currentIndex(), id, &book); errors.Is(err, ErrDocumentNotFound) {
+		r.JSON(http.StatusNotFound, gin.H{
+			"code":    404,
+			"message": "书籍不存在",
+		})
+		return
+	} else if err != nil {
 		r.JSON(http.StatusInternalServerError, gin.H{
 			"code":    500,
 			"message": err.Error(),
 		})
 		return
 	}
+	if format == "" {
+		format = preferredFormat(book.Formats)
+	}
+	// 旧索引中可能没有格式信息，此时直接交给 calibre 判断
+	if len(book.Formats) > 0 && !hasFormat(book.Formats, format) {
+		r.JSON(http.StatusNotFound, gin.H{
+			"code":    404,
+			"message": fmt.Sprintf("书籍没有 %s 格式，可用格式: %s", strings.ToUpper(format), strings.Join(book.Formats, ", ")),
+		})
+		return
+	}
+
+	size, reader, err := c.contentApi.GetBookFormat(id, strings.ToUpper(format), lib.id)
+	if err != nil {
+		status := contentErrorStatus(err)
+		r.JSON(status, gin.H{
+			"code":    status,
+			"message": err.Error(),
+		})
+		return
+	}
 	defer reader.Close()
-	r.DataFromReader(http.StatusOK, size, "application/epub+zip", reader, nil)
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": downloadFilename(book, format)})
+	r.DataFromReader(http.StatusOK, size, formatMimeType(format), reader, map[string]string{
+		"Content-Disposition": disposition,
+	})
+}
+
+// contentErrorStatus calibre 中不存在时返回 404，拒绝认证时返回 502，提示检查 content 的认证配置，其他错误返回 500
+func contentErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, content.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, content.ErrAuth):
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
+
+// ignoreDecodeError calibre 响应中部分记录无法解析时记录日志并返回 nil，其余记录照常使用
+func ignoreDecodeError(err error) error {
+	var decodeErr *content.DecodeError
+	if errors.As(err, &decodeErr) {
+		log.Warnf("%v", decodeErr)
+		return nil
+	}
+	return err
 }
 
 func (c *Api) getCover(r *gin.Context) {
 	id := strings.TrimSuffix(r.Param("id"), ".jpg")
-	size, reader, err := c.contentApi.GetCover(id, "library")
+	size, reader, err := c.contentApi.GetCover(id, c.lib(r).id)
 	if err != nil {
-		r.JSON(http.StatusInternalServerError, gin.H{
-			"code":    500,
+		status := contentErrorStatus(err)
+		r.JSON(status, gin.H{
+			"code":    status,
 			"message": err.Error(),
 		})
 		return
@@ -434,13 +505,17 @@ func (c *Api) getCover(r *gin.Context) {
 	r.DataFromReader(http.StatusOK, size, "image/jpeg", reader, nil)
 }
 
-func (c *Api) getFileOrCache(id string) (string, error) {
-	filename := path.Join(c.baseDir, id+".epub")
+func (c *Api) getFileOrCache(lib *library, id string) (string, error) {
+	dir := c.cacheDir(lib)
+	if !Exists(dir) {
+		os.MkdirAll(dir, fs.ModePerm)
+	}
+	filename := path.Join(dir, id+".epub")
 	_, err := os.Stat(filename)
 	if Exists(filename) {
 		return filename, nil
 	}
-	_, closer, err := c.getFile(id)
+	_, closer, err := c.getFile(lib, id)
 	if err != nil {
 		return "", err
 	}
@@ -460,131 +535,309 @@ func (c *Api) getFileOrCache(id string) (string, error) {
 	return filename, err
 }
 
+// switchIndex 交换服务索引和暂存索引，用于回滚到上一次构建的数据
 func (c *Api) switchIndex(c2 *gin.Context) {
-
-	resp, err := c.client.GetTasks(&meilisearch.TasksQuery{
-		Limit:     2,
-		Statuses:  []string{"enqueued", "processing"},
-		IndexUIDS: []string{c.config.Search.Index, c.config.Search.Index + "-bak"},
-	})
+	lib := c.lib(c2)
+	busy, err := c.backend.Busy(lib.currentIndex(), lib.stagingIndex())
 	if err != nil {
 		log.Warn(err)
 		c2.JSON(http.StatusOK, gin.H{"code": 500, "error": err.Error()})
 		return
 	}
-	if len(resp.Results) != 0 {
+	if busy {
 		log.Warn(err)
 		c2.JSON(http.StatusOK, gin.H{"code": 400, "error": "有任务正在执行，请稍后再试"})
 		return
 	}
 
-	if c.useIndex == c.config.Search.Index {
-		c.useIndex = c.config.Search.Index + "-bak"
-	} else {
-		c.useIndex = c.config.Search.Index
+	job, err := c.jobs.start(IndexJobModeSwap, lib.id)
+	if err != nil {
+		c2.JSON(http.StatusOK, gin.H{"code": 400, "error": err.Error()})
+		return
+	}
+	err = c.swapIndexes(job, lib)
+	job.finish(err)
+	if err != nil {
+		c2.JSON(http.StatusOK, gin.H{"code": 500, "error": err.Error(), "data": job.snapshot()})
+		return
 	}
+	// 联想索引在下一次查询时按切换后的数据重新建立
+	lib.suggest.Store(nil)
 	c2.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": "success",
+		"data":    job.snapshot(),
 	})
 }
 func (c *Api) updateIndex(c2 *gin.Context) {
-	booksIds, err2 := c.contentApi.GetAllBooksIds()
-	if err2 != nil {
-		log.Warn(err2)
-		c2.JSON(http.StatusOK, gin.H{"code": 500, "error": err2.Error()})
+	var req IndexUpdateRequest
+	if err := c2.ShouldBind(&req); err != nil && err != io.EOF {
+		c2.JSON(http.StatusOK, gin.H{"code": 400, "error": err.Error()})
 		return
 	}
-	index := c.currentIndex()
-	if c.useIndex == c.config.Search.Index {
-		index = c.client.Index(c.config.Search.Index + "-bak")
-	} else {
-		index = c.client.Index(c.config.Search.Index)
+
+	// 已有同步记录时默认增量同步，force=true 时走全量蓝绿重建
+	lib := c.lib(c2)
+	state := c.state.get(lib.index)
+	mode := IndexJobModeFull
+	if !req.Force && !state.Watermark.IsZero() {
+		mode = IndexJobModeIncremental
 	}
-	_, err := index.DeleteAllDocuments()
+	job, err := c.jobs.start(mode, lib.id)
 	if err != nil {
-		log.Warn(err)
-		c2.JSON(http.StatusOK, gin.H{"code": 500, "error": err.Error()})
+		c2.JSON(http.StatusOK, gin.H{"code": 400, "error": err.Error()})
 		return
 	}
 
-	// 按 2000 分段 booksIds,查询书籍，更新索引
-	var books []Book
-	var taskIds []int64
-	for i := 0; i < len(booksIds); i += 2000 {
-		ids := booksIds[i:min(i+2000, len(booksIds))]
-		log.Infof("update index %d [%d - %d]", i, ids[0], ids[len(ids)-1])
-
-		data, err := c.contentApi.GetBookMetaDatas(ids, "")
+	go func() {
+		// 重新应用配置中的索引设置，保证重建后的索引同样包含同义词和停用词
+		err := c.applyIndexSettings(lib)
 		if err != nil {
-			log.Warnf("get book metadata error: %v", err)
-			c2.JSON(http.StatusOK, gin.H{"code": 500, "error": "get book metadata error: " + err.Error()})
+			job.finish(err)
 			return
 		}
-		books, err = convertContentBooks(data)
+		if mode == IndexJobModeIncremental {
+			err = c.syncIndex(job, lib, state)
+		} else {
+			err = c.rebuildIndex(job, lib)
+		}
+		if err == nil {
+			if _, err := c.buildSuggestIndex(lib); err != nil {
+				log.Warnf("library %q: build suggest index error: %v", lib.id, err)
+			}
+		}
+		job.finish(err)
+	}()
+
+	c2.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    job.snapshot(),
+	})
+}
+
+// getIndexJob 查询索引任务进度
+func (c *Api) getIndexJob(c2 *gin.Context) {
+	job, ok := c.jobs.get(c2.Param("id"))
+	if !ok {
+		c2.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "job not found"})
+		return
+	}
+	c2.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": job.snapshot(),
+	})
+}
+
+// getIndexStatus 查询书库当前使用的索引、各索引文档数量和最近同步时间
+func (c *Api) getIndexStatus(c2 *gin.Context) {
+	lib := c.lib(c2)
+	state := c.state.get(lib.index)
+	status := IndexStatus{
+		Library:   lib.id,
+		Active:    lib.currentIndex(),
+		Staging:   lib.stagingIndex(),
+		LastSync:  state.LastSync,
+		LastBuild: state.LastBuild,
+		Watermark: state.Watermark,
+		Indexing:  c.jobs.running(),
+	}
+	for _, index := range []string{lib.currentIndex(), lib.stagingIndex()} {
+		count, err := c.backend.Count(index)
 		if err != nil {
-			c2.JSON(http.StatusOK, gin.H{"code": 500, "error": err.Error()})
+			c2.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error()})
 			return
 		}
-		task, err := index.AddDocumentsInBatches(books, len(ids))
+		updatedAt, err := c.backend.UpdatedAt(index)
 		if err != nil {
-			c2.JSON(http.StatusOK, gin.H{"code": 500, "error": err.Error()})
+			c2.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error()})
 			return
 		}
-		for _, info := range task {
-			taskIds = append(taskIds, info.TaskUID)
+		status.Indexes = append(status.Indexes, IndexStats{
+			Name:      index,
+			Documents: count,
+			UpdatedAt: updatedAt,
+			Active:    index == status.Active,
+		})
+	}
+	if !status.Indexing {
+		busy, err := c.backend.Busy(lib.currentIndex(), lib.stagingIndex())
+		if err != nil {
+			log.Warn(err)
 		}
+		status.Indexing = busy
 	}
+	c2.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": status,
+	})
+}
 
-	err = waitForTask(c, taskIds)
+// rebuildIndex 全量重建暂存索引，全部任务成功后与服务索引交换
+func (c *Api) rebuildIndex(job *indexJob, lib *library) error {
+	job.setPhase(IndexJobPhaseFetching)
+	booksIds, err := c.contentApi.GetAllBooksIds(lib.id)
 	if err != nil {
-		c2.JSON(http.StatusOK, gin.H{"code": 500, "error": err.Error()})
-		return
+		return err
+	}
+	job.update(func(j *IndexJob) {
+		j.BooksTotal = len(booksIds)
+	})
+	index := lib.stagingIndex()
+	taskIds, err := c.backend.DeleteAll(index)
+	if err != nil {
+		return err
 	}
+	job.addTasks(taskIds...)
 
-	c2.JSON(http.StatusOK, gin.H{
-		"code":    200,
-		"message": "success",
-		"data":    len(booksIds),
+	// 按 indexBatchSize 分段 booksIds,查询书籍，更新索引
+	columns, err := c.loadCustomColumns(lib)
+	if err != nil {
+		log.Warnf("library %q: get custom columns error: %v", lib.id, err)
+		columns = c.customColumns(lib)
+	}
+	var books []Book
+	var watermark time.Time
+	for i := 0; i < len(booksIds); i += indexBatchSize {
+		ids := booksIds[i:min(i+indexBatchSize, len(booksIds))]
+		log.Infof("update index %d [%d - %d]", i, ids[0], ids[len(ids)-1])
+
+		data, err := c.contentApi.GetBookMetaDatas(ids, lib.id, columns...)
+		if err := job.addDecodeErrors(err); err != nil {
+			return fmt.Errorf("get book metadata error: %w", err)
+		}
+		books, err = convertContentBooks(data, lib)
+		if err != nil {
+			return err
+		}
+		watermark = maxLastModified(books, watermark)
+		tasks, err := c.upsertBatch(job, index, books, len(books))
+		if err != nil {
+			return err
+		}
+		taskIds = append(taskIds, tasks...)
+	}
+
+	if err := waitForTask(c, job, lib, taskIds); err != nil {
+		return err
+	}
+	err = c.state.update(lib.index, func(s *IndexState) {
+		s.LastSync = time.Now()
+		s.LastBuild = s.LastSync
+		s.Watermark = watermark
 	})
+	if err != nil {
+		log.Warnf("save index state error: %v", err)
+	}
+	return nil
 }
 
-func waitForTask(c *Api, taskIds []int64) error {
-	timeout := time.After(30 * time.Second) // Set timeout duration
-	done := make(chan bool)
+// indexBatchSize 全量重建和导入时每批写入索引的书籍数量
+const indexBatchSize = 2000
 
-	go func() {
-		for {
-			resp, err := c.client.GetTasks(&meilisearch.TasksQuery{
-				Limit:    2,
-				Statuses: []string{"enqueued", "processing"},
-				UIDS:     taskIds,
-			})
-			if err != nil {
-				log.Warn(err)
-				done <- true
-				return
-			}
-			if len(resp.Results) == 0 {
-				done <- true
-				return
+// upsertBatch 写入一批文档，count 为文档数量，任务和进度记录到 job 中
+func (c *Api) upsertBatch(job *indexJob, index string, documents interface{}, count int) ([]int64, error) {
+	tasks, err := c.backend.Upsert(index, documents, count)
+	if err != nil {
+		return nil, err
+	}
+	job.addTasks(tasks...)
+	job.update(func(j *IndexJob) {
+		j.BooksFetched += count
+		j.BatchesEnqueued += len(tasks)
+	})
+	return tasks, nil
+}
+
+// waitForTask 等待重建任务全部成功后再交换索引，任一任务失败则服务索引保持不变
+func waitForTask(c *Api, job *indexJob, lib *library, taskIds []int64) error {
+	if err := c.waitForTasks(job, taskIds); err != nil {
+		return err
+	}
+	return c.swapIndexes(job, lib)
+}
+
+// taskPollInterval 查询后端任务状态的间隔
+var taskPollInterval = 3 * time.Second
+
+// defaultTaskTimeout 未配置 search.tasktimeout 时等待后端任务的最长时间
+const defaultTaskTimeout = time.Hour
+
+// taskTimeout 返回等待一组后端任务完成的最长时间
+func (c *Api) taskTimeout() time.Duration {
+	if c.config != nil && c.config.Search.TaskTimeout > 0 {
+		return time.Duration(c.config.Search.TaskTimeout) * time.Minute
+	}
+	return defaultTaskTimeout
+}
+
+// waitForTasks 轮询 Meilisearch 任务直到全部结束，并把任务状态记录到 job 中，job 可以为 nil。
+// 后端查不到的任务视为失败；超过 taskTimeout 仍未结束、或连续查询失败时放弃，任务以失败结束。
+func (c *Api) waitForTasks(job *indexJob, taskIds []int64) error {
+	return c.waitForTasksUntil(job, taskIds, time.Now().Add(c.taskTimeout()))
+}
+
+// waitForTasksUntil 与 waitForTasks 相同，deadline 之后仍有任务未结束时返回错误
+func (c *Api) waitForTasksUntil(job *indexJob, taskIds []int64, deadline time.Time) error {
+	if len(taskIds) == 0 {
+		return nil
+	}
+	if job != nil {
+		job.setPhase(IndexJobPhaseIndexing)
+	}
+
+	const maxErrors = 5
+	errCount := 0
+	for {
+		tasks, err := c.backend.Tasks(taskIds)
+		if err != nil {
+			errCount++
+			log.Warn(err)
+			if errCount >= maxErrors {
+				return fmt.Errorf("get tasks error: %w", err)
 			}
-			time.Sleep(3 * time.Second) // Add a small delay to avoid tight loop
+			time.Sleep(taskPollInterval)
+			continue
 		}
-	}()
+		errCount = 0
 
-	select {
-	case <-timeout:
-		log.Warn("Timeout reached while waiting for tasks to complete")
-		return fmt.Errorf("Timeout reached while waiting for tasks to complete")
-	case <-done:
-		log.Info("Tasks completed successfully")
-		if c.useIndex == c.config.Search.Index {
-			c.useIndex = c.config.Search.Index + "-bak"
-		} else {
-			c.useIndex = c.config.Search.Index
+		status := make(map[int64]BackendTask, len(tasks))
+		for _, task := range tasks {
+			status[task.UID] = task
 		}
-		return nil
+		var failed []string
+		var pending []string
+		for _, id := range taskIds {
+			task, ok := status[id]
+			if !ok {
+				if job != nil {
+					job.setTaskStatus(id, TaskStatusFailed)
+				}
+				failed = append(failed, fmt.Sprintf("task %d not found", id))
+				continue
+			}
+			if job != nil {
+				job.setTaskStatus(id, task.Status)
+			}
+			switch task.Status {
+			case TaskStatusSucceeded:
+			case TaskStatusFailed, TaskStatusCanceled:
+				failed = append(failed, fmt.Sprintf("task %d %s: %s", task.UID, task.Status, task.Error))
+			default:
+				pending = append(pending, strconv.FormatInt(id, 10))
+			}
+		}
+		if len(pending) == 0 {
+			if len(failed) > 0 {
+				return fmt.Errorf("meilisearch tasks failed: %s", strings.Join(failed, "; "))
+			}
+			log.Info("Tasks completed successfully")
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("meilisearch tasks not finished before %s: %s", deadline.Format(time.RFC3339), strings.Join(pending, ", "))
+		}
+		time.Sleep(taskPollInterval)
 	}
 }
 
@@ -600,41 +853,49 @@ func (c *Api) recently(r *gin.Context) {
 		return
 	}
 
-	searchRequest := meilisearch.SearchRequest{
-		Sort:   []string{"id:desc"},
+	searchRequest := SearchQuery{
 		Limit:  int64(limit),
 		Offset: int64(offset),
 	}
-
-	c.currentIndex().Search("", &searchRequest)
-
-	search, err := c.currentIndex().Search("", &searchRequest)
-	if err != nil {
-		r.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if !c.applyView(r, &searchRequest, false) {
 		return
 	}
-
-	books := make([]Book, len(search.Hits))
-	for i := range search.Hits {
-		tmp := search.Hits[i].(map[string]interface{})
-		jsonb, err := json.Marshal(tmp)
+	if err := applyQuery(&searchRequest); err != nil {
+		r.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	// 最近书籍按 sort 参数指定的时间倒序，保存的搜索中的排序不生效
+	order, ok := recentlySorts[r.DefaultQuery("sort", "added")]
+	if !ok {
+		r.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "sort 可选 added、modified、published"})
+		return
+	}
+	searchRequest.Sort = order.sort
+	if since := r.Query("since"); since != "" {
+		t, err := parseSince(since, time.Now())
 		if err != nil {
-			r.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			r.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
 			return
 		}
+		searchRequest.Filter = mergeFilters(searchRequest.Filter, []string{fmt.Sprintf("%s >= %d", order.field, t.Unix())})
+	}
 
-		book := Book{}
-		if err := json.Unmarshal(jsonb, &book); err != nil {
-			r.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		books[i] = book
+	search, err := c.backend.Search(c.lib(r).currentIndex(), &searchRequest)
+	if err != nil {
+		r.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	books, err := decodeBooks(search.Hits)
+	if err != nil {
+		r.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
 	r.JSON(http.StatusOK, gin.H{
 		"data": map[string]interface{}{
 			"records": &books,
-			"total":   search.EstimatedTotalHits,
+			"total":   search.Total,
 			"limit":   search.Limit,
 			"offset":  search.Offset,
 		},
@@ -643,49 +904,42 @@ func (c *Api) recently(r *gin.Context) {
 }
 
 func (c *Api) random(r *gin.Context) {
-	limit, err := strconv.Atoi(r.DefaultQuery("limit", "10"))
-	if err != nil {
-		r.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+	var req RandomBooksRequest
+	if err := r.ShouldBindQuery(&req); err != nil {
+		r.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
 		return
 	}
-
-	RandomInt := func(min, max int) int {
-		return min + rand.Intn(max-min)
+	if req.Limit <= 0 {
+		req.Limit = defaultRandomLimit
 	}
-	offset := RandomInt(0, 1000)
-
-	// 使用随机排序
-	searchRequest := meilisearch.SearchRequest{
-		Limit:  int64(limit),
-		Offset: int64(offset),
+	req.Limit = min(req.Limit, maxRandomLimit)
+	// 没有指定 seed 时随机生成，客户端使用返回的 seed 翻页
+	seed := req.Seed
+	if seed == 0 {
+		seed = rand.Int63n(1<<53) + 1
 	}
 
-	c.currentIndex().Search("", &searchRequest)
-	search, err := c.currentIndex().Search("", &searchRequest)
-	if err != nil {
-		r.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	searchRequest := SearchQuery{Query: req.Q, Filter: req.Filter}
+	if !c.applyView(r, &searchRequest, false) {
 		return
 	}
+	if err := applyQuery(&searchRequest); err != nil {
+		r.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	searchRequest.Filter = mergeFilters(searchRequest.Filter, randomFilters(req.Tag, req.Lang))
 
-	books := make([]Book, len(search.Hits))
-	for i := range search.Hits {
-		tmp := search.Hits[i].(map[string]interface{})
-		jsonb, err := json.Marshal(tmp)
-		if err != nil {
-			r.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		book := Book{}
-		if err := json.Unmarshal(jsonb, &book); err != nil {
-			r.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		books[i] = book
+	books, total, err := c.sampleBooks(c.lib(r), searchRequest, seed, req.Offset, req.Limit)
+	if err != nil {
+		r.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error()})
+		return
 	}
 
 	r.JSON(http.StatusOK, gin.H{
-		"data": &books,
-		"code": 200,
+		"data":  &books,
+		"total": total,
+		"seed":  seed,
+		"code":  200,
 	})
 }
 
@@ -702,8 +956,9 @@ func (c *Api) updateMetadata(r *gin.Context) {
 		return
 	}
 
+	lib := c.lib(r)
 	oldBook := &Book{}
-	err = c.currentIndex().GetDocument(id, nil, oldBook)
+	err = c.backend.GetDocument(lib.currentIndex(), id, oldBook)
 	if err != nil {
 		r.JSON(http.StatusOK, gin.H{
 			"code":    500,
@@ -712,8 +967,27 @@ func (c *Api) updateMetadata(r *gin.Context) {
 		})
 		return
 	}
-	_, err = c.contentApi.UpdateMetaData(id, parseParams(book, oldBook), "")
+	changes := parseParams(book, oldBook)
+	custom, err := customChanges(book.Custom, c.customColumns(lib))
 	if err != nil {
+		r.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"data":    false,
+			"message": err.Error(),
+		})
+		return
+	}
+	maps.Copy(changes, custom)
+	_, err = c.contentApi.UpdateMetaData(id, changes, lib.id)
+	err = ignoreDecodeError(err)
+	if errors.Is(err, content.ErrAuth) {
+		r.JSON(http.StatusBadGateway, gin.H{
+			"code":    http.StatusBadGateway,
+			"data":    false,
+			"message": err.Error(),
+		})
+		return
+	} else if err != nil {
 		r.JSON(http.StatusNotFound, gin.H{
 			"code":    500,
 			"data":    false,
@@ -722,8 +996,8 @@ func (c *Api) updateMetadata(r *gin.Context) {
 		return
 	}
 
-	data, err := c.contentApi.GetBookMetaDatas([]int64{cast.ToInt64(id)}, "")
-	if err != nil {
+	data, err := c.contentApi.GetBookMetaDatas([]int64{cast.ToInt64(id)}, lib.id, c.customColumns(lib)...)
+	if err := ignoreDecodeError(err); err != nil {
 		log.Warnf("get book metadata error: %v", err)
 		r.JSON(http.StatusOK, gin.H{
 			"code":    500,
@@ -732,7 +1006,7 @@ func (c *Api) updateMetadata(r *gin.Context) {
 		})
 		return
 	}
-	books, err := convertContentBooks(data)
+	books, err := convertContentBooks(data, lib)
 	if err != nil {
 		r.JSON(http.StatusOK, gin.H{
 			"code":    500,
@@ -741,7 +1015,7 @@ func (c *Api) updateMetadata(r *gin.Context) {
 		})
 		return
 	}
-	_, err = c.currentIndex().AddDocuments(books)
+	_, err = c.backend.Upsert(lib.currentIndex(), books, len(books))
 	if err != nil {
 		// 返回文件找不到
 		r.JSON(http.StatusOK, gin.H{
@@ -751,6 +1025,11 @@ func (c *Api) updateMetadata(r *gin.Context) {
 		})
 		return
 	}
+	lib.suggest.Store(nil)
+	// 章节中保存了书名，元数据更新后旧的章节需要通过 /api/index/fulltext 重新建立
+	if _, err := c.deleteFullText(lib, []int64{books[0].ID}); err != nil {
+		log.Warnf("delete full text of book %s error: %v", id, err)
+	}
 	r.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": "success",
@@ -759,7 +1038,7 @@ func (c *Api) updateMetadata(r *gin.Context) {
 	return
 }
 
-func convertContentBooks(content []content.Book) ([]Book, error) {
+func convertContentBooks(content []content.Book, lib *library) ([]Book, error) {
 	var books []Book
 	for _, c := range content {
 		book := Book{
@@ -772,49 +1051,22 @@ func convertContentBooks(content []content.Book) ([]Book, error) {
 			Languages:    c.Languages,
 			LastModified: c.LastModified,
 			PubDate:      c.PubDate,
+			Timestamp:    c.Timestamp,
 			Publisher:    c.Publisher,
+			Series:       c.Series,
 			SeriesIndex:  c.SeriesIndex,
 			Size:         c.Size,
 			Title:        c.Title,
 			Tags:         c.Tags,
 			Rating:       c.Rating,
 			Identifiers:  c.Identifiers,
-			Cover:        "/api/get/cover/" + strconv.FormatInt(c.ID, 10) + ".jpg",
-			FilePath:     "/api/download/book/" + strconv.FormatInt(c.ID, 10) + ".epub",
-		}
-		books = append(books, book)
-	}
-	return books, nil
-}
-
-func convertContentToBooks(content map[string]content.Content) ([]Book, error) {
-	var books []Book
-	for id, c := range content {
-		i, err := strconv.ParseInt(id, 10, 64)
-		if err != nil {
-			return nil, err
-		}
-
-		book := Book{
-			// Map fields from Content to Book
-			AuthorSort:   c.AuthorSort,
-			Authors:      c.Authors,
-			Comments:     c.Comments,
-			ID:           i,
-			Isbn:         c.Isbn,
-			Languages:    c.Languages,
-			LastModified: c.LastModified,
-			PubDate:      c.PubDate,
-			Publisher:    c.Publisher,
-			SeriesIndex:  c.SeriesIndex,
-			Size:         c.Size,
-			Title:        c.Title,
-			Tags:         c.Tags,
-			Rating:       c.Rating,
-			Identifiers:  c.Identifiers,
-			Cover:        "/api/get/cover/" + strconv.FormatInt(i, 10) + ".jpg",
-			FilePath:     "/api/download/book/" + strconv.FormatInt(i, 10) + ".epub",
+			Formats:      c.Formats,
+			Custom:       c.Custom,
+			Cover:        "/api/get/cover/" + strconv.FormatInt(c.ID, 10) + ".jpg" + lib.query(),
+			FilePath:     bookFilePath(c.ID, c.Formats) + lib.query(),
 		}
+		addDateFields(&book)
+		addSearchAliases(&book)
 		books = append(books, book)
 	}
 	return books, nil
@@ -866,10 +1118,10 @@ func (c *Api) proxyCover(r *gin.Context) {
 }
 
 func (c *Api) listPublisher(context *gin.Context) {
-	publishers, err := c.contentApi.GetAllPublisher()
+	publishers, err := c.contentApi.GetAllPublisher(c.lib(context).id)
 
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		context.JSON(contentErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 	context.JSON(http.StatusOK, gin.H{
@@ -886,7 +1138,10 @@ func parseParams(book *Book, oldBook *Book) map[string]interface{} {
 		metadata["comments"] = book.Comments
 	}
 	if book.Isbn != "" {
-		identifiers := oldBook.Identifiers
+		identifiers := maps.Clone(oldBook.Identifiers)
+		if identifiers == nil {
+			identifiers = map[string]string{}
+		}
 		identifiers["isbn"] = book.Isbn
 		metadata["identifiers"] = identifiers
 	}
@@ -907,9 +1162,18 @@ func parseParams(book *Book, oldBook *Book) map[string]interface{} {
 	if book.Tags != nil {
 		metadata["tags"] = book.Tags
 	}
+	if book.Languages != nil {
+		metadata["languages"] = book.Languages
+	}
 	if book.Rating > 0 {
 		metadata["rating"] = book.Rating
 	}
+	if book.Series != "" {
+		metadata["series"] = book.Series
+	}
+	if book.SeriesIndex > 0 {
+		metadata["series_index"] = book.SeriesIndex
+	}
 	return metadata
 }
 
@@ -944,6 +1208,14 @@ func (c *Api) executeEnhancedTool(context *gin.Context) {
 
 	// 执行工具
 	result, err := etm.ExecuteEnhancedTool(toolName, args)
+	var syntaxErr *QuerySyntaxError
+	if errors.As(err, &syntaxErr) {
+		context.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		context.JSON(http.StatusInternalServerError, gin.H{
 			"code":    500,
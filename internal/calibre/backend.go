@@ -0,0 +1,136 @@
+package calibre
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+const (
+	BackendMeilisearch = "meilisearch" // 默认后端，使用外部 Meilisearch 实例
+	BackendEmbedded    = "embedded"    // 进程内后端，数据保存在本地磁盘
+)
+
+// 异步任务状态，取值与 Meilisearch 任务状态一致
+const (
+	TaskStatusEnqueued   = "enqueued"
+	TaskStatusProcessing = "processing"
+	TaskStatusSucceeded  = "succeeded"
+	TaskStatusFailed     = "failed"
+	TaskStatusCanceled   = "canceled"
+)
+
+// ErrDocumentNotFound 文档不存在
+var ErrDocumentNotFound = errors.New("document not found")
+
+// defaultSearchLimit 搜索未指定 limit 时返回的结果数，与 Meilisearch 的默认值一致
+const defaultSearchLimit = 20
+
+// SearchQuery 搜索参数，字段语义与 Meilisearch 搜索接口一致
+type SearchQuery struct {
+	Query  string      `form:"q" json:"q"`
+	Filter interface{} `form:"filter" json:"filter,omitempty"`
+	Sort   []string    `form:"sort" json:"sort,omitempty"`
+	Facets []string    `form:"facets" json:"facets,omitempty"`
+	// Limit 返回的结果数，为 0 时使用 defaultSearchLimit
+	Limit  int64 `form:"limit" json:"limit,omitempty"`
+	Offset int64 `form:"offset" json:"offset,omitempty"`
+
+	AttributesToRetrieve  []string `form:"attributesToRetrieve" json:"attributesToRetrieve,omitempty"`
+	AttributesToHighlight []string `form:"attributesToHighlight" json:"attributesToHighlight,omitempty"`
+	AttributesToCrop      []string `form:"attributesToCrop" json:"attributesToCrop,omitempty"`
+	CropLength            int64    `form:"cropLength" json:"cropLength,omitempty"`
+
+	// ShowRankingScore 在命中结果中返回 _rankingScore（0-1），ShowRankingScoreDetails 返回各排序规则的得分，
+	// ShowMatchesPosition 返回 _matchesPosition，即查询词在各字段中的字节位置
+	ShowRankingScore        bool `form:"showRankingScore" json:"showRankingScore,omitempty"`
+	ShowRankingScoreDetails bool `form:"showRankingScoreDetails" json:"showRankingScoreDetails,omitempty"`
+	ShowMatchesPosition     bool `form:"showMatchesPosition" json:"showMatchesPosition,omitempty"`
+
+	// ExactTotal 返回精确的结果总数。Meilisearch 默认只返回估算的总数，
+	// 设置后改用 hitsPerPage/page 分页查询，Offset 需要是 Limit 的整数倍
+	ExactTotal bool `form:"-" json:"-"`
+}
+
+// SearchResult 搜索结果
+type SearchResult struct {
+	Hits              []map[string]interface{}    `json:"hits"`
+	Total             int64                       `json:"total"`
+	Limit             int64                       `json:"limit"`
+	Offset            int64                       `json:"offset"`
+	FacetDistribution map[string]map[string]int64 `json:"facetDistribution,omitempty"`
+}
+
+// BackendTask 后端异步任务状态
+type BackendTask struct {
+	UID    int64  `json:"uid"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// SearchBackend 搜索后端，index 为索引名称。
+// 写操作可能是异步的：返回的任务 id 需要通过 Tasks 查询，同步实现的后端不返回任务。
+type SearchBackend interface {
+	// EnsureIndex 索引不存在时创建索引，并应用索引设置，返回设置更新的任务
+	EnsureIndex(index string, settings IndexSettings) ([]int64, error)
+	// Search 搜索文档，支持过滤、排序和分面统计
+	Search(index string, query *SearchQuery) (*SearchResult, error)
+	// GetDocument 按 id 读取文档，doc 为接收结果的指针，不存在时返回 ErrDocumentNotFound
+	GetDocument(index string, id string, doc interface{}) error
+	// Count 返回索引中的文档数量
+	Count(index string) (int64, error)
+	// UpdatedAt 返回索引最近一次写入的时间，索引没有写入过时返回零值
+	UpdatedAt(index string) (time.Time, error)
+	// Documents 按 id 顺序分页读取文档，fields 为空时返回全部字段
+	Documents(index string, offset, limit int64, fields []string) ([]map[string]interface{}, error)
+	// Upsert 新增或替换文档
+	Upsert(index string, documents interface{}, batchSize int) ([]int64, error)
+	// Delete 删除指定 id 的文档
+	Delete(index string, ids []string) ([]int64, error)
+	// DeleteAll 清空索引
+	DeleteAll(index string) ([]int64, error)
+	// Swap 原子地交换两个索引的数据，交换完成前请求仍访问原来的数据
+	Swap(a, b string) ([]int64, error)
+	// Tasks 查询异步任务状态
+	Tasks(taskIds []int64) ([]BackendTask, error)
+	// Busy 指定索引是否有未完成的任务
+	Busy(indexes ...string) (bool, error)
+}
+
+// newSearchBackend 按配置创建搜索后端
+func newSearchBackend(config *Config) (SearchBackend, error) {
+	switch config.Search.Backend {
+	case "", BackendMeilisearch:
+		return newMeiliBackend(config.Search), nil
+	case BackendEmbedded:
+		dir := config.Search.DataDir
+		if dir == "" {
+			dir = filepath.Join(config.TmpDir, "search")
+		}
+		return newEmbeddedBackend(dir)
+	default:
+		return nil, fmt.Errorf("unknown search backend %q", config.Search.Backend)
+	}
+}
+
+// decodeBooks 将搜索结果转换为 Book
+func decodeBooks(hits []map[string]interface{}) ([]Book, error) {
+	books := make([]Book, len(hits))
+	for i := range hits {
+		if err := decodeDocument(hits[i], &books[i]); err != nil {
+			return nil, err
+		}
+	}
+	return books, nil
+}
+
+// decodeDocument 将文档转换为 v 指向的结构体
+func decodeDocument(doc map[string]interface{}, v interface{}) error {
+	jsonb, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(jsonb, v)
+}
@@ -0,0 +1,669 @@
+package calibre
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/jianyun8023/calibre-api/pkg/log"
+	"github.com/spf13/cast"
+)
+
+// embeddedSearchableAttributes 未通过 EnsureIndex 指定时的可搜索字段，越靠前权重越高
+var embeddedSearchableAttributes = defaultIndexSettings().SearchableAttributes
+
+// embeddedFlushDelay 最后一次写入之后多久把修改过的索引写回磁盘
+var embeddedFlushDelay = time.Second
+
+// embeddedBackend 进程内的全文搜索后端，每个索引保存为数据目录下的一个 JSON 文件，
+// 适合小型单文件部署和测试。写操作立即对搜索可见，但只修改内存中的索引并返回一个任务：
+// 查询任务状态时、或停止写入 embeddedFlushDelay 之后，才把修改过的索引整体写回磁盘，
+// 因此全量重建的多个批次只写一次文件。
+type embeddedBackend struct {
+	mu      sync.RWMutex
+	dir     string
+	indexes map[string]*embeddedIndex
+	// searchable 各索引的可搜索字段
+	searchable map[string][]string
+	// dirty 尚未写回磁盘的索引
+	dirty map[string]bool
+	// flushTimer 延迟写回磁盘的定时器，每次写入都会推迟
+	flushTimer *time.Timer
+	// lastTask 最近一次写操作的任务 id
+	lastTask int64
+}
+
+type embeddedIndex struct {
+	searchable []string
+	docs       map[string]map[string]interface{}
+	// postings 词项到文档的倒排表，值为词项在文档中的最大字段权重
+	postings map[string]map[string]int
+	// terms 文档包含的词项，用于更新和删除时清理倒排表
+	terms map[string]map[string]int
+	// updated 最近一次写入的时间
+	updated time.Time
+}
+
+func newEmbeddedBackend(dir string) (*embeddedBackend, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &embeddedBackend{
+		dir:        dir,
+		indexes:    map[string]*embeddedIndex{},
+		searchable: map[string][]string{},
+		dirty:      map[string]bool{},
+	}, nil
+}
+
+func newEmbeddedIndex(searchable []string) *embeddedIndex {
+	if len(searchable) == 0 {
+		searchable = embeddedSearchableAttributes
+	}
+	return &embeddedIndex{
+		searchable: searchable,
+		docs:       map[string]map[string]interface{}{},
+		postings:   map[string]map[string]int{},
+		terms:      map[string]map[string]int{},
+	}
+}
+
+func (e *embeddedBackend) indexPath(index string) string {
+	return filepath.Join(e.dir, index+".json")
+}
+
+// index 返回已加载的索引，第一次访问时从磁盘读取，调用方需持有写锁
+func (e *embeddedBackend) index(name string) (*embeddedIndex, error) {
+	if idx, ok := e.indexes[name]; ok {
+		return idx, nil
+	}
+	idx := newEmbeddedIndex(e.searchable[name])
+	b, err := os.ReadFile(e.indexPath(name))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if fi, err := os.Stat(e.indexPath(name)); err == nil {
+			idx.updated = fi.ModTime()
+		}
+		var docs []map[string]interface{}
+		if err := json.Unmarshal(b, &docs); err != nil {
+			return nil, fmt.Errorf("load index %s: %w", name, err)
+		}
+		for _, doc := range docs {
+			idx.put(doc)
+		}
+		log.Infof("embedded index %q loaded with %d documents", name, len(docs))
+	}
+	e.indexes[name] = idx
+	return idx, nil
+}
+
+// loaded 以读锁访问索引，未加载时升级为写锁加载
+func (e *embeddedBackend) loaded(name string) (*embeddedIndex, error) {
+	e.mu.RLock()
+	idx, ok := e.indexes[name]
+	e.mu.RUnlock()
+	if ok {
+		return idx, nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.index(name)
+}
+
+// save 将索引写回磁盘，调用方需持有写锁
+func (e *embeddedBackend) save(name string, idx *embeddedIndex) error {
+	docs := make([]map[string]interface{}, 0, len(idx.docs))
+	for _, id := range idx.sortedIds() {
+		docs = append(docs, idx.docs[id])
+	}
+	b, err := json.Marshal(docs)
+	if err != nil {
+		return err
+	}
+	tmp := e.indexPath(name) + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, e.indexPath(name)); err != nil {
+		return err
+	}
+	delete(e.dirty, name)
+	return nil
+}
+
+// changed 记录索引在内存中被修改，推迟写回磁盘，返回这次写操作的任务 id。调用方需持有写锁
+func (e *embeddedBackend) changed(name string, idx *embeddedIndex) []int64 {
+	idx.updated = time.Now()
+	e.dirty[name] = true
+	if e.flushTimer == nil {
+		e.flushTimer = time.AfterFunc(embeddedFlushDelay, func() {
+			if err := e.flush(); err != nil {
+				log.Warnf("embedded backend: save index error: %v", err)
+			}
+		})
+	} else {
+		e.flushTimer.Reset(embeddedFlushDelay)
+	}
+	e.lastTask++
+	return []int64{e.lastTask}
+}
+
+// flush 把修改过的索引写回磁盘
+func (e *embeddedBackend) flush() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for name := range e.dirty {
+		if err := e.save(name, e.indexes[name]); err != nil {
+			return fmt.Errorf("save index %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (e *embeddedBackend) EnsureIndex(index string, settings IndexSettings) ([]int64, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !slices.Equal(e.searchable[index], settings.SearchableAttributes) {
+		// 可搜索字段变化时丢弃已加载的索引，重新加载时按新字段建立倒排表
+		if e.dirty[index] {
+			if err := e.save(index, e.indexes[index]); err != nil {
+				return nil, err
+			}
+		}
+		e.searchable[index] = settings.SearchableAttributes
+		delete(e.indexes, index)
+	}
+	idx, err := e.index(index)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(e.indexPath(index)); os.IsNotExist(err) {
+		return nil, e.save(index, idx)
+	}
+	return nil, nil
+}
+
+func (e *embeddedBackend) Search(index string, query *SearchQuery) (*SearchResult, error) {
+	filter, err := parseFilter(query.Filter)
+	if err != nil {
+		return nil, err
+	}
+	sorts, err := parseSort(query.Sort)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := e.loaded(index)
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	scores := idx.match(query.Query)
+	ids := make([]string, 0, len(scores))
+	for id := range scores {
+		if filter == nil || filter.match(idx.docs[id]) {
+			ids = append(ids, id)
+		}
+	}
+	sort.SliceStable(ids, func(i, j int) bool {
+		a, b := idx.docs[ids[i]], idx.docs[ids[j]]
+		for _, s := range sorts {
+			if c := compareValues(a[s.field], b[s.field]); c != 0 {
+				if s.desc {
+					return c > 0
+				}
+				return c < 0
+			}
+		}
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		return compareIds(ids[i], ids[j]) < 0
+	})
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	result := &SearchResult{
+		Hits:   []map[string]interface{}{},
+		Total:  int64(len(ids)),
+		Limit:  limit,
+		Offset: query.Offset,
+	}
+	if len(query.Facets) > 0 {
+		result.FacetDistribution = facetDistribution(idx, ids, query.Facets)
+	}
+	terms := tokenize(query.Query, false)
+	for i := query.Offset; i < int64(len(ids)) && i < query.Offset+limit; i++ {
+		hit := pickFields(idx.docs[ids[i]], query.AttributesToRetrieve)
+		if len(query.AttributesToHighlight) > 0 || len(query.AttributesToCrop) > 0 {
+			hit = withFormatted(hit, idx.docs[ids[i]], query)
+		}
+		if query.ShowRankingScore || query.ShowMatchesPosition {
+			hit = maps.Clone(hit)
+		}
+		if query.ShowRankingScore {
+			hit["_rankingScore"] = rankingScore(scores[ids[i]], len(terms), len(idx.searchable))
+		}
+		if query.ShowMatchesPosition {
+			hit["_matchesPosition"] = matchesPosition(idx.docs[ids[i]], idx.searchable, terms)
+		}
+		result.Hits = append(result.Hits, hit)
+	}
+	return result, nil
+}
+
+func (e *embeddedBackend) GetDocument(index string, id string, doc interface{}) error {
+	idx, err := e.loaded(index)
+	if err != nil {
+		return err
+	}
+	e.mu.RLock()
+	d, ok := idx.docs[id]
+	var b []byte
+	if ok {
+		b, err = json.Marshal(d)
+	}
+	e.mu.RUnlock()
+	if !ok {
+		return ErrDocumentNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, doc)
+}
+
+func (e *embeddedBackend) Count(index string) (int64, error) {
+	idx, err := e.loaded(index)
+	if err != nil {
+		return 0, err
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return int64(len(idx.docs)), nil
+}
+
+func (e *embeddedBackend) UpdatedAt(index string) (time.Time, error) {
+	idx, err := e.loaded(index)
+	if err != nil {
+		return time.Time{}, err
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return idx.updated, nil
+}
+
+func (e *embeddedBackend) Documents(index string, offset, limit int64, fields []string) ([]map[string]interface{}, error) {
+	idx, err := e.loaded(index)
+	if err != nil {
+		return nil, err
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	ids := idx.sortedIds()
+	var docs []map[string]interface{}
+	for i := offset; i < int64(len(ids)) && i < offset+limit; i++ {
+		docs = append(docs, pickFields(idx.docs[ids[i]], fields))
+	}
+	return docs, nil
+}
+
+func (e *embeddedBackend) Upsert(index string, documents interface{}, batchSize int) ([]int64, error) {
+	b, err := json.Marshal(documents)
+	if err != nil {
+		return nil, err
+	}
+	var docs []map[string]interface{}
+	if err := json.Unmarshal(b, &docs); err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	idx, err := e.index(index)
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range docs {
+		if _, ok := doc["id"]; !ok {
+			return nil, fmt.Errorf("document without id: %v", doc)
+		}
+		idx.put(doc)
+	}
+	return e.changed(index, idx), nil
+}
+
+func (e *embeddedBackend) Delete(index string, ids []string) ([]int64, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	idx, err := e.index(index)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		idx.remove(id)
+	}
+	return e.changed(index, idx), nil
+}
+
+func (e *embeddedBackend) DeleteAll(index string) ([]int64, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	idx := newEmbeddedIndex(e.searchable[index])
+	e.indexes[index] = idx
+	return e.changed(index, idx), nil
+}
+
+func (e *embeddedBackend) Swap(a, b string) ([]int64, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	idxA, err := e.index(a)
+	if err != nil {
+		return nil, err
+	}
+	idxB, err := e.index(b)
+	if err != nil {
+		return nil, err
+	}
+	e.indexes[a], e.indexes[b] = idxB, idxA
+	e.searchable[a], e.searchable[b] = e.searchable[b], e.searchable[a]
+	if err := e.save(a, idxB); err != nil {
+		return nil, err
+	}
+	return nil, e.save(b, idxA)
+}
+
+// Tasks 写回全部修改过的索引，写回成功后任务才算成功
+func (e *embeddedBackend) Tasks(taskIds []int64) ([]BackendTask, error) {
+	status, message := TaskStatusSucceeded, ""
+	if err := e.flush(); err != nil {
+		status, message = TaskStatusFailed, err.Error()
+	}
+	tasks := make([]BackendTask, 0, len(taskIds))
+	for _, id := range taskIds {
+		tasks = append(tasks, BackendTask{UID: id, Status: status, Error: message})
+	}
+	return tasks, nil
+}
+
+func (e *embeddedBackend) Busy(indexes ...string) (bool, error) {
+	return false, nil
+}
+
+func (idx *embeddedIndex) put(doc map[string]interface{}) {
+	id := cast.ToString(doc["id"])
+	idx.remove(id)
+	idx.docs[id] = doc
+	terms := map[string]int{}
+	for i, field := range idx.searchable {
+		weight := len(idx.searchable) - i
+		for _, text := range fieldStrings(doc[field]) {
+			for _, term := range tokenize(text, true) {
+				if terms[term] < weight {
+					terms[term] = weight
+				}
+			}
+		}
+	}
+	idx.terms[id] = terms
+	for term, weight := range terms {
+		if idx.postings[term] == nil {
+			idx.postings[term] = map[string]int{}
+		}
+		idx.postings[term][id] = weight
+	}
+}
+
+func (idx *embeddedIndex) remove(id string) {
+	for term := range idx.terms[id] {
+		delete(idx.postings[term], id)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	delete(idx.terms, id)
+	delete(idx.docs, id)
+}
+
+// match 返回包含全部查询词项的文档及其得分，空查询匹配全部文档。
+// 最后一个非中文词项按前缀匹配，以支持输入过程中的搜索。
+func (idx *embeddedIndex) match(query string) map[string]int {
+	terms := tokenize(query, false)
+	scores := map[string]int{}
+	if len(terms) == 0 {
+		for id := range idx.docs {
+			scores[id] = 0
+		}
+		return scores
+	}
+	for i, term := range terms {
+		hits := map[string]int{}
+		for id, w := range idx.postings[term] {
+			hits[id] = w
+		}
+		if i == len(terms)-1 && !isCJKTerm(term) {
+			for t, postings := range idx.postings {
+				if len(t) > len(term) && strings.HasPrefix(t, term) {
+					for id, w := range postings {
+						if hits[id] < w {
+							hits[id] = w
+						}
+					}
+				}
+			}
+		}
+		if i == 0 {
+			scores = hits
+			continue
+		}
+		for id := range scores {
+			if w, ok := hits[id]; ok {
+				scores[id] += w
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+	return scores
+}
+
+func (idx *embeddedIndex) sortedIds() []string {
+	ids := make([]string, 0, len(idx.docs))
+	for id := range idx.docs {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return compareIds(ids[i], ids[j]) < 0
+	})
+	return ids
+}
+
+// tokenize 将文本切分为小写词项。中文等表意文字切分为单字和相邻双字，
+// forIndex 为 false 时（查询）多字的中文只使用双字，以减少误匹配。
+func tokenize(text string, forIndex bool) []string {
+	var terms []string
+	var word []rune
+	var cjk []rune
+	flushWord := func() {
+		if len(word) > 0 {
+			terms = append(terms, strings.ToLower(string(word)))
+			word = word[:0]
+		}
+	}
+	flushCJK := func() {
+		if len(cjk) == 0 {
+			return
+		}
+		if forIndex || len(cjk) == 1 {
+			for _, r := range cjk {
+				terms = append(terms, string(r))
+			}
+		}
+		for i := 0; i+1 < len(cjk); i++ {
+			terms = append(terms, string(cjk[i:i+2]))
+		}
+		cjk = cjk[:0]
+	}
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushCJK()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+	return terms
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+func isCJKTerm(term string) bool {
+	for _, r := range term {
+		return isCJK(r)
+	}
+	return false
+}
+
+// fieldStrings 将字段值展开为字符串列表
+func fieldStrings(v interface{}) []string {
+	switch val := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		var s []string
+		for _, item := range val {
+			s = append(s, fieldStrings(item)...)
+		}
+		return s
+	case map[string]interface{}:
+		var s []string
+		for _, item := range val {
+			s = append(s, fieldStrings(item)...)
+		}
+		return s
+	default:
+		return []string{cast.ToString(val)}
+	}
+}
+
+func facetDistribution(idx *embeddedIndex, ids []string, facets []string) map[string]map[string]int64 {
+	dist := map[string]map[string]int64{}
+	for _, facet := range facets {
+		counts := map[string]int64{}
+		for _, id := range ids {
+			v, _ := docField(idx.docs[id], facet)
+			for _, v := range fieldStrings(v) {
+				if v != "" {
+					counts[v]++
+				}
+			}
+		}
+		dist[facet] = counts
+	}
+	return dist
+}
+
+func pickFields(doc map[string]interface{}, fields []string) map[string]interface{} {
+	if len(fields) == 0 || (len(fields) == 1 && fields[0] == "*") {
+		return doc
+	}
+	picked := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		if v, ok := doc[f]; ok {
+			picked[f] = v
+		}
+	}
+	return picked
+}
+
+// compareIds 数字 id 按数值比较，其他按字符串比较
+func compareIds(a, b string) int {
+	x, errA := strconv.ParseInt(a, 10, 64)
+	y, errB := strconv.ParseInt(b, 10, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(a, b)
+}
+
+// compareValues 比较两个字段值，数组取第一个元素，空值排在最后
+func compareValues(a, b interface{}) int {
+	if arr, ok := a.([]interface{}); ok {
+		a = nil
+		if len(arr) > 0 {
+			a = arr[0]
+		}
+	}
+	if arr, ok := b.([]interface{}); ok {
+		b = nil
+		if len(arr) > 0 {
+			b = arr[0]
+		}
+	}
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+	x, okA := a.(float64)
+	y, okB := b.(float64)
+	if okA && okB {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(strings.ToLower(cast.ToString(a)), strings.ToLower(cast.ToString(b)))
+}
+
+type sortRule struct {
+	field string
+	desc  bool
+}
+
+func parseSort(rules []string) ([]sortRule, error) {
+	var sorts []sortRule
+	for _, rule := range rules {
+		field, order, ok := strings.Cut(rule, ":")
+		if !ok || field == "" || (order != "asc" && order != "desc") {
+			return nil, fmt.Errorf("invalid sort %q, expected field:asc or field:desc", rule)
+		}
+		sorts = append(sorts, sortRule{field: field, desc: order == "desc"})
+	}
+	return sorts, nil
+}
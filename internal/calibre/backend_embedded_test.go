@@ -0,0 +1,153 @@
+package calibre
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	// 测试中不自动写回磁盘，避免定时器在临时目录删除后写入，需要持久化的测试显式调用 Tasks
+	embeddedFlushDelay = time.Hour
+	os.Exit(m.Run())
+}
+
+func newTestEmbeddedBackend(t *testing.T) *embeddedBackend {
+	backend, err := newEmbeddedBackend(t.TempDir())
+	assert.NoError(t, err)
+	_, err = backend.Upsert("books", []Book{
+		{ID: 1, Title: "三体", Authors: []string{"刘慈欣"}, Publisher: "重庆出版社", Tags: []string{"科幻"}, Rating: 5},
+		{ID: 2, Title: "球状闪电", Authors: []string{"刘慈欣"}, Publisher: "四川科学技术出版社", Tags: []string{"科幻"}, Rating: 4},
+		{ID: 3, Title: "The Three-Body Problem", Authors: []string{"Cixin Liu"}, Publisher: "Tor Books", Tags: []string{"Science Fiction"}, Rating: 3},
+		{ID: 4, Title: "活着", Authors: []string{"余华"}, Publisher: "作家出版社", Tags: []string{"小说", "文学"}, Rating: 4},
+	}, 2)
+	assert.NoError(t, err)
+	return backend
+}
+
+func searchIds(t *testing.T, backend SearchBackend, query *SearchQuery) []int64 {
+	if query.Limit == 0 {
+		query.Limit = 20
+	}
+	result, err := backend.Search("books", query)
+	assert.NoError(t, err)
+	books, err := decodeBooks(result.Hits)
+	assert.NoError(t, err)
+	ids := make([]int64, 0, len(books))
+	for _, book := range books {
+		ids = append(ids, book.ID)
+	}
+	return ids
+}
+
+func TestEmbeddedBackendSearch(t *testing.T) {
+	backend := newTestEmbeddedBackend(t)
+
+	tests := []struct {
+		name  string
+		query SearchQuery
+		want  []int64
+	}{
+		{name: "chinese title", query: SearchQuery{Query: "三体"}, want: []int64{1}},
+		{name: "chinese author", query: SearchQuery{Query: "刘慈欣"}, want: []int64{1, 2}},
+		{name: "latin prefix", query: SearchQuery{Query: "three bo"}, want: []int64{3}},
+		{name: "placeholder", query: SearchQuery{}, want: []int64{1, 2, 3, 4}},
+		{name: "filter", query: SearchQuery{Filter: `tags = "科幻" AND rating >= 5`}, want: []int64{1}},
+		{name: "filter array", query: SearchQuery{Filter: []interface{}{"rating > 3", []interface{}{"tags = 小说", "id = 2"}}}, want: []int64{2, 4}},
+		{name: "filter not in", query: SearchQuery{Filter: "NOT id IN [1, 2]"}, want: []int64{3, 4}},
+		{name: "filter range", query: SearchQuery{Filter: "rating 3 TO 4"}, want: []int64{2, 3, 4}},
+		{name: "sort", query: SearchQuery{Sort: []string{"rating:desc", "id:desc"}}, want: []int64{1, 4, 2, 3}},
+		{name: "pagination", query: SearchQuery{Sort: []string{"id:asc"}, Offset: 1, Limit: 2}, want: []int64{2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, searchIds(t, backend, &tt.query))
+		})
+	}
+}
+
+func TestEmbeddedBackendFacets(t *testing.T) {
+	backend := newTestEmbeddedBackend(t)
+	result, err := backend.Search("books", &SearchQuery{Facets: []string{"tags", "rating"}, Limit: 1})
+	assert.NoError(t, err)
+	assert.Len(t, result.Hits, 1)
+	assert.Equal(t, int64(4), result.Total)
+	assert.Equal(t, int64(2), result.FacetDistribution["tags"]["科幻"])
+	assert.Equal(t, int64(2), result.FacetDistribution["rating"]["4"])
+}
+
+func TestEmbeddedBackendPersistence(t *testing.T) {
+	dir := t.TempDir()
+	backend, err := newEmbeddedBackend(dir)
+	assert.NoError(t, err)
+	upserted, err := backend.Upsert("books", []Book{{ID: 7, Title: "白夜行"}, {ID: 8, Title: "解忧杂货店"}}, 10)
+	assert.NoError(t, err)
+	deleted, err := backend.Delete("books", []string{"8"})
+	assert.NoError(t, err)
+
+	// 写操作只修改内存，查询任务状态时才写回磁盘
+	_, err = os.Stat(backend.indexPath("books"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	tasks, err := backend.Tasks(append(upserted, deleted...))
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 2)
+	for _, task := range tasks {
+		assert.Equal(t, TaskStatusSucceeded, task.Status)
+	}
+
+	reopened, err := newEmbeddedBackend(dir)
+	assert.NoError(t, err)
+	var book Book
+	assert.NoError(t, reopened.GetDocument("books", "7", &book))
+	assert.Equal(t, "白夜行", book.Title)
+	assert.ErrorIs(t, reopened.GetDocument("books", "8", &book), ErrDocumentNotFound)
+
+	docs, err := reopened.Documents("books", 0, 10, []string{"id"})
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{"id": float64(7)}}, docs)
+}
+
+func TestEmbeddedBackendFlushDelay(t *testing.T) {
+	delay := embeddedFlushDelay
+	embeddedFlushDelay = 10 * time.Millisecond
+	defer func() { embeddedFlushDelay = delay }()
+
+	backend, err := newEmbeddedBackend(t.TempDir())
+	assert.NoError(t, err)
+	_, err = backend.Upsert("books", []Book{{ID: 7, Title: "白夜行"}}, 10)
+	assert.NoError(t, err)
+	// 没有等待任务的写入在停止写入后自动写回磁盘
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(backend.indexPath("books"))
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	backend.mu.RLock()
+	assert.Empty(t, backend.dirty)
+	backend.mu.RUnlock()
+}
+
+func TestEmbeddedBackendDefaultLimit(t *testing.T) {
+	backend, err := newEmbeddedBackend(t.TempDir())
+	assert.NoError(t, err)
+	var books []Book
+	for i := 1; i <= defaultSearchLimit+5; i++ {
+		books = append(books, Book{ID: int64(i), Title: "书籍"})
+	}
+	_, err = backend.Upsert("books", books, 10)
+	assert.NoError(t, err)
+
+	result, err := backend.Search("books", &SearchQuery{})
+	assert.NoError(t, err)
+	assert.Len(t, result.Hits, defaultSearchLimit)
+	assert.Equal(t, int64(defaultSearchLimit), result.Limit)
+	assert.Equal(t, int64(defaultSearchLimit+5), result.Total)
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	for _, filter := range []string{"title =", "(tags = a", "id IN [1, 2", "rating ~ 3"} {
+		_, err := parseFilter(filter)
+		assert.Error(t, err, filter)
+	}
+}
@@ -0,0 +1,277 @@
+package calibre
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/jianyun8023/calibre-api/pkg/log"
+	"github.com/meilisearch/meilisearch-go"
+)
+
+// meiliBackend 基于 Meilisearch 的搜索后端
+type meiliBackend struct {
+	client *meilisearch.Client
+	// meilisearch-go 无法发送 showRankingScore 等参数，搜索请求直接调用 HTTP 接口
+	http *resty.Client
+}
+
+func newMeiliBackend(config Search) *meiliBackend {
+	client := meilisearch.NewClient(meilisearch.ClientConfig{
+		Host:   config.Host,
+		APIKey: config.APIKey,
+	})
+	http := resty.New().SetBaseURL(strings.TrimSuffix(config.Host, "/"))
+	if config.APIKey != "" {
+		http.SetAuthToken(config.APIKey)
+	}
+	return &meiliBackend{client: client, http: http}
+}
+
+// EnsureIndex 创建缺失的索引，并把已有索引的设置调整为期望设置，
+// 这样旧版本创建的索引也能获得新增的设置。
+func (m *meiliBackend) EnsureIndex(index string, settings IndexSettings) ([]int64, error) {
+	idx, err := ensureIndexExists(m.client, index)
+	if err != nil {
+		return nil, err
+	}
+	taskIds, err := reconcileSettings(idx, settings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update index settings: %w", err)
+	}
+	return taskIds, nil
+}
+
+// ensureIndexExists checks if a Meilisearch index exists, and if not, creates it.
+//
+// Parameters:
+// - client: A pointer to the Meilisearch client.
+// - indexName: The name of the index to check or create.
+//
+// Returns:
+// - A pointer to the Meilisearch index.
+// - An error if the index creation fails.
+func ensureIndexExists(client *meilisearch.Client, indexName string) (*meilisearch.Index, error) {
+	index := client.Index(indexName)
+
+	// Fetch index information to check if it exists
+	log.Infof("Checking if index %q exists", indexName)
+	_, err := index.FetchInfo()
+	if err != nil {
+		log.Infof("Failed to fetch index info for %q: %v", indexName, err)
+		// Index does not exist, create it
+		log.Infof("Creating index %q", indexName)
+		task, err := client.CreateIndex(&meilisearch.IndexConfig{
+			Uid:        indexName,
+			PrimaryKey: "id",
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create index: %w", err)
+		}
+		// Wait for the index so that its settings can be read
+		if _, err := client.WaitForTask(task.TaskUID); err != nil {
+			return nil, fmt.Errorf("failed to create index: %w", err)
+		}
+		log.Infof("Index %q created", indexName)
+	}
+	return index, nil
+}
+
+func (m *meiliBackend) Search(index string, query *SearchQuery) (*SearchResult, error) {
+	params := map[string]interface{}{
+		"q": query.Query,
+	}
+	if query.ExactTotal {
+		// 分页模式返回精确的 totalHits
+		limit := query.Limit
+		if limit <= 0 {
+			limit = defaultSearchLimit
+		}
+		params["hitsPerPage"] = limit
+		params["page"] = query.Offset/limit + 1
+	} else {
+		params["offset"] = query.Offset
+		// 未指定 limit 时由 Meilisearch 使用默认值
+		if query.Limit > 0 {
+			params["limit"] = query.Limit
+		}
+	}
+	if query.Filter != nil && query.Filter != "" {
+		params["filter"] = query.Filter
+	}
+	if len(query.Sort) > 0 {
+		params["sort"] = query.Sort
+	}
+	if len(query.Facets) > 0 {
+		params["facets"] = query.Facets
+	}
+	if len(query.AttributesToRetrieve) > 0 {
+		params["attributesToRetrieve"] = query.AttributesToRetrieve
+	}
+	if len(query.AttributesToHighlight) > 0 {
+		params["attributesToHighlight"] = query.AttributesToHighlight
+	}
+	if len(query.AttributesToCrop) > 0 {
+		params["attributesToCrop"] = query.AttributesToCrop
+	}
+	if query.CropLength > 0 {
+		params["cropLength"] = query.CropLength
+	}
+	if query.ShowRankingScore {
+		params["showRankingScore"] = true
+	}
+	if query.ShowRankingScoreDetails {
+		params["showRankingScoreDetails"] = true
+	}
+	if query.ShowMatchesPosition {
+		params["showMatchesPosition"] = true
+	}
+
+	var resp struct {
+		Hits               []map[string]interface{}    `json:"hits"`
+		EstimatedTotalHits int64                       `json:"estimatedTotalHits"`
+		Limit              int64                       `json:"limit"`
+		Offset             int64                       `json:"offset"`
+		TotalHits          int64                       `json:"totalHits"`
+		HitsPerPage        int64                       `json:"hitsPerPage"`
+		Page               int64                       `json:"page"`
+		FacetDistribution  map[string]map[string]int64 `json:"facetDistribution"`
+	}
+	r, err := m.http.R().
+		SetBody(params).
+		SetResult(&resp).
+		SetPathParam("index", index).
+		Post("/indexes/{index}/search")
+	if err != nil {
+		return nil, err
+	}
+	if r.IsError() {
+		return nil, fmt.Errorf("meilisearch search %s: %s", r.Status(), r.String())
+	}
+	if query.ExactTotal {
+		return &SearchResult{
+			Hits:              resp.Hits,
+			Total:             resp.TotalHits,
+			Limit:             resp.HitsPerPage,
+			Offset:            (resp.Page - 1) * resp.HitsPerPage,
+			FacetDistribution: resp.FacetDistribution,
+		}, nil
+	}
+	return &SearchResult{
+		Hits:              resp.Hits,
+		Total:             resp.EstimatedTotalHits,
+		Limit:             resp.Limit,
+		Offset:            resp.Offset,
+		FacetDistribution: resp.FacetDistribution,
+	}, nil
+}
+
+func (m *meiliBackend) GetDocument(index string, id string, doc interface{}) error {
+	err := m.client.Index(index).GetDocument(id, nil, doc)
+	if apiErr, ok := err.(*meilisearch.Error); ok && apiErr.StatusCode == 404 {
+		return ErrDocumentNotFound
+	}
+	return err
+}
+
+func (m *meiliBackend) Count(index string) (int64, error) {
+	stats, err := m.client.Index(index).GetStats()
+	if err != nil {
+		return 0, err
+	}
+	return stats.NumberOfDocuments, nil
+}
+
+func (m *meiliBackend) UpdatedAt(index string) (time.Time, error) {
+	info, err := m.client.GetIndex(index)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.UpdatedAt, nil
+}
+
+func (m *meiliBackend) Documents(index string, offset, limit int64, fields []string) ([]map[string]interface{}, error) {
+	var resp meilisearch.DocumentsResult
+	err := m.client.Index(index).GetDocuments(&meilisearch.DocumentsQuery{
+		Offset: offset,
+		Limit:  limit,
+		Fields: fields,
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Results, nil
+}
+
+func (m *meiliBackend) Upsert(index string, documents interface{}, batchSize int) ([]int64, error) {
+	if batchSize <= 0 {
+		return nil, nil
+	}
+	tasks, err := m.client.Index(index).AddDocumentsInBatches(documents, batchSize, "id")
+	if err != nil {
+		return nil, err
+	}
+	taskIds := make([]int64, 0, len(tasks))
+	for _, task := range tasks {
+		taskIds = append(taskIds, task.TaskUID)
+	}
+	return taskIds, nil
+}
+
+func (m *meiliBackend) Delete(index string, ids []string) ([]int64, error) {
+	task, err := m.client.Index(index).DeleteDocuments(ids)
+	if err != nil {
+		return nil, err
+	}
+	return []int64{task.TaskUID}, nil
+}
+
+func (m *meiliBackend) DeleteAll(index string) ([]int64, error) {
+	task, err := m.client.Index(index).DeleteAllDocuments()
+	if err != nil {
+		return nil, err
+	}
+	return []int64{task.TaskUID}, nil
+}
+
+func (m *meiliBackend) Swap(a, b string) ([]int64, error) {
+	task, err := m.client.SwapIndexes([]meilisearch.SwapIndexesParams{
+		{Indexes: []string{a, b}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []int64{task.TaskUID}, nil
+}
+
+func (m *meiliBackend) Tasks(taskIds []int64) ([]BackendTask, error) {
+	resp, err := m.client.GetTasks(&meilisearch.TasksQuery{
+		Limit: int64(len(taskIds)),
+		UIDS:  taskIds,
+	})
+	if err != nil {
+		return nil, err
+	}
+	tasks := make([]BackendTask, 0, len(resp.Results))
+	for _, task := range resp.Results {
+		tasks = append(tasks, BackendTask{
+			UID:    task.UID,
+			Status: string(task.Status),
+			Error:  task.Error.Message,
+		})
+	}
+	return tasks, nil
+}
+
+func (m *meiliBackend) Busy(indexes ...string) (bool, error) {
+	resp, err := m.client.GetTasks(&meilisearch.TasksQuery{
+		Limit:     1,
+		Statuses:  []string{TaskStatusEnqueued, TaskStatusProcessing},
+		IndexUIDS: indexes,
+	})
+	if err != nil {
+		return false, err
+	}
+	return len(resp.Results) != 0, nil
+}
@@ -0,0 +1,56 @@
+package calibre
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMeiliSearchParams(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     SearchQuery
+		want      map[string]interface{}
+		response  string
+		wantTotal int64
+	}{
+		{
+			name:      "默认 limit",
+			query:     SearchQuery{Query: "三体"},
+			want:      map[string]interface{}{"q": "三体", "offset": float64(0)},
+			response:  `{"hits":[],"estimatedTotalHits":1000,"limit":20,"offset":0}`,
+			wantTotal: 1000,
+		},
+		{
+			name:      "精确总数",
+			query:     SearchQuery{Limit: 50, Offset: 100, ExactTotal: true},
+			want:      map[string]interface{}{"q": "", "hitsPerPage": float64(50), "page": float64(3)},
+			response:  `{"hits":[],"totalHits":1234,"hitsPerPage":50,"page":3}`,
+			wantTotal: 1234,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/indexes/books/search", r.URL.Path)
+				var params map[string]interface{}
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&params))
+				assert.Equal(t, tt.want, params)
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			result, err := newMeiliBackend(Search{Host: server.URL}).Search("books", &tt.query)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantTotal, result.Total)
+			if tt.query.ExactTotal {
+				assert.Equal(t, tt.query.Offset, result.Offset)
+				assert.Equal(t, tt.query.Limit, result.Limit)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package calibre
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveConfigValue(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	original := `address: :8080
+search:
+  host: http://127.0.0.1:7700 # Meilisearch 地址
+  index: books
+  # settings:
+  #   maxvaluesperfacet: 10000
+metadata:
+  doubanurl: http://localhost:8085
+`
+	assert.NoError(t, os.WriteFile(file, []byte(original), 0o644))
+
+	synonyms := map[string][]string{"三体": {"地球往事"}}
+	assert.NoError(t, saveConfigValue(file, []string{"search", "settings", "synonyms"}, synonyms))
+	assert.NoError(t, saveConfigValue(file, []string{"search", "settings", "stopwords"}, []string{"的"}))
+	assert.NoError(t, saveConfigValue(file, []string{"search", "settings", "stopwords"}, []string{"的", "了"}))
+
+	b, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "# Meilisearch 地址")
+	assert.Contains(t, string(b), "#   maxvaluesperfacet: 10000")
+
+	v := viper.New()
+	v.SetConfigFile(file)
+	assert.NoError(t, v.ReadInConfig())
+	var conf Config
+	assert.NoError(t, v.Unmarshal(&conf))
+	assert.Equal(t, "books", conf.Search.Index)
+	assert.Equal(t, "http://localhost:8085", conf.Metadata.DoubanUrl)
+	assert.Equal(t, synonyms, conf.Search.Settings.Synonyms)
+	assert.Equal(t, []string{"的", "了"}, conf.Search.Settings.StopWords)
+}
@@ -0,0 +1,92 @@
+package calibre
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jianyun8023/calibre-api/pkg/content"
+	"github.com/jianyun8023/calibre-api/pkg/log"
+	"github.com/spf13/cast"
+)
+
+// customColumns 返回书库的自定义列定义，首次使用时从 calibre 读取。读取失败时返回 nil，书籍不包含自定义列。
+func (c *Api) customColumns(lib *library) []content.CustomColumn {
+	if columns := lib.columns.Load(); columns != nil {
+		return *columns
+	}
+	columns, err := c.loadCustomColumns(lib)
+	if err != nil {
+		log.Warnf("library %q: get custom columns error: %v", lib.id, err)
+	}
+	return columns
+}
+
+// loadCustomColumns 从 calibre 重新读取自定义列定义，全量重建索引时调用以发现新增的列
+func (c *Api) loadCustomColumns(lib *library) ([]content.CustomColumn, error) {
+	columns, err := c.contentApi.GetCustomColumns(lib.id)
+	if err != nil {
+		return nil, err
+	}
+	lib.columns.Store(&columns)
+	return columns, nil
+}
+
+// listCustomColumns 自定义列列表接口
+func (c *Api) listCustomColumns(r *gin.Context) {
+	columns, err := c.loadCustomColumns(c.lib(r))
+	if err != nil {
+		status := contentErrorStatus(err)
+		r.JSON(status, gin.H{"code": status, "message": err.Error()})
+		return
+	}
+	r.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    columns,
+	})
+}
+
+// customChanges 将更新请求中的自定义列转换为 /cdb/set-fields 的修改内容，键为带 # 的字段名。
+// 值为 null 时清空该列；datetime 列可以使用 unix 时间戳（秒）或日期字符串。
+func customChanges(values map[string]interface{}, columns []content.CustomColumn) (map[string]interface{}, error) {
+	changes := make(map[string]interface{}, len(values))
+	for label, v := range values {
+		column, ok := findCustomColumn(columns, strings.TrimPrefix(label, "#"))
+		if !ok {
+			return nil, fmt.Errorf("未知的自定义列: %s", label)
+		}
+		if !column.IsEditable {
+			return nil, fmt.Errorf("自定义列 %s 不能修改", label)
+		}
+		if v != nil && column.Datatype == "datetime" {
+			t, err := customTime(v)
+			if err != nil {
+				return nil, fmt.Errorf("自定义列 %s 的日期无效: %v", label, v)
+			}
+			v = t.Format("2006-01-02T15:04:05+00:00")
+		}
+		changes[column.Key] = v
+	}
+	return changes, nil
+}
+
+func customTime(v interface{}) (time.Time, error) {
+	switch v.(type) {
+	case float64, int, int64:
+		return time.Unix(cast.ToInt64(v), 0).UTC(), nil
+	}
+	t, err := cast.ToTimeE(v)
+	return t.UTC(), err
+}
+
+func findCustomColumn(columns []content.CustomColumn, label string) (content.CustomColumn, bool) {
+	for _, column := range columns {
+		if column.Label == label {
+			return column, true
+		}
+	}
+	return content.CustomColumn{}, false
+}
@@ -0,0 +1,63 @@
+package calibre
+
+import (
+	"testing"
+
+	"github.com/jianyun8023/calibre-api/pkg/content"
+	"github.com/stretchr/testify/assert"
+)
+
+var testColumns = []content.CustomColumn{
+	{Key: "#read", Label: "read", Datatype: "bool", IsEditable: true},
+	{Key: "#shelf", Label: "shelf", Datatype: "text", IsMultiple: true, IsEditable: true},
+	{Key: "#finished", Label: "finished", Datatype: "datetime", IsEditable: true},
+	{Key: "#summary", Label: "summary", Datatype: "composite"},
+}
+
+func TestCustomChanges(t *testing.T) {
+	changes, err := customChanges(map[string]interface{}{
+		"read":      true,
+		"#shelf":    []interface{}{"床头"},
+		"finished":  float64(1714564800),
+		"#finished": nil,
+	}, testColumns)
+	assert.NoError(t, err)
+	assert.Equal(t, true, changes["#read"])
+	assert.Equal(t, []interface{}{"床头"}, changes["#shelf"])
+	assert.Contains(t, changes, "#finished")
+
+	changes, err = customChanges(map[string]interface{}{"finished": "2024-05-01"}, testColumns)
+	assert.NoError(t, err)
+	assert.Equal(t, "2024-05-01T00:00:00+00:00", changes["#finished"])
+
+	_, err = customChanges(map[string]interface{}{"source": "豆瓣"}, testColumns)
+	assert.Error(t, err)
+	_, err = customChanges(map[string]interface{}{"summary": "x"}, testColumns)
+	assert.Error(t, err)
+}
+
+func TestCustomColumnValue(t *testing.T) {
+	assert.Equal(t, true, testColumns[0].Value(true))
+	assert.Equal(t, []string{"床头", "待读"}, testColumns[1].Value([]interface{}{"床头", "待读"}))
+	assert.Nil(t, testColumns[1].Value([]interface{}{}))
+	assert.Equal(t, int64(1714564800), testColumns[2].Value(map[string]interface{}{"v": "2024-05-01T12:00:00+00:00"}))
+	assert.Nil(t, testColumns[2].Value(map[string]interface{}{"v": "0101-01-01T00:00:00+00:00"}))
+	assert.Nil(t, testColumns[0].Value(nil))
+}
+
+func TestEmbeddedBackendCustomFilter(t *testing.T) {
+	backend := newTestEmbeddedBackend(t)
+	_, err := backend.Upsert("books", []Book{
+		{ID: 5, Title: "已读", Custom: map[string]interface{}{"read": true, "shelf": []string{"床头"}}},
+		{ID: 6, Title: "未读", Custom: map[string]interface{}{"read": false}},
+	}, 2)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []int64{5}, searchIds(t, backend, &SearchQuery{Filter: "custom.read = true"}))
+	assert.Equal(t, []int64{5}, searchIds(t, backend, &SearchQuery{Filter: "custom.shelf = 床头"}))
+	assert.ElementsMatch(t, []int64{5, 6}, searchIds(t, backend, &SearchQuery{Filter: "custom.read EXISTS"}))
+
+	result, err := backend.Search("books", &SearchQuery{Limit: 1, Facets: []string{"custom.shelf"}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), result.FacetDistribution["custom.shelf"]["床头"])
+}
@@ -0,0 +1,442 @@
+package calibre
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jianyun8023/calibre-api/pkg/log"
+	"github.com/jianyun8023/calibre-api/pkg/zhconv"
+)
+
+const (
+	DuplicateByISBN       = "isbn"
+	DuplicateByIdentifier = "identifiers"
+	DuplicateByTitle      = "title"
+
+	// defaultTitleSimilarity 书名相似度的默认阈值
+	defaultTitleSimilarity = 0.85
+	// maxAuthorBlock 同一作者的书籍超过这个数量时不再两两比较书名，避免“佚名”之类的作者拖慢统计
+	maxAuthorBlock = 2000
+)
+
+// duplicateFields 查重需要从索引读取的字段
+var duplicateFields = []string{"id", "title", "authors", "isbn", "identifiers", "formats", "size", "last_modified"}
+
+// bracketed 书名中括号内的版本说明，如“（修订版）”“[精装]”
+var bracketed = regexp.MustCompile(`[(（\[【《][^)）\]】》]*[)）\]】》]`)
+
+// DuplicateCluster 一组疑似重复的书籍
+type DuplicateCluster struct {
+	// Reasons 判定重复的依据：isbn、identifiers、title
+	Reasons []string `json:"reasons"`
+	// Keys 书籍共同的 ISBN、标识符或书名
+	Keys  []string        `json:"keys"`
+	Count int             `json:"count"`
+	Books []DuplicateBook `json:"books"`
+}
+
+// DuplicateBook 重复书籍的信息，用于选择保留哪一本
+type DuplicateBook struct {
+	ID           int64             `json:"id"`
+	Title        string            `json:"title"`
+	Authors      []string          `json:"authors"`
+	Isbn         string            `json:"isbn"`
+	Identifiers  map[string]string `json:"identifiers"`
+	Formats      []string          `json:"formats"`
+	Size         int64             `json:"size"`
+	LastModified time.Time         `json:"last_modified"`
+}
+
+// duplicateCache 同一版本索引的查重结果，按查重方式和阈值区分
+type duplicateCache struct {
+	// updated 计算结果时服务索引的更新时间，索引写入后缓存失效
+	updated time.Time
+	results map[string][]DuplicateCluster
+}
+
+// listDuplicates 按 ISBN、标识符和书名作者相似度对疑似重复的书籍分组，分页请求共用同一次扫描的结果
+func (c *Api) listDuplicates(r *gin.Context) {
+	var req DuplicatesRequest
+	if err := r.ShouldBindQuery(&req); err != nil {
+		r.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	by, err := parseDuplicateBy(req.By)
+	if err != nil {
+		r.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	if req.Threshold == 0 {
+		req.Threshold = defaultTitleSimilarity
+	}
+	if req.Limit == 0 {
+		req.Limit = 50
+	}
+
+	clusters, err := c.duplicateClusters(c.lib(r), by, req.Threshold)
+	if err != nil {
+		r.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error()})
+		return
+	}
+	total := len(clusters)
+	start := min(req.Offset, total)
+	end := min(start+req.Limit, total)
+	r.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"records": clusters[start:end],
+			"total":   total,
+			"limit":   req.Limit,
+			"offset":  req.Offset,
+		},
+	})
+}
+
+func parseDuplicateBy(s string) (map[string]bool, error) {
+	by := map[string]bool{}
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		switch v {
+		case "":
+		case DuplicateByISBN, DuplicateByIdentifier, DuplicateByTitle:
+			by[v] = true
+		default:
+			return nil, fmt.Errorf("不支持的查重方式: %s", v)
+		}
+	}
+	if len(by) == 0 {
+		by = map[string]bool{DuplicateByISBN: true, DuplicateByIdentifier: true, DuplicateByTitle: true}
+	}
+	return by, nil
+}
+
+// duplicateClusters 返回书库的查重结果。服务索引的更新时间没有变化时使用缓存，
+// 否则扫描整个索引重新计算
+func (c *Api) duplicateClusters(lib *library, by map[string]bool, threshold float64) ([]DuplicateCluster, error) {
+	index := lib.currentIndex()
+	updated, err := c.backend.UpdatedAt(index)
+	if err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("%s|%g", strings.Join(sortedKeys(by), ","), threshold)
+	cache := lib.duplicates.Load()
+	if cache != nil && cache.updated.Equal(updated) {
+		if clusters, ok := cache.results[key]; ok {
+			return clusters, nil
+		}
+	}
+
+	books, err := c.indexedBooks(index, duplicateFields)
+	if err != nil {
+		return nil, err
+	}
+	clusters := findDuplicates(books, by, threshold)
+	results := map[string][]DuplicateCluster{key: clusters}
+	if cache != nil && cache.updated.Equal(updated) {
+		for k, v := range cache.results {
+			results[k] = v
+		}
+	}
+	lib.duplicates.Store(&duplicateCache{updated: updated, results: results})
+	return clusters, nil
+}
+
+// indexedBooks 分页读取索引中的全部书籍
+func (c *Api) indexedBooks(index string, fields []string) ([]Book, error) {
+	const pageSize = 10000
+	var books []Book
+	for offset := int64(0); ; offset += pageSize {
+		docs, err := c.backend.Documents(index, offset, pageSize, fields)
+		if err != nil {
+			return nil, err
+		}
+		for _, doc := range docs {
+			var book Book
+			if err := decodeDocument(doc, &book); err != nil {
+				return nil, err
+			}
+			books = append(books, book)
+		}
+		if int64(len(docs)) < pageSize {
+			return books, nil
+		}
+	}
+}
+
+// findDuplicates 对书籍分组，满足任一查重方式的书籍归入同一组，组按书籍数量从多到少排序
+func findDuplicates(books []Book, by map[string]bool, threshold float64) []DuplicateCluster {
+	type edge struct {
+		book   int
+		reason string
+		key    string
+	}
+	uf := newUnionFind(len(books))
+	var edges []edge
+	link := func(i, j int, reason, key string) {
+		uf.union(i, j)
+		edges = append(edges, edge{book: i, reason: reason, key: key})
+	}
+	linkGroups := func(groups map[string][]int, reason string) {
+		for key, members := range groups {
+			for _, m := range members[1:] {
+				link(members[0], m, reason, key)
+			}
+		}
+	}
+
+	if by[DuplicateByISBN] {
+		groups := map[string][]int{}
+		for i, b := range books {
+			for _, isbn := range bookISBNs(b) {
+				groups["isbn:"+isbn] = append(groups["isbn:"+isbn], i)
+			}
+		}
+		linkGroups(groups, DuplicateByISBN)
+	}
+	if by[DuplicateByIdentifier] {
+		groups := map[string][]int{}
+		for i, b := range books {
+			for typ, value := range b.Identifiers {
+				typ = strings.ToLower(strings.TrimSpace(typ))
+				value = strings.ToLower(strings.TrimSpace(value))
+				// isbn 由上面的规则处理，这里只比较 douban、amazon 等其他标识符
+				if typ == "" || typ == "isbn" || value == "" {
+					continue
+				}
+				groups[typ+":"+value] = append(groups[typ+":"+value], i)
+			}
+		}
+		linkGroups(groups, DuplicateByIdentifier)
+	}
+	if by[DuplicateByTitle] {
+		titles := make([]string, len(books))
+		blocks := map[string][]int{}
+		for i, b := range books {
+			titles[i] = normalizeTitle(b.Title)
+			if titles[i] == "" {
+				continue
+			}
+			authors := b.Authors
+			if len(authors) == 0 {
+				authors = []string{""}
+			}
+			for _, a := range authors {
+				a = normalizeTitle(a)
+				blocks[a] = append(blocks[a], i)
+			}
+		}
+		for author, members := range blocks {
+			if len(members) > maxAuthorBlock {
+				log.Warnf("duplicates: skip title comparison for author %q with %d books", author, len(members))
+				continue
+			}
+			for x := 0; x < len(members); x++ {
+				for y := x + 1; y < len(members); y++ {
+					i, j := members[x], members[y]
+					if titleSimilarity(titles[i], titles[j]) >= threshold {
+						link(i, j, DuplicateByTitle, "title:"+titles[i]+"|"+author)
+					}
+				}
+			}
+		}
+	}
+
+	members := map[int][]int{}
+	for i := range books {
+		root := uf.find(i)
+		members[root] = append(members[root], i)
+	}
+	edgeReasons := map[int]map[string]bool{}
+	edgeKeys := map[int]map[string]bool{}
+	for _, e := range edges {
+		root := uf.find(e.book)
+		if edgeReasons[root] == nil {
+			edgeReasons[root] = map[string]bool{}
+			edgeKeys[root] = map[string]bool{}
+		}
+		edgeReasons[root][e.reason] = true
+		edgeKeys[root][e.key] = true
+	}
+
+	var clusters []DuplicateCluster
+	for root, ids := range members {
+		if len(ids) < 2 {
+			continue
+		}
+		cluster := DuplicateCluster{
+			Reasons: sortedKeys(edgeReasons[root]),
+			Keys:    sortedKeys(edgeKeys[root]),
+			Count:   len(ids),
+		}
+		for _, i := range ids {
+			b := books[i]
+			cluster.Books = append(cluster.Books, DuplicateBook{
+				ID:           b.ID,
+				Title:        b.Title,
+				Authors:      b.Authors,
+				Isbn:         b.Isbn,
+				Identifiers:  b.Identifiers,
+				Formats:      b.Formats,
+				Size:         b.Size,
+				LastModified: b.LastModified,
+			})
+		}
+		// 最近修改的排在前面，通常是需要保留的版本
+		sort.Slice(cluster.Books, func(i, j int) bool {
+			if !cluster.Books[i].LastModified.Equal(cluster.Books[j].LastModified) {
+				return cluster.Books[i].LastModified.After(cluster.Books[j].LastModified)
+			}
+			return cluster.Books[i].ID < cluster.Books[j].ID
+		})
+		clusters = append(clusters, cluster)
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		if clusters[i].Count != clusters[j].Count {
+			return clusters[i].Count > clusters[j].Count
+		}
+		return minBookID(clusters[i]) < minBookID(clusters[j])
+	})
+	if clusters == nil {
+		clusters = []DuplicateCluster{}
+	}
+	return clusters
+}
+
+func minBookID(c DuplicateCluster) int64 {
+	id := c.Books[0].ID
+	for _, b := range c.Books[1:] {
+		id = min(id, b.ID)
+	}
+	return id
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// bookISBNs 返回书籍 isbn 字段和 identifiers 中 isbn 的规范化结果
+func bookISBNs(b Book) []string {
+	var isbns []string
+	for _, s := range []string{b.Isbn, b.Identifiers["isbn"]} {
+		if isbn := normalizeISBN(s); isbn != "" && !slices.Contains(isbns, isbn) {
+			isbns = append(isbns, isbn)
+		}
+	}
+	return isbns
+}
+
+// normalizeISBN 去掉连字符和空格，并把 ISBN-10 转换为 ISBN-13，无效的 ISBN 返回空字符串
+func normalizeISBN(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(s) {
+		if unicode.IsDigit(r) || r == 'X' {
+			b.WriteRune(r)
+		}
+	}
+	isbn := b.String()
+	switch len(isbn) {
+	case 13:
+		if strings.ContainsRune(isbn, 'X') {
+			return ""
+		}
+		return isbn
+	case 10:
+		if strings.ContainsRune(isbn[:9], 'X') {
+			return ""
+		}
+		body := "978" + isbn[:9]
+		sum := 0
+		for i, r := range body {
+			d := int(r - '0')
+			if i%2 == 1 {
+				d *= 3
+			}
+			sum += d
+		}
+		return body + string(rune('0'+(10-sum%10)%10))
+	}
+	return ""
+}
+
+// normalizeTitle 用于比较的书名：转换为简体和小写，去掉括号内的版本说明、空白和标点
+func normalizeTitle(s string) string {
+	s = bracketed.ReplaceAllString(zhconv.ToSimplified(strings.ToLower(s)), "")
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// titleSimilarity 按字符二元组计算 Dice 系数，1 表示完全相同
+func titleSimilarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	x, y := bigrams(a), bigrams(b)
+	if len(x) == 0 || len(y) == 0 {
+		return 0
+	}
+	total := 0
+	for _, n := range x {
+		total += n
+	}
+	for _, n := range y {
+		total += n
+	}
+	common := 0
+	for g, n := range x {
+		common += min(n, y[g])
+	}
+	return 2 * float64(common) / float64(total)
+}
+
+func bigrams(s string) map[string]int {
+	runes := []rune(s)
+	grams := map[string]int{}
+	if len(runes) == 1 {
+		grams[s]++
+	}
+	for i := 0; i+1 < len(runes); i++ {
+		grams[string(runes[i:i+2])]++
+	}
+	return grams
+}
+
+// unionFind 并查集，用于合并满足不同查重方式的书籍
+type unionFind []int
+
+func newUnionFind(n int) unionFind {
+	uf := make(unionFind, n)
+	for i := range uf {
+		uf[i] = i
+	}
+	return uf
+}
+
+func (uf unionFind) find(i int) int {
+	for uf[i] != i {
+		uf[i] = uf[uf[i]]
+		i = uf[i]
+	}
+	return i
+}
+
+func (uf unionFind) union(i, j int) {
+	if a, b := uf.find(i), uf.find(j); a != b {
+		uf[max(a, b)] = min(a, b)
+	}
+}
@@ -0,0 +1,122 @@
+package calibre
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeISBN(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"978-7-5366-9293-0", "9787536692930"},
+		{"7536692935", "9787536692930"},
+		{"0-306-40615-2", "9780306406157"},
+		{"080442957X", "9780804429573"},
+		{"12345", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, normalizeISBN(tt.in), tt.in)
+	}
+}
+
+func TestTitleSimilarity(t *testing.T) {
+	assert.Equal(t, 1.0, titleSimilarity(normalizeTitle("三体（典藏版）"), normalizeTitle("三體")))
+	assert.Equal(t, 1.0, titleSimilarity(normalizeTitle("The Three-Body Problem"), normalizeTitle("the three body problem")))
+	assert.GreaterOrEqual(t, titleSimilarity(normalizeTitle("The Lord of the Rings"), normalizeTitle("Lord of the Rings")), defaultTitleSimilarity)
+	assert.Less(t, titleSimilarity(normalizeTitle("三体"), normalizeTitle("球状闪电")), 0.5)
+}
+
+func TestFindDuplicates(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	books := []Book{
+		{ID: 1, Title: "三体", Authors: []string{"刘慈欣"}, Isbn: "9787536692930", LastModified: day(1)},
+		{ID: 2, Title: "三體（繁体版）", Authors: []string{"劉慈欣"}, LastModified: day(3)},
+		{ID: 3, Title: "地球往事", Authors: []string{"Liu Cixin"}, Identifiers: map[string]string{"isbn": "7-5366-9293-5"}, LastModified: day(2)},
+		{ID: 4, Title: "活着", Authors: []string{"余华"}, Identifiers: map[string]string{"douban": "4913064"}},
+		{ID: 5, Title: "To Live", Authors: []string{"Yu Hua"}, Identifiers: map[string]string{"douban": "4913064"}},
+		{ID: 6, Title: "球状闪电", Authors: []string{"刘慈欣"}},
+	}
+
+	clusters := findDuplicates(books, map[string]bool{DuplicateByISBN: true, DuplicateByIdentifier: true, DuplicateByTitle: true}, defaultTitleSimilarity)
+	assert.Len(t, clusters, 2)
+	assert.Equal(t, 3, clusters[0].Count)
+	assert.Equal(t, []string{"isbn", "title"}, clusters[0].Reasons)
+	// 最近修改的排在前面
+	assert.Equal(t, []int64{2, 3, 1}, bookIds(clusters[0]))
+	assert.Equal(t, []string{"identifiers"}, clusters[1].Reasons)
+	assert.Equal(t, []string{"douban:4913064"}, clusters[1].Keys)
+	assert.Equal(t, []int64{4, 5}, bookIds(clusters[1]))
+
+	clusters = findDuplicates(books, map[string]bool{DuplicateByTitle: true}, defaultTitleSimilarity)
+	assert.Len(t, clusters, 1)
+	assert.Equal(t, []int64{2, 1}, bookIds(clusters[0]))
+}
+
+func bookIds(c DuplicateCluster) []int64 {
+	var ids []int64
+	for _, b := range c.Books {
+		ids = append(ids, b.ID)
+	}
+	return ids
+}
+
+// documentCounter 记录读取全部文档的次数
+type documentCounter struct {
+	SearchBackend
+	scans int
+}
+
+func (b *documentCounter) Documents(index string, offset, limit int64, fields []string) ([]map[string]interface{}, error) {
+	if offset == 0 {
+		b.scans++
+	}
+	return b.SearchBackend.Documents(index, offset, limit, fields)
+}
+
+func TestListDuplicates(t *testing.T) {
+	embedded, err := newEmbeddedBackend(t.TempDir())
+	assert.NoError(t, err)
+	_, err = embedded.Upsert("books", []Book{
+		{ID: 1, Title: "三体", Authors: []string{"刘慈欣"}, Isbn: "9787536692930"},
+		{ID: 2, Title: "三體", Authors: []string{"劉慈欣"}},
+		{ID: 3, Title: "活着", Authors: []string{"余华"}, Identifiers: map[string]string{"douban": "4913064"}},
+		{ID: 4, Title: "To Live", Authors: []string{"Yu Hua"}, Identifiers: map[string]string{"douban": "4913064"}},
+	}, 10)
+	assert.NoError(t, err)
+	backend := &documentCounter{SearchBackend: embedded}
+	lib := newLibrary(defaultLibraryID, defaultLibraryID, true, "books")
+	api := &Api{backend: backend, libraries: map[string]*library{lib.id: lib}, defaultLibrary: lib.id}
+	router := gin.New()
+	router.GET("/api/duplicates", api.listDuplicates)
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/duplicates"+query, nil))
+		return w
+	}
+
+	// 翻页使用同一次扫描的结果
+	assert.Equal(t, http.StatusOK, get("?limit=1").Code)
+	w := get("?limit=1&offset=1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"total":2`)
+	assert.Equal(t, 1, backend.scans)
+
+	// 查重方式不同时重新计算，索引写入后缓存失效
+	assert.Equal(t, http.StatusOK, get("?by=isbn").Code)
+	assert.Equal(t, 2, backend.scans)
+	_, err = embedded.Upsert("books", []Book{{ID: 5, Title: "球状闪电", Authors: []string{"刘慈欣"}}}, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, get("").Code)
+	assert.Equal(t, 3, backend.scans)
+
+	assert.Equal(t, http.StatusBadRequest, get("?offset=-1").Code)
+	assert.Equal(t, http.StatusBadRequest, get("?limit=-5").Code)
+}
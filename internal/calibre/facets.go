@@ -0,0 +1,109 @@
+package calibre
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// facetableAttributes 允许分面统计的字段，均需配置为 filterable
+var facetableAttributes = []string{"authors", "tags", "publisher", "languages", "rating", "series"}
+
+// FacetCount 分面统计项
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// parseFacets 解析分面字段，支持逗号分隔和多值参数
+func parseFacets(values []string) ([]string, error) {
+	var facets []string
+	for _, v := range values {
+		for _, f := range strings.Split(v, ",") {
+			f = strings.TrimSpace(f)
+			if f == "" {
+				continue
+			}
+			// 自定义列都是可过滤的，可以按 custom.<列名> 统计
+			if !slices.Contains(facetableAttributes, f) && !strings.HasPrefix(f, "custom.") {
+				return nil, fmt.Errorf("不支持的分面字段: %s，可选值: %s,custom.<列名>", f, strings.Join(facetableAttributes, ","))
+			}
+			facets = append(facets, f)
+		}
+	}
+	return facets, nil
+}
+
+// sortFacets 将分面分布转换为按数量降序的列表，limit 大于 0 时截取前 limit 项
+func sortFacets(distribution map[string]map[string]int64, limit int) map[string][]FacetCount {
+	facets := make(map[string][]FacetCount, len(distribution))
+	for facet, values := range distribution {
+		counts := make([]FacetCount, 0, len(values))
+		for value, count := range values {
+			counts = append(counts, FacetCount{Value: value, Count: count})
+		}
+		sort.Slice(counts, func(i, j int) bool {
+			if counts[i].Count != counts[j].Count {
+				return counts[i].Count > counts[j].Count
+			}
+			return counts[i].Value < counts[j].Value
+		})
+		if limit > 0 && len(counts) > limit {
+			counts = counts[:limit]
+		}
+		facets[facet] = counts
+	}
+	return facets
+}
+
+// facetCounts 统计满足查询条件的书籍总数和各分面的取值数量
+func (c *Api) facetCounts(lib *library, q string, filter interface{}, facets []string, limit int) (int64, map[string][]FacetCount, error) {
+	result, err := c.backend.Search(lib.currentIndex(), &SearchQuery{
+		Query:  normalizeQuery(q),
+		Filter: filter,
+		Facets: facets,
+		Limit:  1,
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return result.Total, sortFacets(result.FacetDistribution, limit), nil
+}
+
+// listFacets 分面统计接口
+func (c *Api) listFacets(r *gin.Context) {
+	var req FacetsRequest
+	if err := r.ShouldBindQuery(&req); err != nil {
+		r.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	values := []string{req.Facets}
+	if req.Facets == "" {
+		values = facetableAttributes
+	}
+	facets, err := parseFacets(values)
+	if err != nil {
+		r.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	var filter interface{}
+	if req.Filter != "" {
+		filter = req.Filter
+	}
+	total, counts, err := c.facetCounts(c.lib(r), req.Q, filter, facets, req.Limit)
+	if err != nil {
+		r.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error()})
+		return
+	}
+	r.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"total":  total,
+			"facets": counts,
+		},
+	})
+}
@@ -0,0 +1,481 @@
+package calibre
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/cast"
+)
+
+// filterExpr 解析后的 Meilisearch 过滤表达式，供进程内后端求值
+type filterExpr interface {
+	match(doc map[string]interface{}) bool
+}
+
+type andFilter []filterExpr
+
+func (f andFilter) match(doc map[string]interface{}) bool {
+	for _, e := range f {
+		if !e.match(doc) {
+			return false
+		}
+	}
+	return true
+}
+
+type orFilter []filterExpr
+
+func (f orFilter) match(doc map[string]interface{}) bool {
+	for _, e := range f {
+		if e.match(doc) {
+			return true
+		}
+	}
+	return false
+}
+
+type notFilter struct {
+	expr filterExpr
+}
+
+func (f notFilter) match(doc map[string]interface{}) bool {
+	return !f.expr.match(doc)
+}
+
+// compareFilter field op value，数组字段只要有一个元素满足即可
+type compareFilter struct {
+	field string
+	op    string
+	value string
+}
+
+func (f compareFilter) match(doc map[string]interface{}) bool {
+	if f.op == "!=" {
+		return !compareFilter{field: f.field, op: "=", value: f.value}.match(doc)
+	}
+	v, _ := docField(doc, f.field)
+	for _, v := range filterValues(v) {
+		if compareFilterValue(v, f.value, f.op) {
+			return true
+		}
+	}
+	return false
+}
+
+type inFilter struct {
+	field  string
+	values []string
+}
+
+func (f inFilter) match(doc map[string]interface{}) bool {
+	for _, v := range f.values {
+		if (compareFilter{field: f.field, op: "=", value: v}).match(doc) {
+			return true
+		}
+	}
+	return false
+}
+
+type existsFilter struct {
+	field string
+}
+
+func (f existsFilter) match(doc map[string]interface{}) bool {
+	_, ok := docField(doc, f.field)
+	return ok
+}
+
+type nullFilter struct {
+	field string
+}
+
+func (f nullFilter) match(doc map[string]interface{}) bool {
+	v, ok := docField(doc, f.field)
+	return ok && v == nil
+}
+
+type emptyFilter struct {
+	field string
+}
+
+func (f emptyFilter) match(doc map[string]interface{}) bool {
+	v, _ := docField(doc, f.field)
+	switch v := v.(type) {
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// docField 读取文档字段，与 Meilisearch 一样支持用 . 访问嵌套对象，如 custom.read
+func docField(doc map[string]interface{}, field string) (interface{}, bool) {
+	if v, ok := doc[field]; ok {
+		return v, true
+	}
+	parent, child, ok := strings.Cut(field, ".")
+	if !ok {
+		return nil, false
+	}
+	nested, ok := doc[parent].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	return docField(nested, child)
+}
+
+func filterValues(v interface{}) []interface{} {
+	if arr, ok := v.([]interface{}); ok {
+		return arr
+	}
+	if v == nil {
+		return nil
+	}
+	return []interface{}{v}
+}
+
+func compareFilterValue(v interface{}, value string, op string) bool {
+	var c int
+	if n, ok := v.(float64); ok {
+		x, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return false
+		}
+		switch {
+		case n < x:
+			c = -1
+		case n > x:
+			c = 1
+		}
+	} else if b, ok := v.(bool); ok {
+		if op != "=" {
+			return false
+		}
+		return strconv.FormatBool(b) == strings.ToLower(value)
+	} else {
+		s := cast.ToString(v)
+		if op == "=" {
+			return strings.EqualFold(s, value)
+		}
+		c = strings.Compare(strings.ToLower(s), strings.ToLower(value))
+	}
+	switch op {
+	case "=":
+		return c == 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	}
+	return false
+}
+
+// parseFilter 解析 Meilisearch 过滤参数，支持字符串表达式和数组形式：
+// 数组元素之间为 AND，嵌套数组内部为 OR。
+func parseFilter(filter interface{}) (filterExpr, error) {
+	switch f := filter.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if strings.TrimSpace(f) == "" {
+			return nil, nil
+		}
+		p := &filterParser{tokens: lexFilter(f)}
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.pos < len(p.tokens) {
+			return nil, fmt.Errorf("invalid filter %q: unexpected %q", f, p.tokens[p.pos].text)
+		}
+		return expr, nil
+	case []string:
+		items := make([]interface{}, len(f))
+		for i := range f {
+			items[i] = f[i]
+		}
+		return parseFilter(items)
+	case []interface{}:
+		var and andFilter
+		for _, item := range f {
+			if nested, ok := item.([]interface{}); ok {
+				var or orFilter
+				for _, n := range nested {
+					e, err := parseFilter(n)
+					if err != nil {
+						return nil, err
+					}
+					if e != nil {
+						or = append(or, e)
+					}
+				}
+				if len(or) > 0 {
+					and = append(and, or)
+				}
+				continue
+			}
+			e, err := parseFilter(item)
+			if err != nil {
+				return nil, err
+			}
+			if e != nil {
+				and = append(and, e)
+			}
+		}
+		if len(and) == 0 {
+			return nil, nil
+		}
+		return and, nil
+	default:
+		return nil, fmt.Errorf("unsupported filter type %T", filter)
+	}
+}
+
+type filterToken struct {
+	text   string
+	quoted bool
+}
+
+func lexFilter(s string) []filterToken {
+	var tokens []filterToken
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')' || r == '[' || r == ']' || r == ',':
+			tokens = append(tokens, filterToken{text: string(r)})
+			i++
+		case r == '"' || r == '\'':
+			j := i + 1
+			var sb strings.Builder
+			for j < len(runes) && runes[j] != r {
+				if runes[j] == '\\' && j+1 < len(runes) {
+					j++
+				}
+				sb.WriteRune(runes[j])
+				j++
+			}
+			tokens = append(tokens, filterToken{text: sb.String(), quoted: true})
+			i = j + 1
+		case r == '=' || r == '!' || r == '>' || r == '<':
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				tokens = append(tokens, filterToken{text: string(runes[i : i+2])})
+				i += 2
+			} else {
+				tokens = append(tokens, filterToken{text: string(r)})
+				i++
+			}
+		default:
+			j := i
+			for j < len(runes) && !unicode.IsSpace(runes[j]) && !strings.ContainsRune("()[],=!<>\"'", runes[j]) {
+				j++
+			}
+			tokens = append(tokens, filterToken{text: string(runes[i:j])})
+			i = j
+		}
+	}
+	return tokens
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) peek() (filterToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return filterToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+// keyword 当前词项是否为指定关键字（不区分大小写），是则消费
+func (p *filterParser) keyword(kw string) bool {
+	t, ok := p.peek()
+	if ok && !t.quoted && strings.EqualFold(t.text, kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) next() (filterToken, error) {
+	t, ok := p.peek()
+	if !ok {
+		return t, fmt.Errorf("invalid filter: unexpected end")
+	}
+	p.pos++
+	return t, nil
+}
+
+func (p *filterParser) expect(text string) error {
+	t, err := p.next()
+	if err != nil {
+		return err
+	}
+	if t.quoted || t.text != text {
+		return fmt.Errorf("invalid filter: expected %q, got %q", text, t.text)
+	}
+	return nil
+}
+
+func (p *filterParser) parseOr() (filterExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	or := orFilter{left}
+	for p.keyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		or = append(or, right)
+	}
+	if len(or) == 1 {
+		return left, nil
+	}
+	return or, nil
+}
+
+func (p *filterParser) parseAnd() (filterExpr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	and := andFilter{left}
+	for p.keyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		and = append(and, right)
+	}
+	if len(and) == 1 {
+		return left, nil
+	}
+	return and, nil
+}
+
+func (p *filterParser) parseNot() (filterExpr, error) {
+	if p.keyword("NOT") {
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notFilter{expr: expr}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *filterParser) parsePrimary() (filterExpr, error) {
+	t, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if !t.quoted && t.text == "(" {
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return expr, p.expect(")")
+	}
+	field := t.text
+
+	if p.keyword("EXISTS") {
+		return existsFilter{field: field}, nil
+	}
+	if p.keyword("IS") {
+		negate := p.keyword("NOT")
+		var expr filterExpr
+		switch {
+		case p.keyword("NULL"):
+			expr = nullFilter{field: field}
+		case p.keyword("EMPTY"):
+			expr = emptyFilter{field: field}
+		default:
+			return nil, fmt.Errorf("invalid filter: expected NULL or EMPTY after %s IS", field)
+		}
+		if negate {
+			return notFilter{expr: expr}, nil
+		}
+		return expr, nil
+	}
+	if p.keyword("NOT") {
+		switch {
+		case p.keyword("EXISTS"):
+			return notFilter{expr: existsFilter{field: field}}, nil
+		case p.keyword("IN"):
+			in, err := p.parseIn(field)
+			if err != nil {
+				return nil, err
+			}
+			return notFilter{expr: in}, nil
+		}
+		return nil, fmt.Errorf("invalid filter: expected EXISTS or IN after %s NOT", field)
+	}
+	if p.keyword("IN") {
+		return p.parseIn(field)
+	}
+
+	op, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	switch op.text {
+	case "=", "!=", ">", ">=", "<", "<=":
+		value, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		return compareFilter{field: field, op: op.text, value: value.text}, nil
+	}
+	// field from TO to
+	if p.keyword("TO") {
+		to, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		return andFilter{
+			compareFilter{field: field, op: ">=", value: op.text},
+			compareFilter{field: field, op: "<=", value: to.text},
+		}, nil
+	}
+	return nil, fmt.Errorf("invalid filter: unexpected %q after %s", op.text, field)
+}
+
+func (p *filterParser) parseIn(field string) (filterExpr, error) {
+	if err := p.expect("["); err != nil {
+		return nil, err
+	}
+	in := inFilter{field: field}
+	for {
+		t, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		if !t.quoted && t.text == "]" {
+			return in, nil
+		}
+		if !t.quoted && t.text == "," {
+			continue
+		}
+		in.values = append(in.values, t.text)
+	}
+}
+
+// quoteFilterValue 将字符串转换为过滤表达式中的带引号的值
+func quoteFilterValue(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,84 @@
+package calibre
+
+import (
+	"mime"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// preferredFormats 书籍有多种格式时默认下载的顺序
+var preferredFormats = []string{"epub", "azw3", "mobi", "pdf"}
+
+// formatMimeTypes 常见电子书格式的 MIME 类型，其他格式按扩展名查询系统类型
+var formatMimeTypes = map[string]string{
+	"epub":  "application/epub+zip",
+	"kepub": "application/epub+zip",
+	"azw":   "application/vnd.amazon.ebook",
+	"azw3":  "application/vnd.amazon.ebook",
+	"mobi":  "application/x-mobipocket-ebook",
+	"pdf":   "application/pdf",
+	"txt":   "text/plain; charset=utf-8",
+	"fb2":   "application/x-fictionbook+xml",
+	"djvu":  "image/vnd.djvu",
+	"cbz":   "application/vnd.comicbook+zip",
+	"cbr":   "application/vnd.comicbook-rar",
+	"rtf":   "application/rtf",
+	"docx":  "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	"zip":   "application/zip",
+}
+
+// formatMimeType 返回格式对应的 MIME 类型，format 不区分大小写
+func formatMimeType(format string) string {
+	format = strings.ToLower(format)
+	if t, ok := formatMimeTypes[format]; ok {
+		return t
+	}
+	if t := mime.TypeByExtension("." + format); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// preferredFormat 返回默认下载的格式（小写），没有格式信息时为 epub
+func preferredFormat(formats []string) string {
+	for _, f := range preferredFormats {
+		if hasFormat(formats, f) {
+			return f
+		}
+	}
+	if len(formats) > 0 {
+		return strings.ToLower(formats[0])
+	}
+	return "epub"
+}
+
+// hasFormat calibre 返回的格式名称为大写，比较时不区分大小写
+func hasFormat(formats []string, format string) bool {
+	return slices.ContainsFunc(formats, func(f string) bool {
+		return strings.EqualFold(f, format)
+	})
+}
+
+// bookFilePath 书籍默认格式的下载地址，不含书库参数
+func bookFilePath(id int64, formats []string) string {
+	return "/api/download/book/" + strconv.FormatInt(id, 10) + "." + preferredFormat(formats)
+}
+
+// downloadFilename 下载文件名：书名 - 作者.格式，去掉文件名中不允许的字符
+func downloadFilename(book Book, format string) string {
+	name := strings.TrimSpace(book.Title)
+	if name == "" {
+		name = strconv.FormatInt(book.ID, 10)
+	}
+	if len(book.Authors) > 0 {
+		name += " - " + strings.Join(book.Authors, ", ")
+	}
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < 0x20 {
+			return '_'
+		}
+		return r
+	}, name)
+	return name + "." + strings.ToLower(format)
+}
@@ -0,0 +1,45 @@
+package calibre
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatMimeType(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"epub", "application/epub+zip"},
+		{"PDF", "application/pdf"},
+		{"azw3", "application/vnd.amazon.ebook"},
+		{"unknownfmt", "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, formatMimeType(tt.format), tt.format)
+	}
+}
+
+func TestPreferredFormat(t *testing.T) {
+	tests := []struct {
+		formats []string
+		want    string
+	}{
+		{nil, "epub"},
+		{[]string{"PDF", "EPUB"}, "epub"},
+		{[]string{"MOBI", "AZW3"}, "azw3"},
+		{[]string{"TXT", "PDF"}, "pdf"},
+		{[]string{"CBZ"}, "cbz"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, preferredFormat(tt.formats), tt.formats)
+	}
+}
+
+func TestDownloadFilename(t *testing.T) {
+	assert.Equal(t, "三体 - 刘慈欣.epub", downloadFilename(Book{ID: 1, Title: "三体", Authors: []string{"刘慈欣"}}, "EPUB"))
+	assert.Equal(t, "A_B - X, Y.pdf", downloadFilename(Book{ID: 1, Title: "A/B", Authors: []string{"X", "Y"}}, "pdf"))
+	assert.Equal(t, "42.mobi", downloadFilename(Book{ID: 42}, "mobi"))
+	assert.Equal(t, "/api/download/book/7.azw3", bookFilePath(7, []string{"AZW3", "PDF"}))
+}
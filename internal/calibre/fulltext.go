@@ -0,0 +1,386 @@
+package calibre
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jianyun8023/calibre-api/pkg/log"
+	"github.com/kapmahc/epub"
+	"golang.org/x/net/html"
+)
+
+const (
+	// fullTextChunkSize 章节按字符数切分为多个文档，避免超出 Meilisearch 单字段的词数上限，也让摘要更准确
+	fullTextChunkSize = 2000
+	// fullTextCropLength 全文搜索摘要的长度
+	fullTextCropLength = 30
+)
+
+// fullTextIndexSettings 全文索引设置，章节标题的权重高于正文
+var fullTextIndexSettings = IndexSettings{
+	FilterableAttributes: []string{"book_id"},
+	SearchableAttributes: []string{"chapter", "title", "content"},
+}
+
+// Chapter 全文索引中的章节片段
+type Chapter struct {
+	ID      string `json:"id"`
+	BookID  int64  `json:"book_id"`
+	Title   string `json:"title"`
+	Chapter string `json:"chapter"`
+	Href    string `json:"href"`
+	Content string `json:"content"`
+}
+
+// FullTextHit 全文搜索结果，url 指向 /api/read/:id/file/*path
+type FullTextHit struct {
+	BookID  int64  `json:"book_id"`
+	Title   string `json:"title"`
+	Chapter string `json:"chapter"`
+	Href    string `json:"href"`
+	URL     string `json:"url"`
+	Snippet string `json:"snippet"`
+}
+
+// searchFullText 在书籍正文中搜索
+func (c *Api) searchFullText(r *gin.Context) {
+	if !c.config.Search.FullText {
+		r.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "未启用全文索引，请在配置中设置 search.fulltext: true"})
+		return
+	}
+	var req FullTextSearchRequest
+	if err := r.ShouldBindQuery(&req); err != nil {
+		r.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = 20
+	}
+	query := &SearchQuery{
+		Query:                 req.Q,
+		Limit:                 req.Limit,
+		Offset:                req.Offset,
+		AttributesToRetrieve:  []string{"book_id", "title", "chapter", "href"},
+		AttributesToHighlight: []string{"content"},
+		AttributesToCrop:      []string{"content"},
+		CropLength:            fullTextCropLength,
+	}
+	if req.BookID != 0 {
+		query.Filter = fmt.Sprintf("book_id = %d", req.BookID)
+	}
+	lib := c.lib(r)
+	result, err := c.backend.Search(lib.fullTextIndex(), query)
+	if err != nil {
+		r.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error()})
+		return
+	}
+
+	hits := make([]FullTextHit, 0, len(result.Hits))
+	for _, h := range result.Hits {
+		var chapter Chapter
+		if err := decodeDocument(h, &chapter); err != nil {
+			r.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error()})
+			return
+		}
+		hit := FullTextHit{
+			BookID:  chapter.BookID,
+			Title:   chapter.Title,
+			Chapter: chapter.Chapter,
+			Href:    chapter.Href,
+			URL:     path.Join("/api/read", strconv.FormatInt(chapter.BookID, 10), "file", chapter.Href) + lib.query(),
+		}
+		if formatted, ok := h["_formatted"].(map[string]interface{}); ok {
+			hit.Snippet, _ = formatted["content"].(string)
+		}
+		hits = append(hits, hit)
+	}
+	r.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"records": hits,
+			"total":   result.Total,
+			"limit":   result.Limit,
+			"offset":  result.Offset,
+		},
+	})
+}
+
+// updateFullTextIndex 后台建立全文索引，未指定 ids 时重建全部书籍
+func (c *Api) updateFullTextIndex(r *gin.Context) {
+	if !c.config.Search.FullText {
+		r.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "未启用全文索引，请在配置中设置 search.fulltext: true"})
+		return
+	}
+	var req FullTextIndexRequest
+	if err := r.ShouldBind(&req); err != nil && err != io.EOF {
+		r.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	var ids []int64
+	for _, s := range strings.Split(req.IDs, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			r.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的书籍 ID: " + s})
+			return
+		}
+		ids = append(ids, id)
+	}
+
+	lib := c.lib(r)
+	job, err := c.jobs.start(IndexJobModeFullText, lib.id)
+	if err != nil {
+		r.JSON(http.StatusOK, gin.H{"code": 400, "error": err.Error()})
+		return
+	}
+	go func() {
+		job.finish(c.indexFullText(job, lib, ids))
+	}()
+
+	r.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    job.snapshot(),
+	})
+}
+
+// indexFullText 提取书籍章节写入全文索引。ids 为空时在暂存索引中重建当前索引的全部书籍，
+// 完成后与全文索引交换，重建期间搜索仍使用旧的全文索引；否则只替换指定书籍的章节。
+// 单本书籍失败只记录错误，不中断任务。
+func (c *Api) indexFullText(job *indexJob, lib *library, ids []int64) error {
+	job.setPhase(IndexJobPhaseFetching)
+	rebuild := len(ids) == 0
+	var index string
+	var taskIds []int64
+	var err error
+	if rebuild {
+		index = lib.fullTextStagingIndex()
+		ids, err = c.indexedBookIds(lib.currentIndex())
+		if err != nil {
+			return err
+		}
+		taskIds, err = c.backend.DeleteAll(index)
+	} else {
+		index = lib.fullTextIndex()
+		taskIds, err = c.deleteFullText(lib, ids)
+	}
+	if err != nil {
+		return err
+	}
+	job.update(func(j *IndexJob) {
+		j.BooksTotal = len(ids)
+	})
+	job.addTasks(taskIds...)
+
+	for _, id := range ids {
+		chapters, err := c.bookChapters(lib, id)
+		if err != nil {
+			log.Warnf("full text index book %d: %v", id, err)
+			job.update(func(j *IndexJob) {
+				j.Errors = append(j.Errors, fmt.Sprintf("book %d: %v", id, err))
+			})
+			continue
+		}
+		tasks, err := c.backend.Upsert(index, chapters, len(chapters))
+		if err != nil {
+			return err
+		}
+		taskIds = append(taskIds, tasks...)
+		job.addTasks(tasks...)
+		job.update(func(j *IndexJob) {
+			j.BooksFetched++
+			j.BatchesEnqueued += len(tasks)
+		})
+	}
+	if err := c.waitForTasks(job, taskIds); err != nil {
+		return err
+	}
+	if !rebuild {
+		return nil
+	}
+	taskIds, err = c.backend.Swap(lib.fullTextIndex(), index)
+	if err != nil {
+		return err
+	}
+	job.addTasks(taskIds...)
+	if err := c.waitForTasks(job, taskIds); err != nil {
+		return err
+	}
+	log.Infof("library %q: swapped index %q and %q", lib.id, lib.fullTextIndex(), index)
+	return nil
+}
+
+// deleteFullText 从全文索引中删除指定书籍的章节，未启用全文索引时不做任何事。
+// 书籍被删除或重新同步后调用，避免搜索到已经不存在的正文。
+func (c *Api) deleteFullText(lib *library, bookIds []int64) ([]int64, error) {
+	if c.config == nil || !c.config.Search.FullText || len(bookIds) == 0 {
+		return nil, nil
+	}
+	stale, err := c.fullTextDocumentIds(lib, bookIds)
+	if err != nil || len(stale) == 0 {
+		return nil, err
+	}
+	return c.backend.Delete(lib.fullTextIndex(), stale)
+}
+
+// fullTextDocumentIds 查询指定书籍在全文索引中的文档 id
+func (c *Api) fullTextDocumentIds(lib *library, bookIds []int64) ([]string, error) {
+	var ids []string
+	for _, bookId := range bookIds {
+		for offset := int64(0); ; offset += 1000 {
+			result, err := c.backend.Search(lib.fullTextIndex(), &SearchQuery{
+				Filter:               fmt.Sprintf("book_id = %d", bookId),
+				AttributesToRetrieve: []string{"id"},
+				Limit:                1000,
+				Offset:               offset,
+			})
+			if err != nil {
+				return nil, err
+			}
+			for _, hit := range result.Hits {
+				ids = append(ids, fmt.Sprint(hit["id"]))
+			}
+			if len(result.Hits) < 1000 {
+				break
+			}
+		}
+	}
+	return ids, nil
+}
+
+// bookChapters 下载书籍并按 spine 顺序提取章节正文，
+// 下载的文件如果原本不在缓存中，处理完成后删除，避免全量索引时占满磁盘。
+func (c *Api) bookChapters(lib *library, id int64) ([]Chapter, error) {
+	var book Book
+	if err := c.backend.GetDocument(lib.currentIndex(), strconv.FormatInt(id, 10), &book); err != nil {
+		return nil, err
+	}
+	cached := Exists(path.Join(c.cacheDir(lib), strconv.FormatInt(id, 10)+".epub"))
+	filepath, err := c.getFileOrCache(lib, strconv.FormatInt(id, 10))
+	if err != nil {
+		return nil, err
+	}
+	if !cached {
+		defer os.Remove(filepath)
+	}
+	return c.extractChapters(filepath, book)
+}
+
+// extractChapters 按 spine 顺序读取 EPUB 的章节，章节标题取自目录，
+// 不在目录中的文件沿用前一个章节的标题
+func (c *Api) extractChapters(filepath string, book Book) ([]Chapter, error) {
+	eb, err := epub.Open(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer eb.Close()
+
+	baseDir := path.Dir(eb.Container.Rootfile.Path)
+	titles := map[string]string{}
+	for _, point := range c.expansionTree(eb.Ncx.Points) {
+		src, _, _ := strings.Cut(point.Content.Src, "#")
+		if _, ok := titles[src]; !ok {
+			titles[src] = strings.TrimSpace(point.Text)
+		}
+	}
+	hrefs := map[string]string{}
+	for _, item := range eb.Opf.Manifest {
+		hrefs[item.ID] = item.Href
+	}
+
+	var chapters []Chapter
+	title := ""
+	for i, item := range eb.Opf.Spine.Items {
+		href, ok := hrefs[item.IDref]
+		if !ok {
+			continue
+		}
+		if t, ok := titles[href]; ok {
+			title = t
+		}
+		rc, err := eb.Open(href)
+		if err != nil {
+			return nil, err
+		}
+		text, err := htmlText(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", href, err)
+		}
+		for j, chunk := range splitRunes(text, fullTextChunkSize) {
+			chapters = append(chapters, Chapter{
+				ID:      fmt.Sprintf("%d_%d_%d", book.ID, i, j),
+				BookID:  book.ID,
+				Title:   book.Title,
+				Chapter: title,
+				Href:    path.Join(baseDir, href),
+				Content: chunk,
+			})
+		}
+	}
+	return chapters, nil
+}
+
+// htmlText 提取 XHTML 中的可见文本，连续空白合并为一个空格
+func htmlText(r io.Reader) (string, error) {
+	z := html.NewTokenizer(r)
+	var b strings.Builder
+	skip := 0
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				return strings.Join(strings.Fields(b.String()), " "), nil
+			}
+			return "", z.Err()
+		case html.StartTagToken:
+			if name, _ := z.TagName(); isInvisibleTag(string(name)) {
+				skip++
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); isInvisibleTag(string(name)) && skip > 0 {
+				skip--
+			}
+		case html.TextToken:
+			if skip == 0 {
+				b.Write(z.Text())
+				b.WriteByte(' ')
+			}
+		}
+	}
+}
+
+func isInvisibleTag(name string) bool {
+	return name == "head" || name == "script" || name == "style"
+}
+
+// splitRunes 按字符数切分文本，尽量在空白处断开
+func splitRunes(text string, size int) []string {
+	runes := []rune(text)
+	var chunks []string
+	for len(runes) > 0 {
+		end := min(size, len(runes))
+		if end < len(runes) {
+			for k := end; k > end/2; k-- {
+				if runes[k] == ' ' {
+					end = k
+					break
+				}
+			}
+		}
+		if chunk := strings.TrimSpace(string(runes[:end])); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		runes = runes[end:]
+	}
+	return chunks
+}
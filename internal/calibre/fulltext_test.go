@@ -0,0 +1,142 @@
+package calibre
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestEpub(t *testing.T, files map[string]string) string {
+	name := filepath.Join(t.TempDir(), "book.epub")
+	f, err := os.Create(name)
+	assert.NoError(t, err)
+	w := zip.NewWriter(f)
+	for n, content := range files {
+		fw, err := w.Create(n)
+		assert.NoError(t, err)
+		_, err = fw.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, w.Close())
+	assert.NoError(t, f.Close())
+	return name
+}
+
+func TestExtractChapters(t *testing.T) {
+	file := writeTestEpub(t, map[string]string{
+		"mimetype": "application/epub+zip",
+		"META-INF/container.xml": `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>`,
+		"OEBPS/content.opf": `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="2.0">
+  <manifest>
+    <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+    <item id="c1" href="text/c1.xhtml" media-type="application/xhtml+xml"/>
+    <item id="c2" href="text/c2.xhtml" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine toc="ncx"><itemref idref="c1"/><itemref idref="c2"/></spine>
+</package>`,
+		"OEBPS/toc.ncx": `<?xml version="1.0"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+  <navMap>
+    <navPoint id="p1"><navLabel><text>第一章 科学边界</text></navLabel><content src="text/c1.xhtml#start"/></navPoint>
+  </navMap>
+</ncx>`,
+		"OEBPS/text/c1.xhtml": `<html><head><title>忽略</title><style>p{}</style></head><body><p>汪淼觉得，</p><p>这个世界在他的眼中是  一张巨大的网。</p></body></html>`,
+		"OEBPS/text/c2.xhtml": `<html><body><p>倒计时还在继续。</p></body></html>`,
+	})
+
+	c := &Api{}
+	chapters, err := c.extractChapters(file, Book{ID: 9, Title: "三体"})
+	assert.NoError(t, err)
+	assert.Equal(t, []Chapter{
+		{ID: "9_0_0", BookID: 9, Title: "三体", Chapter: "第一章 科学边界", Href: "OEBPS/text/c1.xhtml", Content: "汪淼觉得， 这个世界在他的眼中是 一张巨大的网。"},
+		{ID: "9_1_0", BookID: 9, Title: "三体", Chapter: "第一章 科学边界", Href: "OEBPS/text/c2.xhtml", Content: "倒计时还在继续。"},
+	}, chapters)
+
+	backend, err := newEmbeddedBackend(t.TempDir())
+	assert.NoError(t, err)
+	_, err = backend.EnsureIndex("books-fulltext", fullTextIndexSettings)
+	assert.NoError(t, err)
+	_, err = backend.Upsert("books-fulltext", chapters, len(chapters))
+	assert.NoError(t, err)
+	result, err := backend.Search("books-fulltext", &SearchQuery{
+		Query:                 "巨大的网",
+		Limit:                 10,
+		AttributesToRetrieve:  []string{"book_id", "href"},
+		AttributesToHighlight: []string{"content"},
+		AttributesToCrop:      []string{"content"},
+		CropLength:            5,
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, result.Hits, 1) {
+		assert.Equal(t, "OEBPS/text/c1.xhtml", result.Hits[0]["href"])
+		assert.Equal(t, "…中是 一张<em>巨大的网</em>。", result.Hits[0]["_formatted"].(map[string]interface{})["content"])
+	}
+}
+
+func TestSplitRunes(t *testing.T) {
+	assert.Equal(t, []string{"aaa bb", "cc"}, splitRunes("aaa bb cc", 6))
+	assert.Equal(t, []string{"一二三", "四五"}, splitRunes("一二三四五", 3))
+	assert.Empty(t, splitRunes("  ", 3))
+}
+
+func chapterIds(t *testing.T, backend SearchBackend, index string) []string {
+	result, err := backend.Search(index, &SearchQuery{Limit: 100})
+	assert.NoError(t, err)
+	ids := make([]string, 0, len(result.Hits))
+	for _, hit := range result.Hits {
+		ids = append(ids, hit["id"].(string))
+	}
+	return ids
+}
+
+func TestDeleteFullText(t *testing.T) {
+	backend, err := newEmbeddedBackend(t.TempDir())
+	assert.NoError(t, err)
+	lib := newLibrary(defaultLibraryID, defaultLibraryID, true, "books")
+	_, err = backend.EnsureIndex(lib.fullTextIndex(), fullTextIndexSettings)
+	assert.NoError(t, err)
+	_, err = backend.Upsert(lib.fullTextIndex(), []Chapter{
+		{ID: "1_0_0", BookID: 1},
+		{ID: "1_1_0", BookID: 1},
+		{ID: "2_0_0", BookID: 2},
+		{ID: "3_0_0", BookID: 3},
+	}, 10)
+	assert.NoError(t, err)
+
+	// 未启用全文索引时不删除
+	c := &Api{backend: backend, config: &Config{}}
+	tasks, err := c.deleteFullText(lib, []int64{1})
+	assert.NoError(t, err)
+	assert.Empty(t, tasks)
+
+	c.config.Search.FullText = true
+	_, err = c.deleteFullText(lib, []int64{1, 3, 4})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2_0_0"}, chapterIds(t, backend, lib.fullTextIndex()))
+}
+
+func TestIndexFullTextRebuild(t *testing.T) {
+	backend, err := newEmbeddedBackend(t.TempDir())
+	assert.NoError(t, err)
+	lib := newLibrary(defaultLibraryID, defaultLibraryID, true, "books")
+	c := &Api{backend: backend, config: &Config{Search: Search{FullText: true}}, jobs: newJobManager()}
+	assert.NoError(t, c.ensureLibraryIndexes(lib))
+	_, err = backend.Upsert(lib.fullTextIndex(), []Chapter{{ID: "1_0_0", BookID: 1}}, 10)
+	assert.NoError(t, err)
+	_, err = backend.Upsert(lib.fullTextStagingIndex(), []Chapter{{ID: "9_0_0", BookID: 9}}, 10)
+	assert.NoError(t, err)
+
+	// 全量重建写入暂存索引后交换，旧的全文索引保留在暂存索引中，重建期间不会被清空
+	job, err := c.jobs.start(IndexJobModeFullText, lib.id)
+	assert.NoError(t, err)
+	assert.NoError(t, c.indexFullText(job, lib, nil))
+	assert.Empty(t, chapterIds(t, backend, lib.fullTextIndex()))
+	assert.Equal(t, []string{"1_0_0"}, chapterIds(t, backend, lib.fullTextStagingIndex()))
+}
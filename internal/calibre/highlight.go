@@ -0,0 +1,170 @@
+package calibre
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	highlightPreTag  = "<em>"
+	highlightPostTag = "</em>"
+	cropMarker       = "…"
+	// defaultCropLength 与 Meilisearch 默认的 cropLength 一致
+	defaultCropLength = 10
+)
+
+// withFormatted 按 Meilisearch 的格式为命中结果生成 _formatted 字段，
+// 其中高亮字段用 <em> 标记匹配的词项，裁剪字段只保留第一个匹配附近的内容。
+// 裁剪长度按字符近似计算：一个中文字符或约两个西文字符计为一个词。
+func withFormatted(hit, doc map[string]interface{}, query *SearchQuery) map[string]interface{} {
+	terms := tokenize(query.Query, false)
+	cropLength := int(query.CropLength)
+	if cropLength <= 0 {
+		cropLength = defaultCropLength
+	}
+	formatted := make(map[string]interface{}, len(hit))
+	for field, v := range hit {
+		formatted[field] = v
+	}
+	fields := append(append([]string(nil), query.AttributesToHighlight...), query.AttributesToCrop...)
+	for _, field := range fields {
+		text, ok := doc[field].(string)
+		if !ok {
+			continue
+		}
+		highlight := slices.Contains(query.AttributesToHighlight, field) || slices.Contains(query.AttributesToHighlight, "*")
+		crop := slices.Contains(query.AttributesToCrop, field) || slices.Contains(query.AttributesToCrop, "*")
+		formatted[field] = formatText(text, terms, highlight, crop, cropLength)
+	}
+	out := make(map[string]interface{}, len(hit)+1)
+	for field, v := range hit {
+		out[field] = v
+	}
+	out["_formatted"] = formatted
+	return out
+}
+
+type matchSpan struct {
+	start, end int
+}
+
+// matchSpans 返回文本中所有查询词项出现的位置（按字符计），重叠的位置会合并
+func matchSpans(text []rune, terms []string) []matchSpan {
+	lower := make([]rune, len(text))
+	for i, r := range text {
+		lower[i] = unicode.ToLower(r)
+	}
+	var spans []matchSpan
+	for _, term := range terms {
+		t := []rune(term)
+		if len(t) == 0 {
+			continue
+		}
+		for i := 0; i+len(t) <= len(lower); i++ {
+			if slices.Equal(lower[i:i+len(t)], t) {
+				spans = append(spans, matchSpan{i, i + len(t)})
+			}
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	var merged []matchSpan
+	for _, span := range spans {
+		if n := len(merged); n > 0 && span.start <= merged[n-1].end {
+			merged[n-1].end = max(merged[n-1].end, span.end)
+			continue
+		}
+		merged = append(merged, span)
+	}
+	return merged
+}
+
+func formatText(text string, terms []string, highlight, crop bool, cropLength int) string {
+	runes := []rune(text)
+	spans := matchSpans(runes, terms)
+	start, end := 0, len(runes)
+	if crop {
+		width := cropLength * 2
+		if len(spans) > 0 {
+			start = max(spans[0].start-width/2, 0)
+		}
+		end = min(start+width, len(runes))
+		start = max(end-width, 0)
+	}
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString(cropMarker)
+	}
+	pos := start
+	if highlight {
+		for _, span := range spans {
+			if span.end <= start || span.start >= end {
+				continue
+			}
+			s, e := max(span.start, start), min(span.end, end)
+			b.WriteString(string(runes[pos:s]))
+			b.WriteString(highlightPreTag)
+			b.WriteString(string(runes[s:e]))
+			b.WriteString(highlightPostTag)
+			pos = e
+		}
+	}
+	b.WriteString(string(runes[pos:end]))
+	if end < len(runes) {
+		b.WriteString(cropMarker)
+	}
+	return b.String()
+}
+
+// rankingScore 将内置后端的匹配得分换算为 0-1 的 _rankingScore：每个查询词项命中第一个可搜索字段时得满分。
+// 没有查询词项时与 Meilisearch 一致返回 1。
+func rankingScore(score, terms, fields int) float64 {
+	if terms == 0 || fields == 0 {
+		return 1
+	}
+	return min(float64(score)/float64(terms*fields), 1)
+}
+
+// matchesPosition 按 Meilisearch 的 _matchesPosition 格式返回查询词项在可搜索字段中的位置，
+// start 和 length 按 UTF-8 字节计算，数组字段用 indices 标明元素下标
+func matchesPosition(doc map[string]interface{}, fields []string, terms []string) map[string][]interface{} {
+	positions := map[string][]interface{}{}
+	for _, field := range fields {
+		switch v := doc[field].(type) {
+		case string:
+			for _, span := range byteSpans(v, terms) {
+				positions[field] = append(positions[field], map[string]interface{}{"start": span.start, "length": span.end - span.start})
+			}
+		case []interface{}:
+			for i, item := range v {
+				text, ok := item.(string)
+				if !ok {
+					continue
+				}
+				for _, span := range byteSpans(text, terms) {
+					positions[field] = append(positions[field], map[string]interface{}{"start": span.start, "length": span.end - span.start, "indices": []int{i}})
+				}
+			}
+		}
+	}
+	return positions
+}
+
+// byteSpans 将 matchSpans 返回的字符位置转换为字节位置
+func byteSpans(text string, terms []string) []matchSpan {
+	runes := []rune(text)
+	spans := matchSpans(runes, terms)
+	if len(spans) == 0 {
+		return nil
+	}
+	offsets := make([]int, len(runes)+1)
+	for i, r := range runes {
+		offsets[i+1] = offsets[i] + utf8.RuneLen(r)
+	}
+	for i, span := range spans {
+		spans[i] = matchSpan{offsets[span.start], offsets[span.end]}
+	}
+	return spans
+}
@@ -0,0 +1,205 @@
+package calibre
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jianyun8023/calibre-api/pkg/content"
+	"github.com/jianyun8023/calibre-api/pkg/log"
+)
+
+// IndexJobMode 索引任务类型
+type IndexJobMode string
+
+const (
+	IndexJobModeFull        IndexJobMode = "full"        // 全量重建
+	IndexJobModeIncremental IndexJobMode = "incremental" // 增量同步
+	IndexJobModeFullText    IndexJobMode = "fulltext"    // 建立全文索引
+	IndexJobModeSwap        IndexJobMode = "swap"        // 交换服务索引和暂存索引
+	IndexJobModeImport      IndexJobMode = "import"      // 从快照文件导入
+)
+
+// IndexJobPhase 索引任务阶段
+type IndexJobPhase string
+
+const (
+	IndexJobPhasePending   IndexJobPhase = "pending"   // 等待执行
+	IndexJobPhaseFetching  IndexJobPhase = "fetching"  // 从 calibre 拉取书籍
+	IndexJobPhaseIndexing  IndexJobPhase = "indexing"  // 等待 Meilisearch 任务完成
+	IndexJobPhaseSucceeded IndexJobPhase = "succeeded" // 执行成功
+	IndexJobPhaseFailed    IndexJobPhase = "failed"    // 执行失败
+)
+
+var errJobRunning = errors.New("有任务正在执行，请稍后再试")
+
+// maxFinishedJobs 保留的已结束任务数量，更早的任务不能再查询进度
+const maxFinishedJobs = 20
+
+// IndexJob 索引任务的进度快照
+type IndexJob struct {
+	ID              string           `json:"id"`
+	Mode            IndexJobMode     `json:"mode"`
+	Library         string           `json:"library"`
+	Phase           IndexJobPhase    `json:"phase"`
+	BooksTotal      int              `json:"books_total"`
+	BooksFetched    int              `json:"books_fetched"`
+	BooksDeleted    int              `json:"books_deleted"`
+	BatchesEnqueued int              `json:"batches_enqueued"`
+	Tasks           map[int64]string `json:"tasks"`
+	Errors          []string         `json:"errors,omitempty"`
+	StartedAt       time.Time        `json:"started_at"`
+	FinishedAt      time.Time        `json:"finished_at,omitempty"`
+}
+
+type indexJob struct {
+	mu  sync.Mutex
+	job IndexJob
+}
+
+func (j *indexJob) update(fn func(job *IndexJob)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	fn(&j.job)
+}
+
+func (j *indexJob) setPhase(phase IndexJobPhase) {
+	j.update(func(job *IndexJob) {
+		job.Phase = phase
+	})
+}
+
+func (j *indexJob) addTasks(taskIds ...int64) {
+	j.update(func(job *IndexJob) {
+		for _, id := range taskIds {
+			job.Tasks[id] = TaskStatusEnqueued
+		}
+	})
+}
+
+func (j *indexJob) setTaskStatus(taskId int64, status string) {
+	j.update(func(job *IndexJob) {
+		job.Tasks[taskId] = status
+	})
+}
+
+func (j *indexJob) finish(err error) {
+	j.update(func(job *IndexJob) {
+		job.FinishedAt = time.Now()
+		if err != nil {
+			job.Phase = IndexJobPhaseFailed
+			job.Errors = append(job.Errors, err.Error())
+			log.Warnf("index job %s failed: %v", job.ID, err)
+			return
+		}
+		job.Phase = IndexJobPhaseSucceeded
+		log.Infof("index job %s succeeded", job.ID)
+	})
+}
+
+// addDecodeErrors 将 calibre 响应中无法解析的记录写入任务错误并返回 nil，任务继续执行；其他错误原样返回
+func (j *indexJob) addDecodeErrors(err error) error {
+	var decodeErr *content.DecodeError
+	if !errors.As(err, &decodeErr) {
+		return err
+	}
+	log.Warnf("%v", decodeErr)
+	j.update(func(job *IndexJob) {
+		for _, record := range decodeErr.Records {
+			job.Errors = append(job.Errors, record.Error())
+		}
+	})
+	return nil
+}
+
+func (j *indexJob) done() bool {
+	return !j.finishedAt().IsZero()
+}
+
+func (j *indexJob) finishedAt() time.Time {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.job.FinishedAt
+}
+
+// snapshot 返回任务当前状态的副本，可以安全地序列化
+func (j *indexJob) snapshot() IndexJob {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	s := j.job
+	s.Tasks = make(map[int64]string, len(j.job.Tasks))
+	for id, status := range j.job.Tasks {
+		s.Tasks[id] = status
+	}
+	s.Errors = append([]string(nil), j.job.Errors...)
+	return s
+}
+
+// jobManager 管理后台索引任务，同一时间只允许一个任务运行
+type jobManager struct {
+	mu      sync.Mutex
+	jobs    map[string]*indexJob
+	current *indexJob
+}
+
+func newJobManager() *jobManager {
+	return &jobManager{
+		jobs: map[string]*indexJob{},
+	}
+}
+
+func (m *jobManager) start(mode IndexJobMode, library string) (*indexJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.current != nil && !m.current.done() {
+		return nil, errJobRunning
+	}
+	job := &indexJob{
+		job: IndexJob{
+			ID:        strconv.FormatInt(time.Now().UnixNano(), 36),
+			Mode:      mode,
+			Library:   library,
+			Phase:     IndexJobPhasePending,
+			Tasks:     map[int64]string{},
+			StartedAt: time.Now(),
+		},
+	}
+	m.prune()
+	m.jobs[job.job.ID] = job
+	m.current = job
+	return job, nil
+}
+
+// prune 只保留最近 maxFinishedJobs 个已结束的任务，调用方需持有锁
+func (m *jobManager) prune() {
+	var finished []*indexJob
+	for _, job := range m.jobs {
+		if job.done() {
+			finished = append(finished, job)
+		}
+	}
+	if len(finished) <= maxFinishedJobs {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].finishedAt().Before(finished[j].finishedAt())
+	})
+	for _, job := range finished[:len(finished)-maxFinishedJobs] {
+		delete(m.jobs, job.job.ID)
+	}
+}
+
+func (m *jobManager) get(id string) (*indexJob, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	return job, ok
+}
+
+func (m *jobManager) running() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.current != nil && !m.current.done()
+}
@@ -0,0 +1,111 @@
+package calibre
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobManagerLifecycle(t *testing.T) {
+	m := newJobManager()
+	job, err := m.start(IndexJobModeFull, "library")
+	assert.NoError(t, err)
+	assert.True(t, m.running())
+	assert.Equal(t, IndexJobPhasePending, job.snapshot().Phase)
+
+	_, err = m.start(IndexJobModeIncremental, "library")
+	assert.ErrorIs(t, err, errJobRunning)
+
+	job.addTasks(1, 2)
+	job.setTaskStatus(1, TaskStatusSucceeded)
+	snapshot := job.snapshot()
+	assert.Equal(t, map[int64]string{1: TaskStatusSucceeded, 2: TaskStatusEnqueued}, snapshot.Tasks)
+	// 快照是副本，修改快照不影响任务
+	snapshot.Tasks[2] = TaskStatusFailed
+	assert.Equal(t, TaskStatusEnqueued, job.snapshot().Tasks[2])
+
+	job.finish(errors.New("meilisearch tasks failed"))
+	assert.False(t, m.running())
+	snapshot = job.snapshot()
+	assert.Equal(t, IndexJobPhaseFailed, snapshot.Phase)
+	assert.Equal(t, []string{"meilisearch tasks failed"}, snapshot.Errors)
+	assert.False(t, snapshot.FinishedAt.IsZero())
+
+	next, err := m.start(IndexJobModeIncremental, "library")
+	assert.NoError(t, err)
+	next.finish(nil)
+	assert.Equal(t, IndexJobPhaseSucceeded, next.snapshot().Phase)
+
+	got, ok := m.get(job.snapshot().ID)
+	assert.True(t, ok)
+	assert.Same(t, job, got)
+}
+
+func TestJobManagerPrune(t *testing.T) {
+	m := newJobManager()
+	var ids []string
+	for i := 0; i < maxFinishedJobs+5; i++ {
+		job, err := m.start(IndexJobModeIncremental, "library")
+		assert.NoError(t, err)
+		job.finish(nil)
+		ids = append(ids, job.snapshot().ID)
+	}
+	running, err := m.start(IndexJobModeFull, "library")
+	assert.NoError(t, err)
+
+	assert.LessOrEqual(t, len(m.jobs), maxFinishedJobs+1)
+	_, ok := m.get(ids[0])
+	assert.False(t, ok)
+	_, ok = m.get(ids[len(ids)-1])
+	assert.True(t, ok)
+	_, ok = m.get(running.snapshot().ID)
+	assert.True(t, ok)
+}
+
+// taskBackend 返回固定任务状态的后端，用于测试等待任务
+type taskBackend struct {
+	SearchBackend
+	tasks []BackendTask
+}
+
+func (b *taskBackend) Tasks(taskIds []int64) ([]BackendTask, error) {
+	return b.tasks, nil
+}
+
+func TestWaitForTasks(t *testing.T) {
+	interval := taskPollInterval
+	taskPollInterval = time.Millisecond
+	defer func() { taskPollInterval = interval }()
+
+	tests := []struct {
+		name    string
+		tasks   []BackendTask
+		wantErr string
+	}{
+		{"全部成功", []BackendTask{{UID: 1, Status: TaskStatusSucceeded}, {UID: 2, Status: TaskStatusSucceeded}}, ""},
+		{"任务失败", []BackendTask{{UID: 1, Status: TaskStatusSucceeded}, {UID: 2, Status: TaskStatusFailed, Error: "bad document"}}, "bad document"},
+		{"任务不存在", []BackendTask{{UID: 1, Status: TaskStatusSucceeded}}, "task 2 not found"},
+		{"任务一直未结束", []BackendTask{{UID: 1, Status: TaskStatusSucceeded}, {UID: 2, Status: TaskStatusProcessing}}, "not finished"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Api{backend: &taskBackend{tasks: tt.tasks}}
+			job := &indexJob{job: IndexJob{Tasks: map[int64]string{}}}
+			// 截止时间已经过去，未结束的任务在第一次查询后就返回超时
+			err := c.waitForTasksUntil(job, []int64{1, 2}, time.Now())
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+			// 查不到的任务记录为失败，其他任务记录后端返回的状态
+			want := TaskStatusFailed
+			if len(tt.tasks) == 2 {
+				want = tt.tasks[1].Status
+			}
+			assert.Equal(t, want, job.snapshot().Tasks[2])
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package calibre
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/jianyun8023/calibre-api/pkg/log"
+)
+
+const indexStateFile = "index_state.json"
+
+// IndexState 单个索引的同步状态。状态按物理索引记录，交换索引时随数据一起交换，
+// 回滚到上一次构建后增量同步从那次构建的水位继续
+type IndexState struct {
+	// LastSync 最近一次成功同步的时间
+	LastSync time.Time `json:"last_sync"`
+	// Watermark 已同步书籍中最大的 last_modified，增量同步从这里开始
+	Watermark time.Time `json:"watermark"`
+	// LastBuild 最近一次全量重建完成的时间
+	LastBuild time.Time `json:"last_build,omitempty"`
+}
+
+// IndexStatus 书库的索引状态
+type IndexStatus struct {
+	Library   string       `json:"library"`
+	Active    string       `json:"active"`
+	Staging   string       `json:"staging"`
+	Indexes   []IndexStats `json:"indexes"`
+	LastSync  time.Time    `json:"last_sync"`
+	LastBuild time.Time    `json:"last_build"`
+	Watermark time.Time    `json:"watermark"`
+	// Indexing 是否有索引任务或后端任务正在执行
+	Indexing bool `json:"indexing"`
+}
+
+// IndexStats 单个索引的文档数量
+type IndexStats struct {
+	Name      string    `json:"name"`
+	Documents int64     `json:"documents"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Active    bool      `json:"active"`
+}
+
+// stateStore 将索引状态持久化到 TmpDir 下的 JSON 文件，重启后仍然有效
+type stateStore struct {
+	mu      sync.Mutex
+	path    string
+	Indexes map[string]IndexState `json:"indexes"`
+}
+
+func loadStateStore(dir string) *stateStore {
+	s := &stateStore{
+		path:    path.Join(dir, indexStateFile),
+		Indexes: map[string]IndexState{},
+	}
+	b, err := os.ReadFile(s.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("read index state %s: %v", s.path, err)
+		}
+		return s
+	}
+	if err := json.Unmarshal(b, s); err != nil {
+		log.Warnf("decode index state %s: %v", s.path, err)
+	}
+	if s.Indexes == nil {
+		s.Indexes = map[string]IndexState{}
+	}
+	return s
+}
+
+func (s *stateStore) get(index string) IndexState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Indexes[index]
+}
+
+// update 修改指定索引的状态并立即写回磁盘
+func (s *stateStore) update(index string, fn func(state *IndexState)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := s.Indexes[index]
+	fn(&state)
+	s.Indexes[index] = state
+	return s.save()
+}
+
+// swap 交换两个索引的状态并立即写回磁盘，与后端交换索引保持一致
+func (s *stateStore) swap(a, b string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stateA, okA := s.Indexes[a]
+	stateB, okB := s.Indexes[b]
+	delete(s.Indexes, a)
+	delete(s.Indexes, b)
+	if okB {
+		s.Indexes[a] = stateB
+	}
+	if okA {
+		s.Indexes[b] = stateA
+	}
+	return s.save()
+}
+
+// save 把全部状态写回磁盘，调用方需持有 mu
+func (s *stateStore) save() error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,41 @@
+package calibre
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSwapIndexes(t *testing.T) {
+	backend, err := newEmbeddedBackend(t.TempDir())
+	assert.NoError(t, err)
+	dir := t.TempDir()
+	c := &Api{backend: backend, state: loadStateStore(dir)}
+	lib := newLibrary("library", "library", true, "books")
+	_, err = backend.Upsert(lib.currentIndex(), []Book{{ID: 1, Title: "旧数据"}}, 10)
+	assert.NoError(t, err)
+	_, err = backend.Upsert(lib.stagingIndex(), []Book{{ID: 2, Title: "新数据"}}, 10)
+	assert.NoError(t, err)
+
+	old := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, c.state.update(lib.currentIndex(), func(s *IndexState) { s.Watermark = old }))
+
+	assert.NoError(t, c.swapIndexes(nil, lib))
+	assert.Equal(t, []int64{2}, searchIds(t, backend, &SearchQuery{}))
+	var book Book
+	assert.NoError(t, backend.GetDocument(lib.stagingIndex(), "1", &book))
+	assert.Equal(t, "books", lib.currentIndex())
+	// 同步状态跟随数据交换
+	assert.True(t, c.state.get(lib.currentIndex()).Watermark.IsZero())
+	assert.Equal(t, old, c.state.get(lib.stagingIndex()).Watermark)
+
+	// 新构建记录水位后回滚，服务索引恢复旧构建的水位，并且重启后仍然有效
+	newer := old.AddDate(0, 1, 0)
+	assert.NoError(t, c.state.update(lib.currentIndex(), func(s *IndexState) { s.Watermark = newer }))
+	assert.NoError(t, c.swapIndexes(nil, lib))
+	assert.Equal(t, []int64{1}, searchIds(t, backend, &SearchQuery{}))
+	restarted := loadStateStore(dir)
+	assert.Equal(t, old, restarted.get(lib.currentIndex()).Watermark)
+	assert.Equal(t, newer, restarted.get(lib.stagingIndex()).Watermark)
+}
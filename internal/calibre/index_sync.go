@@ -0,0 +1,150 @@
+package calibre
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jianyun8023/calibre-api/pkg/log"
+	"github.com/spf13/cast"
+)
+
+// syncIndex 增量同步当前使用的索引：只向 calibre 请求 watermark 之后修改过的书籍并写入索引，
+// 再删除 calibre 中已经不存在的书籍，这些书籍的全文索引章节一并删除。
+func (c *Api) syncIndex(job *indexJob, lib *library, state IndexState) error {
+	index := lib.currentIndex()
+
+	job.setPhase(IndexJobPhaseFetching)
+	data, err := c.contentApi.GetBookMetaDatasSince(state.Watermark, lib.id, c.customColumns(lib)...)
+	if err := job.addDecodeErrors(err); err != nil {
+		return fmt.Errorf("get changed books error: %w", err)
+	}
+	books, err := convertContentBooks(data, lib)
+	if err != nil {
+		return err
+	}
+	// calibre 只能按天过滤，结果包含水位当天已经同步过的书籍，按精确时间跳过它们
+	books = modifiedAfter(books, state.Watermark)
+	log.Infof("sync index %s: %d books changed since %s", index, len(books), state.Watermark.Format(time.RFC3339))
+	job.update(func(j *IndexJob) {
+		j.BooksTotal = len(books)
+	})
+
+	var taskIds []int64
+	for i := 0; i < len(books); i += indexBatchSize {
+		batch := books[i:min(i+indexBatchSize, len(books))]
+		tasks, err := c.upsertBatch(job, index, batch, len(batch))
+		if err != nil {
+			return err
+		}
+		taskIds = append(taskIds, tasks...)
+	}
+
+	booksIds, err := c.contentApi.GetAllBooksIds(lib.id)
+	if err != nil {
+		return err
+	}
+	indexedIds, err := c.indexedBookIds(index)
+	if err != nil {
+		return err
+	}
+	stale := staleBookIds(indexedIds, booksIds)
+	if len(stale) > 0 {
+		log.Infof("sync index %s: delete %d books", index, len(stale))
+		tasks, err := c.backend.Delete(index, stale)
+		if err != nil {
+			return err
+		}
+		taskIds = append(taskIds, tasks...)
+		job.addTasks(tasks...)
+	}
+	job.update(func(j *IndexJob) {
+		j.BooksDeleted = len(stale)
+	})
+
+	// 修改过和已删除书籍的章节都已过期，需要重新建立全文索引的书籍通过 /api/index/fulltext 指定
+	changed := make([]int64, 0, len(books)+len(stale))
+	for _, book := range books {
+		changed = append(changed, book.ID)
+	}
+	for _, id := range stale {
+		changed = append(changed, cast.ToInt64(id))
+	}
+	tasks, err := c.deleteFullText(lib, changed)
+	if err != nil {
+		return err
+	}
+	taskIds = append(taskIds, tasks...)
+	job.addTasks(tasks...)
+
+	if err := c.waitForTasks(job, taskIds); err != nil {
+		return err
+	}
+
+	err = c.state.update(lib.index, func(s *IndexState) {
+		s.LastSync = time.Now()
+		s.Watermark = maxLastModified(books, state.Watermark)
+	})
+	if err != nil {
+		log.Warnf("save index state error: %v", err)
+	}
+	return nil
+}
+
+// indexedBookIds 分页读取索引中全部文档的 id
+func (c *Api) indexedBookIds(index string) ([]int64, error) {
+	const pageSize = 10000
+	var ids []int64
+	for offset := int64(0); ; offset += pageSize {
+		docs, err := c.backend.Documents(index, offset, pageSize, []string{"id"})
+		if err != nil {
+			return nil, err
+		}
+		for _, doc := range docs {
+			ids = append(ids, cast.ToInt64(doc["id"]))
+		}
+		if int64(len(docs)) < pageSize {
+			return ids, nil
+		}
+	}
+}
+
+// staleBookIds 返回存在于索引中、但 calibre 中已经删除的书籍 id
+func staleBookIds(indexed []int64, current []int64) []string {
+	exists := make(map[int64]struct{}, len(current))
+	for _, id := range current {
+		exists[id] = struct{}{}
+	}
+	var stale []string
+	for _, id := range indexed {
+		if _, ok := exists[id]; !ok {
+			stale = append(stale, strconv.FormatInt(id, 10))
+		}
+	}
+	return stale
+}
+
+// modifiedAfter 返回 last_modified 晚于 since 的书籍，since 为零值时返回全部书籍
+func modifiedAfter(books []Book, since time.Time) []Book {
+	if since.IsZero() {
+		return books
+	}
+	changed := make([]Book, 0, len(books))
+	for _, book := range books {
+		if book.LastModified.After(since) {
+			changed = append(changed, book)
+		}
+	}
+	return changed
+}
+
+// maxLastModified 返回 books 中最大的 last_modified，不小于 since
+func maxLastModified(books []Book, since time.Time) time.Time {
+	watermark := since
+	for _, book := range books {
+		if book.LastModified.After(watermark) {
+			watermark = book.LastModified
+		}
+	}
+	return watermark
+}
@@ -0,0 +1,183 @@
+package calibre
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jianyun8023/calibre-api/pkg/client"
+	"github.com/jianyun8023/calibre-api/pkg/content"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStaleBookIds(t *testing.T) {
+	tests := []struct {
+		name    string
+		indexed []int64
+		current []int64
+		want    []string
+	}{
+		{"没有删除", []int64{1, 2, 3}, []int64{1, 2, 3}, nil},
+		{"删除部分书籍", []int64{1, 2, 3, 4}, []int64{1, 3}, []string{"2", "4"}},
+		{"calibre 新增书籍", []int64{1}, []int64{1, 2}, nil},
+		{"空书库", []int64{1, 2}, nil, []string{"1", "2"}},
+		{"空索引", nil, []int64{1, 2}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, staleBookIds(tt.indexed, tt.current))
+		})
+	}
+}
+
+func TestMaxLastModified(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2024, 5, d, 0, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name  string
+		books []Book
+		since time.Time
+		want  time.Time
+	}{
+		{"首次同步", []Book{{LastModified: day(3)}, {LastModified: day(1)}}, time.Time{}, day(3)},
+		{"推进水位", []Book{{LastModified: day(5)}}, day(3), day(5)},
+		{"书籍早于水位", []Book{{LastModified: day(2)}}, day(3), day(3)},
+		{"与水位相同", []Book{{LastModified: day(3)}}, day(3), day(3)},
+		{"没有书籍", nil, day(3), day(3)},
+		{"首次同步且没有书籍", nil, time.Time{}, time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, maxLastModified(tt.books, tt.since))
+		})
+	}
+}
+
+// syncCalibre 模拟 calibre 的 cmd/list 和 ajax/search 接口，cmd/list 按 last_modified:>=日期 过滤书籍
+func syncCalibre(t *testing.T, books map[int64]time.Time) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/cdb/cmd/list/0":
+			var body []interface{}
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			query, _ := body[3].(string)
+			since, _ := time.Parse("2006-01-02", strings.TrimPrefix(query, "last_modified:>="))
+			ids := []int64{}
+			titles := map[string]string{}
+			modified := map[string]interface{}{}
+			for id, lastModified := range books {
+				if lastModified.Before(since) {
+					continue
+				}
+				key := strconv.FormatInt(id, 10)
+				ids = append(ids, id)
+				titles[key] = "书籍 " + key
+				modified[key] = map[string]string{"t": "datetime", "v": lastModified.Format(time.RFC3339)}
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"result": map[string]interface{}{
+					"book_ids": ids,
+					"data":     map[string]interface{}{"title": titles, "last_modified": modified},
+				},
+			})
+		case r.URL.Path == "/ajax/search/library":
+			ids := []int64{}
+			for id := range books {
+				ids = append(ids, id)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"total_num": len(ids), "book_ids": ids})
+		case r.URL.Path == "/ajax/field-metadata/library":
+			w.Write([]byte(`{}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestSyncIndex(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2024, 5, d, 12, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name        string
+		calibre     map[int64]time.Time
+		indexed     []int64
+		watermark   time.Time
+		wantIds     []int64
+		wantFetched int
+		wantDeleted int
+		want        time.Time
+	}{
+		{
+			name:        "首次同步",
+			calibre:     map[int64]time.Time{1: day(1), 2: day(3)},
+			wantIds:     []int64{1, 2},
+			wantFetched: 2,
+			want:        day(3),
+		},
+		{
+			name:        "只同步水位之后的修改并删除书籍",
+			calibre:     map[int64]time.Time{1: day(1), 2: day(5)},
+			indexed:     []int64{1, 3},
+			watermark:   day(3),
+			wantIds:     []int64{1, 2},
+			wantFetched: 1,
+			wantDeleted: 1,
+			want:        day(5),
+		},
+		{
+			name:        "跳过水位当天已经同步的修改",
+			calibre:     map[int64]time.Time{1: day(3).Add(-time.Hour), 2: day(3), 3: day(3).Add(time.Hour)},
+			indexed:     []int64{1, 2},
+			watermark:   day(3),
+			wantIds:     []int64{1, 2, 3},
+			wantFetched: 1,
+			want:        day(3).Add(time.Hour),
+		},
+		{
+			name:        "空书库",
+			calibre:     map[int64]time.Time{},
+			indexed:     []int64{1, 2},
+			watermark:   day(3),
+			wantIds:     []int64{},
+			wantDeleted: 2,
+			want:        day(3),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := syncCalibre(t, tt.calibre)
+			defer server.Close()
+			contentApi, err := content.NewClient(server.URL, client.Auth{})
+			assert.NoError(t, err)
+			contentApi.SetRetryCount(0)
+
+			backend, err := newEmbeddedBackend(t.TempDir())
+			assert.NoError(t, err)
+			var indexed []Book
+			for _, id := range tt.indexed {
+				indexed = append(indexed, Book{ID: id, Title: "旧数据"})
+			}
+			_, err = backend.Upsert("books", indexed, 10)
+			assert.NoError(t, err)
+
+			lib := newLibrary(defaultLibraryID, defaultLibraryID, true, "books")
+			c := &Api{backend: backend, contentApi: &contentApi, state: loadStateStore(t.TempDir()), jobs: newJobManager()}
+			job, err := c.jobs.start(IndexJobModeIncremental, lib.id)
+			assert.NoError(t, err)
+
+			assert.NoError(t, c.syncIndex(job, lib, IndexState{Watermark: tt.watermark}))
+			assert.ElementsMatch(t, tt.wantIds, searchIds(t, backend, &SearchQuery{}))
+			snapshot := job.snapshot()
+			assert.Equal(t, tt.wantFetched, snapshot.BooksFetched)
+			assert.Equal(t, tt.wantDeleted, snapshot.BooksDeleted)
+			assert.True(t, tt.want.Equal(c.state.get(lib.index).Watermark))
+		})
+	}
+}
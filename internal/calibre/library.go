@@ -0,0 +1,268 @@
+package calibre
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jianyun8023/calibre-api/pkg/content"
+	"github.com/jianyun8023/calibre-api/pkg/log"
+)
+
+// libraryContextKey gin.Context 中保存当前书库的键
+const libraryContextKey = "library"
+
+// defaultLibraryID calibre 服务器不可用时使用的书库 ID，与之前固定使用的书库一致
+const defaultLibraryID = "library"
+
+var invalidIndexChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// library calibre 书库及其索引。默认书库沿用配置中的索引名称，其他书库使用 index-<书库ID>。
+// 对外提供服务的始终是 index，全量重建写入 index-bak 暂存索引，完成后通过交换索引上线，
+// 因此索引名称在书库的生命周期内不会改变，可以在并发请求中直接读取。
+type library struct {
+	id      string
+	name    string
+	primary bool // 是否为默认书库
+	index   string
+	// fallback 为 true 表示书库发现失败时临时注册的默认书库
+	fallback bool
+
+	// suggest 联想索引，索引任务完成后重新建立，切换索引和书籍增删改后清空
+	suggest   atomic.Pointer[suggestIndex]
+	suggestMu sync.Mutex
+	// columns 自定义列定义，首次使用时读取，全量重建索引时刷新
+	columns atomic.Pointer[[]content.CustomColumn]
+	// duplicates 查重结果，服务索引更新后失效
+	duplicates atomic.Pointer[duplicateCache]
+	// sampleIds 随机抽样使用的 id 列表，服务索引更新后失效
+	sampleIds atomic.Pointer[sampleIdCache]
+}
+
+// Library 书库信息
+type Library struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Default     bool   `json:"default"`
+	Index       string `json:"index"`
+	ActiveIndex string `json:"active_index"`
+}
+
+func newLibrary(id, name string, primary bool, baseIndex string) *library {
+	index := baseIndex
+	if !primary {
+		index = baseIndex + "-" + invalidIndexChars.ReplaceAllString(id, "_")
+	}
+	return &library{id: id, name: name, primary: primary, index: index}
+}
+
+// currentIndex 返回书库对外提供服务的索引名称
+func (l *library) currentIndex() string {
+	return l.index
+}
+
+// stagingIndex 返回暂存索引名称，全量重建写入暂存索引，交换后保存上一版本的数据
+func (l *library) stagingIndex() string {
+	return l.index + "-bak"
+}
+
+// fullTextIndex 返回书库的全文索引名称
+func (l *library) fullTextIndex() string {
+	return l.index + "-fulltext"
+}
+
+// fullTextStagingIndex 返回全文索引的暂存索引名称，全量重建全文索引时写入这里再交换
+func (l *library) fullTextStagingIndex() string {
+	return l.fullTextIndex() + "-bak"
+}
+
+// query 返回访问该书库时需要附加到链接上的查询参数，默认书库不需要
+func (l *library) query() string {
+	if l.primary {
+		return ""
+	}
+	return "?library=" + url.QueryEscape(l.id)
+}
+
+func (l *library) info() Library {
+	return Library{
+		ID:          l.id,
+		Name:        l.name,
+		Default:     l.primary,
+		Index:       l.index,
+		ActiveIndex: l.currentIndex(),
+	}
+}
+
+// swapIndexes 交换书库的服务索引和暂存索引，交换由后端原子完成，请求始终访问完整的索引
+func (c *Api) swapIndexes(job *indexJob, lib *library) error {
+	taskIds, err := c.backend.Swap(lib.currentIndex(), lib.stagingIndex())
+	if err != nil {
+		return err
+	}
+	if job != nil {
+		job.addTasks(taskIds...)
+	}
+	if err := c.waitForTasks(job, taskIds); err != nil {
+		return err
+	}
+	log.Infof("library %q: swapped index %q and %q", lib.id, lib.currentIndex(), lib.stagingIndex())
+	// 同步状态跟随数据交换，否则回滚后增量同步会从较新构建的水位开始，漏掉之后的修改
+	if err := c.state.swap(lib.currentIndex(), lib.stagingIndex()); err != nil {
+		log.Warnf("save index state error: %v", err)
+	}
+	return nil
+}
+
+// cacheDir 返回书库的文件缓存目录，默认书库直接使用 TmpDir
+func (c *Api) cacheDir(lib *library) string {
+	if lib.primary {
+		return c.baseDir
+	}
+	return filepath.Join(c.baseDir, "libraries", invalidIndexChars.ReplaceAllString(lib.id, "_"))
+}
+
+// ensureLibraryIndexes 确保书库的主备索引和全文索引存在
+func (c *Api) ensureLibraryIndexes(lib *library) error {
+	if err := c.applyIndexSettings(lib); err != nil {
+		return err
+	}
+	if c.config.Search.FullText {
+		return c.ensureIndexes(fullTextIndexSettings, lib.fullTextIndex(), lib.fullTextStagingIndex())
+	}
+	return nil
+}
+
+// loadLibraries 从 calibre 服务器发现书库并创建索引，已注册的书库保持不变。
+// 只在启动和调用刷新接口时执行；访问 calibre 和创建索引时不持有 libMu，
+// 完成后加锁替换整个书库列表，不会阻塞正在处理的请求。
+func (c *Api) loadLibraries() error {
+	c.loadMu.Lock()
+	defer c.loadMu.Unlock()
+	info, err := c.contentApi.GetLibraries()
+	if err != nil {
+		return err
+	}
+	if len(info.LibraryMap) == 0 {
+		return fmt.Errorf("calibre 服务器没有可用的书库")
+	}
+
+	libraries := make(map[string]*library, len(info.LibraryMap))
+	c.libMu.RLock()
+	for id, lib := range c.libraries {
+		if !lib.fallback {
+			libraries[id] = lib
+		}
+	}
+	c.libMu.RUnlock()
+	for id, name := range info.LibraryMap {
+		if _, ok := libraries[id]; ok {
+			continue
+		}
+		lib := newLibrary(id, name, id == info.DefaultLibrary, c.config.Search.Index)
+		if err := c.ensureLibraryIndexes(lib); err != nil {
+			return err
+		}
+		log.Infof("library %q uses index %q", id, lib.index)
+		libraries[id] = lib
+	}
+
+	c.libMu.Lock()
+	defer c.libMu.Unlock()
+	c.libraries = libraries
+	c.defaultLibrary = info.DefaultLibrary
+	return nil
+}
+
+// useFallbackLibrary 书库发现失败时注册默认书库，保证服务可用
+func (c *Api) useFallbackLibrary() error {
+	lib := newLibrary(defaultLibraryID, defaultLibraryID, true, c.config.Search.Index)
+	lib.fallback = true
+	if err := c.ensureLibraryIndexes(lib); err != nil {
+		return err
+	}
+	c.libMu.Lock()
+	defer c.libMu.Unlock()
+	c.libraries[lib.id] = lib
+	c.defaultLibrary = lib.id
+	return nil
+}
+
+// library 按 ID 查找已注册的书库，id 为空时返回默认书库。
+// 不会因为未知的 ID 访问 calibre，新增的书库需要调用刷新接口注册。
+func (c *Api) library(id string) (*library, error) {
+	if lib, ok := c.lookupLibrary(id); ok {
+		return lib, nil
+	}
+	return nil, fmt.Errorf("书库不存在: %s", id)
+}
+
+func (c *Api) lookupLibrary(id string) (*library, bool) {
+	c.libMu.RLock()
+	defer c.libMu.RUnlock()
+	if id == "" {
+		id = c.defaultLibrary
+	}
+	lib, ok := c.libraries[id]
+	return lib, ok
+}
+
+// defaultLib 返回默认书库，供没有请求上下文的调用方使用
+func (c *Api) defaultLib() *library {
+	lib, _ := c.lookupLibrary("")
+	return lib
+}
+
+// withLibrary 根据 library 查询参数选择书库，未指定时使用默认书库
+func (c *Api) withLibrary(r *gin.Context) {
+	lib, err := c.library(r.Query("library"))
+	if err != nil {
+		r.AbortWithStatusJSON(http.StatusNotFound, gin.H{"code": 404, "message": err.Error()})
+		return
+	}
+	r.Set(libraryContextKey, lib)
+	r.Next()
+}
+
+// lib 返回请求对应的书库
+func (c *Api) lib(r *gin.Context) *library {
+	if lib, ok := r.Get(libraryContextKey); ok {
+		return lib.(*library)
+	}
+	return c.defaultLib()
+}
+
+// listLibraries 书库列表接口，返回已注册的书库
+func (c *Api) listLibraries(r *gin.Context) {
+	c.libMu.RLock()
+	libraries := make([]Library, 0, len(c.libraries))
+	for _, lib := range c.libraries {
+		libraries = append(libraries, lib.info())
+	}
+	c.libMu.RUnlock()
+	sort.Slice(libraries, func(i, j int) bool {
+		if libraries[i].Default != libraries[j].Default {
+			return libraries[i].Default
+		}
+		return libraries[i].ID < libraries[j].ID
+	})
+	r.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": libraries,
+	})
+}
+
+// refreshLibraries 重新发现 calibre 服务器上的书库，为新增的书库创建索引，返回刷新后的书库列表
+func (c *Api) refreshLibraries(r *gin.Context) {
+	if err := c.loadLibraries(); err != nil {
+		r.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error()})
+		return
+	}
+	c.listLibraries(r)
+}
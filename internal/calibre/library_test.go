@@ -0,0 +1,123 @@
+package calibre
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jianyun8023/calibre-api/pkg/client"
+	"github.com/jianyun8023/calibre-api/pkg/content"
+	"github.com/stretchr/testify/assert"
+)
+
+// libraryCalibre 模拟 calibre 的 library-info 接口，记录请求次数
+type libraryCalibre struct {
+	mu       sync.Mutex
+	libs     map[string]string
+	requests atomic.Int32
+}
+
+func (s *libraryCalibre) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/ajax/library-info" {
+		http.NotFound(w, r)
+		return
+	}
+	s.requests.Add(1)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(content.LibraryInfo{LibraryMap: s.libs, DefaultLibrary: defaultLibraryID})
+}
+
+// blockingBackend EnsureIndex 阻塞到 release 关闭，用于检查创建索引时是否持有书库锁
+type blockingBackend struct {
+	SearchBackend
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (b *blockingBackend) EnsureIndex(index string, settings IndexSettings) ([]int64, error) {
+	b.once.Do(func() { close(b.started) })
+	<-b.release
+	return b.SearchBackend.EnsureIndex(index, settings)
+}
+
+func TestRefreshLibraries(t *testing.T) {
+	calibre := &libraryCalibre{libs: map[string]string{defaultLibraryID: "Library"}}
+	server := httptest.NewServer(calibre)
+	defer server.Close()
+	contentApi, err := content.NewClient(server.URL, client.Auth{})
+	assert.NoError(t, err)
+	contentApi.SetRetryCount(0)
+
+	c := &Api{
+		config:     &Config{Search: Search{Index: "books"}},
+		backend:    newTestEmbeddedBackend(t),
+		contentApi: &contentApi,
+		libraries:  map[string]*library{},
+	}
+	assert.NoError(t, c.loadLibraries())
+	primary, err := c.library("")
+	assert.NoError(t, err)
+	assert.Equal(t, "books", primary.index)
+
+	router := gin.New()
+	base := router.Group("/api")
+	base.GET("/libraries", c.listLibraries)
+	base.POST("/libraries/refresh", c.refreshLibraries)
+	base.Use(c.withLibrary)
+	base.GET("/search", func(r *gin.Context) { r.String(http.StatusOK, c.lib(r).id) })
+
+	// 未知书库直接返回 404，不访问 calibre
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/search?library=Books2", nil))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/libraries", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int32(1), calibre.requests.Load())
+
+	// 刷新时创建索引不持有书库锁，请求仍然可以查找书库
+	calibre.mu.Lock()
+	calibre.libs["Books2"] = "Books 2"
+	calibre.mu.Unlock()
+	backend := &blockingBackend{SearchBackend: c.backend, started: make(chan struct{}), release: make(chan struct{})}
+	c.backend = backend
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/libraries/refresh", nil))
+		done <- w
+	}()
+	select {
+	case <-backend.started:
+	case <-time.After(time.Second):
+		t.Fatal("refresh did not create indexes")
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/search", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, defaultLibraryID, w.Body.String())
+	close(backend.release)
+
+	w = <-done
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"books-Books2"`)
+	assert.Equal(t, int32(2), calibre.requests.Load())
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/search?library=Books2", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	// 已注册的书库保持不变
+	again, err := c.library("")
+	assert.NoError(t, err)
+	assert.Same(t, primary, again)
+}
@@ -2,9 +2,10 @@ package calibre
 
 import (
 	"fmt"
+	"math/rand"
 
 	"github.com/jianyun8023/calibre-api/pkg/log"
-	"github.com/meilisearch/meilisearch-go"
+	"github.com/spf13/cast"
 )
 
 // EnhancedTool 增强的工具定义
@@ -44,7 +45,7 @@ func (etm *EnhancedToolManager) GetEnhancedTools() []EnhancedTool {
 				"properties": map[string]interface{}{
 					"query": map[string]interface{}{
 						"type":        "string",
-						"description": "搜索关键词",
+						"description": "搜索关键词，支持字段条件，如：三体 author:刘慈欣 tag:科幻 year:2000..2010 rating>=4 -tag:漫画 sort:-rating",
 					},
 					"limit": map[string]interface{}{
 						"type":        "integer",
@@ -159,6 +160,19 @@ func (etm *EnhancedToolManager) GetEnhancedTools() []EnhancedTool {
 							"type": "string",
 						},
 					},
+					"language": map[string]interface{}{
+						"type":        "string",
+						"description": "语言过滤（用于随机推荐），如 zho、eng",
+					},
+					"seed": map[string]interface{}{
+						"type":        "integer",
+						"description": "随机种子（用于随机推荐），传入上次返回的 seed 和 offset 可以继续翻页",
+					},
+					"offset": map[string]interface{}{
+						"type":        "integer",
+						"description": "随机序列中的偏移量（用于随机推荐）",
+						"default":     0,
+					},
 				},
 				"required": []string{"type"},
 			},
@@ -300,20 +314,23 @@ func (etm *EnhancedToolManager) executeSearchBooksEnhanced(args map[string]inter
 	}
 
 	// 执行搜索
-	searchReq := meilisearch.SearchRequest{
+	searchReq := SearchQuery{
+		Query:  query,
 		Limit:  int64(limit),
 		Offset: int64(offset),
 	}
+	if err := applyQuery(&searchReq); err != nil {
+		return nil, err
+	}
 
-	search, err := etm.api.currentIndex().Search(query, &searchReq)
+	search, err := etm.api.backend.Search(etm.api.defaultLib().currentIndex(), &searchReq)
 	if err != nil {
 		return nil, err
 	}
 
 	// 处理结果
 	books := make([]map[string]interface{}, len(search.Hits))
-	for i, hit := range search.Hits {
-		bookData := hit.(map[string]interface{})
+	for i, bookData := range search.Hits {
 		books[i] = bookData
 
 		// 如果需要包含资源信息
@@ -329,11 +346,11 @@ func (etm *EnhancedToolManager) executeSearchBooksEnhanced(args map[string]inter
 
 	return map[string]interface{}{
 		"books":    books,
-		"total":    search.EstimatedTotalHits,
+		"total":    search.Total,
 		"query":    query,
 		"limit":    limit,
 		"offset":   offset,
-		"has_more": search.EstimatedTotalHits > int64(offset+limit),
+		"has_more": search.Total > int64(offset+limit),
 	}, nil
 }
 
@@ -430,7 +447,7 @@ func (etm *EnhancedToolManager) executeGetRecommendationsEnhanced(args map[strin
 	case "recent":
 		return etm.api.getRecentBooks(limit)
 	case "random":
-		return etm.api.getRandomBooks(limit)
+		return etm.api.getRandomBooks(args, limit)
 	case "similar":
 		if bookID, ok := args["book_id"]; ok {
 			return etm.findSimilarBooks(bookID.(string), limit)
@@ -545,37 +562,73 @@ func (etm *EnhancedToolManager) enrichBookMetadata(bookID string) (interface{},
 }
 
 func (etm *EnhancedToolManager) analyzeCollectionOverview() (interface{}, error) {
-	// 实现收藏概览分析
+	// 收藏概览：基于分面统计计算作者、出版社数量和平均评分
+	total, facets, err := etm.api.facetCounts(etm.api.defaultLib(), "", nil, []string{"authors", "publisher", "tags", "rating"}, 0)
+	if err != nil {
+		return nil, err
+	}
+	var rated, ratingSum float64
+	for _, fc := range facets["rating"] {
+		rating := cast.ToFloat64(fc.Value)
+		if rating <= 0 {
+			continue
+		}
+		rated += float64(fc.Count)
+		ratingSum += rating * float64(fc.Count)
+	}
+	avgRating := 0.0
+	if rated > 0 {
+		avgRating = ratingSum / rated
+	}
+	topGenres := make([]string, 0, 10)
+	for _, fc := range facets["tags"] {
+		if len(topGenres) == 10 {
+			break
+		}
+		topGenres = append(topGenres, fc.Value)
+	}
 	return map[string]interface{}{
-		"total_books":      0,
-		"total_authors":    0,
-		"total_publishers": 0,
-		"avg_rating":       0.0,
-		"top_genres":       []string{},
+		"total_books":      total,
+		"total_authors":    len(facets["authors"]),
+		"total_publishers": len(facets["publisher"]),
+		"avg_rating":       avgRating,
+		"top_genres":       topGenres,
 	}, nil
 }
 
 func (etm *EnhancedToolManager) analyzeAuthors(limit int) (interface{}, error) {
-	// 实现作者分析
+	// 作者分析：按书籍数量排序
+	_, facets, err := etm.api.facetCounts(etm.api.defaultLib(), "", nil, []string{"authors"}, limit)
+	if err != nil {
+		return nil, err
+	}
 	return map[string]interface{}{
-		"authors": []map[string]interface{}{},
-		"count":   limit,
+		"authors": facets["authors"],
+		"count":   len(facets["authors"]),
 	}, nil
 }
 
 func (etm *EnhancedToolManager) analyzePublishers(limit int) (interface{}, error) {
-	// 实现出版社分析
+	// 出版社分析：按书籍数量排序
+	_, facets, err := etm.api.facetCounts(etm.api.defaultLib(), "", nil, []string{"publisher"}, limit)
+	if err != nil {
+		return nil, err
+	}
 	return map[string]interface{}{
-		"publishers": []map[string]interface{}{},
-		"count":      limit,
+		"publishers": facets["publisher"],
+		"count":      len(facets["publisher"]),
 	}, nil
 }
 
 func (etm *EnhancedToolManager) analyzeTopics(limit int) (interface{}, error) {
-	// 实现主题分析
+	// 主题分析：按标签的书籍数量排序
+	_, facets, err := etm.api.facetCounts(etm.api.defaultLib(), "", nil, []string{"tags"}, limit)
+	if err != nil {
+		return nil, err
+	}
 	return map[string]interface{}{
-		"topics": []map[string]interface{}{},
-		"count":  limit,
+		"topics": facets["tags"],
+		"count":  len(facets["tags"]),
 	}, nil
 }
 
@@ -613,11 +666,25 @@ func (api *Api) getRecentBooks(limit int) (interface{}, error) {
 	}, nil
 }
 
-func (api *Api) getRandomBooks(limit int) (interface{}, error) {
-	// 实现随机书籍获取逻辑
+// getRandomBooks 在整个书库中随机抽样，可以按标签和语言过滤，相同的 seed 返回相同的结果
+func (api *Api) getRandomBooks(args map[string]interface{}, limit int) (interface{}, error) {
+	limit = min(max(limit, 1), maxRandomLimit)
+	seed := cast.ToInt64(args["seed"])
+	if seed == 0 {
+		seed = rand.Int63n(1<<53) + 1
+	}
+	query := SearchQuery{
+		Filter: mergeFilters(nil, randomFilters(cast.ToStringSlice(args["tags"]), cast.ToString(args["language"]))),
+	}
+	books, total, err := api.sampleBooks(api.defaultLib(), query, seed, cast.ToInt(args["offset"]), limit)
+	if err != nil {
+		return nil, err
+	}
 	return map[string]interface{}{
-		"random_books": []map[string]interface{}{},
-		"count":        limit,
+		"random_books": books,
+		"count":        len(books),
+		"total":        total,
+		"seed":         seed,
 	}, nil
 }
 
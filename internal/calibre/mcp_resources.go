@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"path/filepath"
 	"strings"
 	"time"
 )
@@ -90,18 +89,9 @@ func (rm *ResourceManager) ListResources(bookID string) ([]Resource, error) {
 
 	// 书籍文件资源
 	if book.FilePath != "" {
-		ext := strings.ToLower(filepath.Ext(book.FilePath))
-		var mimeType string
-		switch ext {
-		case ".epub":
-			mimeType = "application/epub+zip"
-		case ".pdf":
-			mimeType = "application/pdf"
-		case ".mobi":
-			mimeType = "application/x-mobipocket-ebook"
-		default:
-			mimeType = "application/octet-stream"
-		}
+		format := preferredFormat(book.Formats)
+		ext := "." + format
+		mimeType := formatMimeType(format)
 
 		resources = append(resources, Resource{
 			URI:         fmt.Sprintf("calibre://books/%s/file", bookID),
@@ -221,18 +211,9 @@ func (rm *ResourceManager) readFileResource(book *Book, bookID string) (*Resourc
 		return nil, fmt.Errorf("获取文件数据失败: %w", err)
 	}
 
-	ext := strings.ToLower(filepath.Ext(book.FilePath))
-	var mimeType string
-	switch ext {
-	case ".epub":
-		mimeType = "application/epub+zip"
-	case ".pdf":
-		mimeType = "application/pdf"
-	case ".mobi":
-		mimeType = "application/x-mobipocket-ebook"
-	default:
-		mimeType = "application/octet-stream"
-	}
+	format := preferredFormat(book.Formats)
+	ext := "." + format
+	mimeType := formatMimeType(format)
 
 	return &Resource{
 		URI:         fmt.Sprintf("calibre://books/%s/file", bookID),
@@ -251,7 +232,7 @@ func (rm *ResourceManager) readFileResource(book *Book, bookID string) (*Resourc
 // 辅助方法 - 获取书籍信息
 func (api *Api) getBookByID(id string) (*Book, error) {
 	var book Book
-	err := api.currentIndex().GetDocument(id, nil, &book)
+	err := api.backend.GetDocument(api.defaultLib().currentIndex(), id, &book)
 	if err != nil {
 		return nil, err
 	}
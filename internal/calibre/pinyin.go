@@ -0,0 +1,79 @@
+package calibre
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/jianyun8023/calibre-api/pkg/zhconv"
+	"github.com/mozillazg/go-pinyin"
+)
+
+// pinyinArgs 不带声调的拼音，多音字取最常用的读音
+var pinyinArgs = pinyin.NewArgs()
+
+// addSearchAliases 为中文书名和作者生成简体、拼音全拼和拼音首字母字段，
+// 使繁体或拼音输入也能搜索到书籍。不含汉字的字段不生成。
+func addSearchAliases(book *Book) {
+	title := zhconv.ToSimplified(book.Title)
+	if title != book.Title {
+		book.TitleSimplified = title
+	}
+	if joined, spaced, initials := toPinyin(title); joined != "" {
+		book.TitlePinyin = []string{joined, spaced}
+		book.TitleInitials = initials
+	}
+
+	book.AuthorsSimplified, book.AuthorsPinyin, book.AuthorsInitials = nil, nil, nil
+	for _, author := range book.Authors {
+		simplified := zhconv.ToSimplified(author)
+		if simplified != author {
+			book.AuthorsSimplified = append(book.AuthorsSimplified, simplified)
+		}
+		if joined, spaced, initials := toPinyin(simplified); joined != "" {
+			book.AuthorsPinyin = append(book.AuthorsPinyin, joined, spaced)
+			book.AuthorsInitials = append(book.AuthorsInitials, initials)
+		}
+	}
+}
+
+// normalizeQuery 把查询中的繁体字转换为简体，与索引中的简体字段匹配
+func normalizeQuery(q string) string {
+	return zhconv.ToSimplified(q)
+}
+
+// toPinyin 返回文本的连写全拼（三体2 -> santi2）、空格分隔的全拼（san ti 2）和首字母（st2）。
+// 字母和数字转为小写后原样保留，其他字符视为分隔符。文本不含汉字时返回空字符串。
+func toPinyin(text string) (joined, spaced, initials string) {
+	var words []string
+	var word []rune
+	var abbr strings.Builder
+	hasHan := false
+	flush := func() {
+		if len(word) > 0 {
+			w := strings.ToLower(string(word))
+			words = append(words, w)
+			abbr.WriteString(w)
+			word = word[:0]
+		}
+	}
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flush()
+			if py := pinyin.SinglePinyin(r, pinyinArgs); len(py) > 0 && py[0] != "" {
+				hasHan = true
+				words = append(words, py[0])
+				abbr.WriteString(py[0][:1])
+			}
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word = append(word, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	if !hasHan {
+		return "", "", ""
+	}
+	return strings.Join(words, ""), strings.Join(words, " "), abbr.String()
+}
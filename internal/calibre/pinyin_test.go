@@ -0,0 +1,64 @@
+package calibre
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToPinyin(t *testing.T) {
+	tests := []struct {
+		text     string
+		joined   string
+		spaced   string
+		initials string
+	}{
+		{text: "三体", joined: "santi", spaced: "san ti", initials: "st"},
+		{text: "三体2：黑暗森林", joined: "santi2heiansenlin", spaced: "san ti 2 hei an sen lin", initials: "st2hasl"},
+		{text: "刘慈欣", joined: "liucixin", spaced: "liu ci xin", initials: "lcx"},
+		{text: "The Three-Body Problem"},
+	}
+	for _, tt := range tests {
+		joined, spaced, initials := toPinyin(tt.text)
+		assert.Equal(t, tt.joined, joined, tt.text)
+		assert.Equal(t, tt.spaced, spaced, tt.text)
+		assert.Equal(t, tt.initials, initials, tt.text)
+	}
+}
+
+func TestSearchAliases(t *testing.T) {
+	books := []Book{
+		{ID: 1, Title: "三體", Authors: []string{"劉慈欣"}},
+		{ID: 2, Title: "活着", Authors: []string{"余华"}},
+		{ID: 3, Title: "The Three-Body Problem", Authors: []string{"Cixin Liu"}},
+	}
+	for i := range books {
+		addSearchAliases(&books[i])
+	}
+	assert.Equal(t, "三体", books[0].TitleSimplified)
+	assert.Equal(t, []string{"刘慈欣"}, books[0].AuthorsSimplified)
+	assert.Empty(t, books[1].TitleSimplified)
+	assert.Empty(t, books[2].TitlePinyin)
+
+	backend, err := newEmbeddedBackend(t.TempDir())
+	assert.NoError(t, err)
+	_, err = backend.EnsureIndex("books", IndexSettings{}.withDefaults())
+	assert.NoError(t, err)
+	_, err = backend.Upsert("books", books, 10)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		query string
+		want  []int64
+	}{
+		{query: normalizeQuery("三体"), want: []int64{1}},
+		{query: normalizeQuery("三體"), want: []int64{1}},
+		{query: "santi", want: []int64{1}},
+		{query: "st", want: []int64{1}},
+		{query: "liucixin", want: []int64{1}},
+		{query: "huozhe", want: []int64{2}},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, searchIds(t, backend, &SearchQuery{Query: tt.query}), tt.query)
+	}
+}
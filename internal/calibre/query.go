@@ -0,0 +1,304 @@
+package calibre
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jianyun8023/calibre-api/pkg/zhconv"
+)
+
+// queryField 查询语法中可以使用的字段
+type queryField struct {
+	attr    string
+	numeric bool
+}
+
+// queryFields 查询语法的字段名及别名，只有这里列出的字段会生成过滤条件
+var queryFields = map[string]queryField{
+	"author":    {attr: "authors"},
+	"authors":   {attr: "authors"},
+	"作者":        {attr: "authors"},
+	"tag":       {attr: "tags"},
+	"tags":      {attr: "tags"},
+	"标签":        {attr: "tags"},
+	"publisher": {attr: "publisher"},
+	"出版社":       {attr: "publisher"},
+	"series":    {attr: "series"},
+	"系列":        {attr: "series"},
+	"lang":      {attr: "languages"},
+	"language":  {attr: "languages"},
+	"语言":        {attr: "languages"},
+	"isbn":      {attr: "isbn"},
+	"id":        {attr: "id", numeric: true},
+	"rating":    {attr: "rating", numeric: true},
+	"评分":        {attr: "rating", numeric: true},
+	"year":      {attr: "pubyear", numeric: true},
+	"年份":        {attr: "pubyear", numeric: true},
+}
+
+// querySorts sort: 可以使用的排序字段，series 按系列名称和系列序号排序
+var querySorts = map[string][]string{
+	"id":        {"id"},
+	"rating":    {"rating"},
+	"year":      {"pubdate"},
+	"pubdate":   {"pubdate"},
+	"modified":  {"last_modified"},
+	"added":     {"timestamp"},
+	"author":    {"author_sort"},
+	"publisher": {"publisher"},
+	"series":    {"series", "series_index"},
+}
+
+// QuerySyntaxError 查询语法错误，接口返回 400
+type QuerySyntaxError struct {
+	Term    string
+	Message string
+}
+
+func (e *QuerySyntaxError) Error() string {
+	return fmt.Sprintf("查询语法错误 %q: %s", e.Term, e.Message)
+}
+
+// ParsedQuery 解析后的查询：关键词交给搜索引擎，字段条件转换为过滤表达式
+type ParsedQuery struct {
+	Text    string
+	Filters []string
+	Sort    []string
+}
+
+// parseQuery 解析查询语法，例如：
+//
+//	三体 author:刘慈欣 tag:科幻 year:2000..2010 rating>=4 -tag:漫画 sort:-rating
+//
+// 字段条件支持 field:value、field=value，数值字段还支持 >、>=、<、<= 和 a..b 范围，
+// 前缀 - 表示排除，值中有空格时用双引号包围。未知字段名的词语按普通关键词处理。
+func parseQuery(q string) (*ParsedQuery, error) {
+	terms, err := splitQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	parsed := &ParsedQuery{}
+	var words []string
+	for _, term := range terms {
+		negate := false
+		body := term
+		if strings.HasPrefix(body, "-") && len(body) > 1 {
+			negate = true
+			body = body[1:]
+		}
+		name, op, value := splitTerm(body)
+		if strings.EqualFold(name, "sort") && op == ":" {
+			if negate {
+				return nil, &QuerySyntaxError{Term: term, Message: "排序不能取反，降序请使用 sort:-字段"}
+			}
+			sorts, err := parseQuerySort(term, value)
+			if err != nil {
+				return nil, err
+			}
+			parsed.Sort = append(parsed.Sort, sorts...)
+			continue
+		}
+		field, ok := queryFields[strings.ToLower(name)]
+		if op == "" || !ok {
+			// 普通关键词原样保留，带引号的短语交给搜索引擎做短语搜索
+			words = append(words, term)
+			continue
+		}
+		filter, err := buildQueryFilter(term, field, op, unquote(value))
+		if err != nil {
+			return nil, err
+		}
+		if negate {
+			filter = "NOT (" + filter + ")"
+		}
+		parsed.Filters = append(parsed.Filters, filter)
+	}
+	parsed.Text = normalizeQuery(strings.Join(words, " "))
+	return parsed, nil
+}
+
+// splitQuery 按空白切分查询，双引号内的空白不切分
+func splitQuery(q string) ([]string, error) {
+	var terms []string
+	var b strings.Builder
+	quoted := false
+	for _, r := range q {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			b.WriteRune(r)
+		case unicode.IsSpace(r) && !quoted:
+			if b.Len() > 0 {
+				terms = append(terms, b.String())
+				b.Reset()
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+	if quoted {
+		return nil, &QuerySyntaxError{Term: b.String(), Message: "缺少结束的双引号"}
+	}
+	if b.Len() > 0 {
+		terms = append(terms, b.String())
+	}
+	return terms, nil
+}
+
+// splitTerm 拆分 field op value，引号内的内容不作为字段名
+func splitTerm(term string) (name, op, value string) {
+	i := strings.IndexAny(term, ":=<>\"")
+	if i <= 0 || term[i] == '"' {
+		return "", "", term
+	}
+	name, rest := term[:i], term[i:]
+	for _, o := range []string{">=", "<=", ":", "=", ">", "<"} {
+		if strings.HasPrefix(rest, o) {
+			return name, o, rest[len(o):]
+		}
+	}
+	return "", "", term
+}
+
+func buildQueryFilter(term string, field queryField, op, value string) (string, error) {
+	if value == "" {
+		return "", &QuerySyntaxError{Term: term, Message: "缺少字段值"}
+	}
+	if !field.numeric {
+		if op != ":" && op != "=" {
+			return "", &QuerySyntaxError{Term: term, Message: "文本字段只支持 : 和 ="}
+		}
+		filter := field.attr + " = " + quoteFilterValue(value)
+		// 输入繁体字时同时匹配简体的取值
+		if simplified := zhconv.ToSimplified(value); simplified != value {
+			filter = "(" + filter + " OR " + field.attr + " = " + quoteFilterValue(simplified) + ")"
+		}
+		return filter, nil
+	}
+
+	if op == ":" {
+		if from, to, ok := strings.Cut(value, ".."); ok {
+			return buildRangeFilter(term, field.attr, from, to)
+		}
+		op = "="
+	}
+	n, err := parseQueryNumber(term, value)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s %s %s", field.attr, op, n), nil
+}
+
+// buildRangeFilter a..b 包含两端，省略一端表示不限制
+func buildRangeFilter(term, attr, from, to string) (string, error) {
+	if from == "" && to == "" {
+		return "", &QuerySyntaxError{Term: term, Message: "范围至少需要一端"}
+	}
+	var parts []string
+	if from != "" {
+		n, err := parseQueryNumber(term, from)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, attr+" >= "+n)
+	}
+	if to != "" {
+		n, err := parseQueryNumber(term, to)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, attr+" <= "+n)
+	}
+	if len(parts) == 2 {
+		a, _ := strconv.ParseFloat(from, 64)
+		b, _ := strconv.ParseFloat(to, 64)
+		if a > b {
+			return "", &QuerySyntaxError{Term: term, Message: "范围的起点大于终点"}
+		}
+	}
+	return strings.Join(parts, " AND "), nil
+}
+
+func parseQueryNumber(term, s string) (string, error) {
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return "", &QuerySyntaxError{Term: term, Message: fmt.Sprintf("%q 不是数字", s)}
+	}
+	return strconv.FormatFloat(n, 'f', -1, 64), nil
+}
+
+// parseQuerySort sort:rating 升序，sort:-rating 降序
+func parseQuerySort(term, value string) ([]string, error) {
+	order := "asc"
+	if strings.HasPrefix(value, "-") {
+		order = "desc"
+		value = value[1:]
+	}
+	attrs, ok := querySorts[strings.ToLower(value)]
+	if !ok {
+		return nil, &QuerySyntaxError{Term: term, Message: "不支持的排序字段"}
+	}
+	sorts := make([]string, 0, len(attrs))
+	for _, attr := range attrs {
+		sorts = append(sorts, attr+":"+order)
+	}
+	return sorts, nil
+}
+
+// pubYear 出版年份，calibre 使用 0101-01-01 表示未设置的日期
+func pubYear(t time.Time) int {
+	if t.Year() <= 101 {
+		return 0
+	}
+	return t.Year()
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && strings.HasPrefix(s, `"`) && strings.HasSuffix(s, `"`) {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// applyQuery 解析 SearchQuery 中的查询语法，关键词、过滤条件和排序写回 query。
+// 查询语法生成的排序优先于客户端传入的 sort。
+func applyQuery(query *SearchQuery) error {
+	parsed, err := parseQuery(query.Query)
+	if err != nil {
+		return err
+	}
+	query.Query = parsed.Text
+	query.Filter = mergeFilters(query.Filter, parsed.Filters)
+	query.Sort = append(parsed.Sort, query.Sort...)
+	return nil
+}
+
+// mergeFilters 合并客户端传入的过滤条件和查询语法生成的过滤条件，各条件之间为 AND
+func mergeFilters(filter interface{}, filters []string) interface{} {
+	if len(filters) == 0 {
+		return filter
+	}
+	var merged []interface{}
+	switch f := filter.(type) {
+	case nil:
+	case string:
+		if strings.TrimSpace(f) != "" {
+			merged = append(merged, f)
+		}
+	case []interface{}:
+		merged = append(merged, f...)
+	case []string:
+		for _, s := range f {
+			merged = append(merged, s)
+		}
+	default:
+		merged = append(merged, f)
+	}
+	for _, s := range filters {
+		merged = append(merged, s)
+	}
+	return merged
+}
@@ -0,0 +1,90 @@
+package calibre
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		q    string
+		want ParsedQuery
+	}{
+		{
+			q: `三体 author:刘慈欣 tag:科幻 year:2000..2010 rating>=4 -tag:漫画`,
+			want: ParsedQuery{
+				Text: "三体",
+				Filters: []string{
+					`authors = "刘慈欣"`,
+					`tags = "科幻"`,
+					"pubyear >= 2000 AND pubyear <= 2010",
+					"rating >= 4",
+					`NOT (tags = "漫画")`,
+				},
+			},
+		},
+		{
+			q: `"黑暗 森林" author:"Cixin Liu" year:..2008 sort:-rating sort:series`,
+			want: ParsedQuery{
+				Text:    `"黑暗 森林"`,
+				Filters: []string{`authors = "Cixin Liu"`, "pubyear <= 2008"},
+				Sort:    []string{"rating:desc", "series:asc", "series_index:asc"},
+			},
+		},
+		{
+			q: "作者:劉慈欣 C++:入门 id=3",
+			want: ParsedQuery{
+				Text:    "C++:入门",
+				Filters: []string{`(authors = "劉慈欣" OR authors = "刘慈欣")`, "id = 3"},
+			},
+		},
+		{q: "三體", want: ParsedQuery{Text: "三体"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.q, func(t *testing.T) {
+			parsed, err := parseQuery(tt.q)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, *parsed)
+		})
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, q := range []string{
+		`author:"刘慈欣`,
+		"year:abc",
+		"year:2010..2000",
+		"year:..",
+		"rating>=",
+		"tag>科幻",
+		"sort:title",
+		"-sort:rating",
+	} {
+		_, err := parseQuery(q)
+		var syntaxErr *QuerySyntaxError
+		assert.True(t, errors.As(err, &syntaxErr), q)
+	}
+}
+
+func TestApplyQuery(t *testing.T) {
+	backend := newTestEmbeddedBackend(t)
+	tests := []struct {
+		name  string
+		query SearchQuery
+		want  []int64
+	}{
+		{name: "author", query: SearchQuery{Query: "author:刘慈欣"}, want: []int64{1, 2}},
+		{name: "author and rating", query: SearchQuery{Query: "author:劉慈欣 rating>=5"}, want: []int64{1}},
+		{name: "exclude tag", query: SearchQuery{Query: "-tag:科幻"}, want: []int64{3, 4}},
+		{name: "text and sort", query: SearchQuery{Query: "rating:3..4 sort:-id"}, want: []int64{4, 3, 2}},
+		{name: "merge client filter", query: SearchQuery{Query: "tag:科幻", Filter: "rating < 5"}, want: []int64{2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NoError(t, applyQuery(&tt.query))
+			assert.Equal(t, tt.want, searchIds(t, backend, &tt.query))
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package calibre
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+const (
+	defaultRandomLimit = 10
+	maxRandomLimit     = 50
+	// maxSampleIdLists 每个书库缓存的抽样 id 列表数量，不同的查询和过滤条件各占一个
+	maxSampleIdLists = 16
+)
+
+// sampleIdCache 同一版本索引中各查询条件匹配的书籍 id，按 id 升序排列
+type sampleIdCache struct {
+	// updated 读取 id 时服务索引的更新时间，索引写入后缓存失效
+	updated time.Time
+	lists   map[string]sampleIdList
+}
+
+type sampleIdList struct {
+	ids   []int64
+	total int64
+}
+
+// samplePositions 返回 [0, total) 的一个随机排列中第 offset 到 offset+limit 个位置。
+// 排列由 seed 决定，同一个 seed 翻页时不会重复；只展开需要的前 offset+limit 项。
+func samplePositions(seed int64, total, offset, limit int) []int {
+	end := min(offset+limit, total)
+	if offset >= end {
+		return []int{}
+	}
+	rng := rand.New(rand.NewSource(seed))
+	// 稀疏的 Fisher-Yates 洗牌，swapped 只记录被交换过的位置
+	swapped := map[int]int{}
+	at := func(i int) int {
+		if v, ok := swapped[i]; ok {
+			return v
+		}
+		return i
+	}
+	positions := make([]int, 0, end-offset)
+	for i := 0; i < end; i++ {
+		j := i + rng.Intn(total-i)
+		vi, vj := at(i), at(j)
+		swapped[i], swapped[j] = vj, vi
+		if i >= offset {
+			positions = append(positions, vj)
+		}
+	}
+	return positions
+}
+
+// randomFilters 随机书籍的标签和语言过滤条件
+func randomFilters(tags []string, lang string) []string {
+	var filters []string
+	for _, tag := range tags {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			filters = append(filters, "tags = "+quoteFilterValue(tag))
+		}
+	}
+	if lang = strings.TrimSpace(lang); lang != "" {
+		filters = append(filters, "languages = "+quoteFilterValue(lang))
+	}
+	return filters
+}
+
+// sampleIds 返回满足 query 条件的全部书籍 id 和精确的总数。id 列表按查询条件缓存到服务索引下一次写入，
+// 同一个 seed 翻页和重复的随机推荐不会重新读取整个结果集
+func (c *Api) sampleIds(lib *library, query SearchQuery) ([]int64, int64, error) {
+	index := lib.currentIndex()
+	updated, err := c.backend.UpdatedAt(index)
+	if err != nil {
+		return nil, 0, err
+	}
+	key := fmt.Sprintf("%s|%v", query.Query, query.Filter)
+	cache := lib.sampleIds.Load()
+	if cache != nil && cache.updated.Equal(updated) {
+		if list, ok := cache.lists[key]; ok {
+			return list.ids, list.total, nil
+		}
+	}
+
+	maxTotalHits := defaultIndexSettings().MaxTotalHits
+	if c.config != nil {
+		maxTotalHits = c.indexSettings().MaxTotalHits
+	}
+	query.Sort = []string{"id:asc"}
+	query.AttributesToRetrieve = []string{"id"}
+	query.Limit, query.Offset = maxTotalHits, 0
+	query.ExactTotal = true
+	result, err := c.backend.Search(index, &query)
+	if err != nil {
+		return nil, 0, err
+	}
+	ids := make([]int64, 0, len(result.Hits))
+	for _, hit := range result.Hits {
+		ids = append(ids, cast.ToInt64(hit["id"]))
+	}
+
+	lists := map[string]sampleIdList{key: {ids: ids, total: result.Total}}
+	if cache != nil && cache.updated.Equal(updated) && len(cache.lists) < maxSampleIdLists {
+		for k, v := range cache.lists {
+			lists[k] = v
+		}
+	}
+	lib.sampleIds.Store(&sampleIdCache{updated: updated, lists: lists})
+	return ids, result.Total, nil
+}
+
+// sampleBooks 在满足 query 条件的全部书籍中按 seed 随机抽样，返回抽样结果和满足条件的书籍总数。
+// 按抽样位置从 sampleIds 中选出 id 后一次读取这些书籍，不受搜索结果前 1000 条的限制（见 IndexSettings.MaxTotalHits）。
+func (c *Api) sampleBooks(lib *library, query SearchQuery, seed int64, offset, limit int) ([]Book, int64, error) {
+	all, total, err := c.sampleIds(lib, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	positions := samplePositions(seed, len(all), offset, limit)
+	if len(positions) == 0 {
+		return []Book{}, total, nil
+	}
+	ids := make([]string, 0, len(positions))
+	for _, pos := range positions {
+		ids = append(ids, strconv.FormatInt(all[pos], 10))
+	}
+	sampled, err := c.backend.Search(lib.currentIndex(), &SearchQuery{
+		Filter: "id IN [" + strings.Join(ids, ", ") + "]",
+		Limit:  int64(len(ids)),
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	found, err := decodeBooks(sampled.Hits)
+	if err != nil {
+		return nil, 0, err
+	}
+	// 按抽样顺序返回，抽样后被删除的书籍跳过
+	byId := make(map[int64]Book, len(found))
+	for _, book := range found {
+		byId[book.ID] = book
+	}
+	books := make([]Book, 0, len(ids))
+	for _, id := range ids {
+		if book, ok := byId[cast.ToInt64(id)]; ok {
+			books = append(books, book)
+		}
+	}
+	return books, total, nil
+}
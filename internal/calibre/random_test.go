@@ -0,0 +1,102 @@
+package calibre
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSamplePositions(t *testing.T) {
+	all := samplePositions(42, 100, 0, 100)
+	sorted := slices.Clone(all)
+	slices.Sort(sorted)
+	for i, v := range sorted {
+		assert.Equal(t, i, v)
+	}
+	assert.NotEqual(t, sorted, all)
+
+	// 同一个 seed 分页的结果与一次取出的结果一致
+	var paged []int
+	for offset := 0; offset < 100; offset += 30 {
+		paged = append(paged, samplePositions(42, 100, offset, 30)...)
+	}
+	assert.Equal(t, all, paged)
+	assert.NotEqual(t, all, samplePositions(43, 100, 0, 100))
+
+	assert.Len(t, samplePositions(1, 3, 0, 10), 3)
+	assert.Empty(t, samplePositions(1, 3, 3, 10))
+	assert.Empty(t, samplePositions(1, 0, 0, 10))
+}
+
+func TestSampleBooks(t *testing.T) {
+	api := &Api{backend: newTestEmbeddedBackend(t)}
+	lib := newLibrary(defaultLibraryID, "", true, "books")
+
+	books, total, err := api.sampleBooks(lib, SearchQuery{}, 7, 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), total)
+	ids := make([]int64, 0, len(books))
+	for _, b := range books {
+		ids = append(ids, b.ID)
+	}
+	assert.ElementsMatch(t, []int64{1, 2, 3, 4}, ids)
+
+	again, _, err := api.sampleBooks(lib, SearchQuery{}, 7, 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, books, again)
+
+	books, total, err = api.sampleBooks(lib, SearchQuery{Filter: mergeFilters(nil, randomFilters([]string{"科幻"}, ""))}, 7, 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	for _, b := range books {
+		assert.Contains(t, b.Tags, "科幻")
+	}
+}
+
+// searchCounter 记录搜索请求的后端
+type searchCounter struct {
+	SearchBackend
+	queries []SearchQuery
+}
+
+func (b *searchCounter) Search(index string, query *SearchQuery) (*SearchResult, error) {
+	b.queries = append(b.queries, *query)
+	return b.SearchBackend.Search(index, query)
+}
+
+func TestSampleBooksQueries(t *testing.T) {
+	backend := &searchCounter{SearchBackend: newTestEmbeddedBackend(t)}
+	api := &Api{backend: backend}
+	lib := newLibrary(defaultLibraryID, "", true, "books")
+
+	books, total, err := api.sampleBooks(lib, SearchQuery{}, 7, 1, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), total)
+	assert.Len(t, books, 2)
+	// 一次读取全部 id 和精确总数，一次读取抽中的书籍
+	assert.Len(t, backend.queries, 2)
+	assert.True(t, backend.queries[0].ExactTotal)
+	assert.Equal(t, []string{"id"}, backend.queries[0].AttributesToRetrieve)
+
+	all, _, err := api.sampleBooks(lib, SearchQuery{}, 7, 0, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, all[1:3], books)
+
+	// id 列表已经缓存，翻页只读取抽中的书籍，超出范围时不需要查询
+	assert.Len(t, backend.queries, 3)
+	backend.queries = nil
+	books, _, err = api.sampleBooks(lib, SearchQuery{}, 7, 4, 2)
+	assert.NoError(t, err)
+	assert.Empty(t, books)
+	assert.Empty(t, backend.queries)
+
+	// 索引写入后重新读取 id
+	_, err = backend.Upsert("books", []Book{{ID: 5, Title: "新书"}}, 10)
+	assert.NoError(t, err)
+	_, total, err = api.sampleBooks(lib, SearchQuery{}, 7, 0, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), total)
+	assert.Len(t, backend.queries, 2)
+	assert.True(t, backend.queries[0].ExactTotal)
+}
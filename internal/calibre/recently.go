@@ -0,0 +1,71 @@
+package calibre
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// recentlySort 最近书籍的排序方式：排序字段以及 since 过滤使用的时间字段
+type recentlySort struct {
+	sort  []string
+	field string
+}
+
+// recentlySorts /api/recently 的 sort 参数，默认 added。按添加时间排序时以 id 作为第二排序，
+// 没有 timestamp 字段的旧索引仍按 id 倒序返回。
+var recentlySorts = map[string]recentlySort{
+	"added":     {sort: []string{"timestamp:desc", "id:desc"}, field: "added_at"},
+	"modified":  {sort: []string{"last_modified:desc", "id:desc"}, field: "modified_at"},
+	"published": {sort: []string{"pubdate:desc", "id:desc"}, field: "published_at"},
+}
+
+// addDateFields 根据书籍的时间生成按年份和时间范围过滤使用的数值字段
+func addDateFields(book *Book) {
+	book.PubYear = pubYear(book.PubDate)
+	book.AddedAt = unixTime(book.Timestamp)
+	book.ModifiedAt = unixTime(book.LastModified)
+	if book.PubYear > 0 {
+		book.PublishedAt = unixTime(book.PubDate)
+	}
+}
+
+func unixTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+// parseSince 解析时间窗口，支持 7d、12h、2w、3m（月）、1y 形式的相对时间，
+// 以及 2006-01-02 或 RFC3339 格式的绝对时间
+func parseSince(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, s, now.Location()); err == nil {
+		return t, nil
+	}
+	if len(s) < 2 {
+		return time.Time{}, fmt.Errorf("无效的时间窗口: %q", s)
+	}
+	n, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil || n <= 0 {
+		return time.Time{}, fmt.Errorf("无效的时间窗口: %q", s)
+	}
+	switch s[len(s)-1] {
+	case 'h':
+		return now.Add(-time.Duration(n) * time.Hour), nil
+	case 'd':
+		return now.AddDate(0, 0, -n), nil
+	case 'w':
+		return now.AddDate(0, 0, -7*n), nil
+	case 'm':
+		return now.AddDate(0, -n, 0), nil
+	case 'y':
+		return now.AddDate(-n, 0, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("无效的时间窗口: %q，单位可选 h、d、w、m、y", s)
+}
@@ -0,0 +1,59 @@
+package calibre
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"7d", time.Date(2024, 3, 8, 12, 0, 0, 0, time.UTC)},
+		{"12h", time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{"2w", time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)},
+		{"1m", time.Date(2024, 2, 15, 12, 0, 0, 0, time.UTC)},
+		{"1y", time.Date(2023, 3, 15, 12, 0, 0, 0, time.UTC)},
+		{"2024-01-01", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"2024-01-01T08:00:00+08:00", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := parseSince(tt.in, now)
+		assert.NoError(t, err, tt.in)
+		assert.True(t, tt.want.Equal(got), "%s: %s", tt.in, got)
+	}
+	for _, in := range []string{"", "d", "0d", "-1d", "7x", "yesterday"} {
+		_, err := parseSince(in, now)
+		assert.Error(t, err, in)
+	}
+}
+
+func TestRecentlyAdded(t *testing.T) {
+	backend, err := newEmbeddedBackend(t.TempDir())
+	assert.NoError(t, err)
+	now := time.Now().UTC().Truncate(time.Second)
+	var books []Book
+	for i, age := range []int{30, 1, 3, 10} {
+		book := Book{ID: int64(i + 1), Timestamp: now.AddDate(0, 0, -age), LastModified: now.AddDate(0, 0, -i)}
+		addDateFields(&book)
+		books = append(books, book)
+	}
+	_, err = backend.Upsert("books", books, 100)
+	assert.NoError(t, err)
+
+	order := recentlySorts["added"]
+	assert.Equal(t, []int64{2, 3, 4, 1}, searchIds(t, backend, &SearchQuery{Sort: order.sort}))
+
+	since, err := parseSince("7d", now)
+	assert.NoError(t, err)
+	query := &SearchQuery{Sort: order.sort, Filter: fmt.Sprintf("%s >= %d", order.field, since.Unix())}
+	assert.Equal(t, []int64{2, 3}, searchIds(t, backend, query))
+
+	order = recentlySorts["modified"]
+	assert.Equal(t, []int64{1, 2, 3, 4}, searchIds(t, backend, &SearchQuery{Sort: order.sort}))
+}
@@ -0,0 +1,222 @@
+package calibre
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jianyun8023/calibre-api/pkg/log"
+)
+
+const savedSearchFile = "saved_searches.json"
+
+// SavedSearch 保存的搜索，类似 calibre 的虚拟书库，通过 view 参数限定搜索、最近更新和随机书籍的范围
+type SavedSearch struct {
+	Name string `json:"name"`
+	// Query 查询语法，与搜索关键词合并后解析
+	Query string `json:"query,omitempty"`
+	// Filter Meilisearch 过滤表达式
+	Filter string `json:"filter,omitempty"`
+	// Sort 请求没有指定排序时使用的排序
+	Sort      []string  `json:"sort,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// apply 把保存的搜索合并到查询中，withSort 为 false 时不使用保存的排序
+func (s SavedSearch) apply(query *SearchQuery, withSort bool) {
+	query.Query = strings.TrimSpace(s.Query + " " + query.Query)
+	if s.Filter != "" {
+		query.Filter = mergeFilters(query.Filter, []string{s.Filter})
+	}
+	if withSort && len(query.Sort) == 0 {
+		query.Sort = s.Sort
+	}
+}
+
+// savedSearchStore 将保存的搜索持久化到 TmpDir 下的 JSON 文件，所有书库共用
+type savedSearchStore struct {
+	mu       sync.RWMutex
+	path     string
+	Searches map[string]SavedSearch `json:"searches"`
+}
+
+func loadSavedSearchStore(dir string) *savedSearchStore {
+	s := &savedSearchStore{
+		path:     path.Join(dir, savedSearchFile),
+		Searches: map[string]SavedSearch{},
+	}
+	b, err := os.ReadFile(s.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("read saved searches %s: %v", s.path, err)
+		}
+		return s
+	}
+	if err := json.Unmarshal(b, s); err != nil {
+		log.Warnf("decode saved searches %s: %v", s.path, err)
+	}
+	if s.Searches == nil {
+		s.Searches = map[string]SavedSearch{}
+	}
+	return s
+}
+
+func (s *savedSearchStore) get(name string) (SavedSearch, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	search, ok := s.Searches[name]
+	return search, ok
+}
+
+// list 按名称排序返回全部保存的搜索
+func (s *savedSearchStore) list() []SavedSearch {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	searches := make([]SavedSearch, 0, len(s.Searches))
+	for _, search := range s.Searches {
+		searches = append(searches, search)
+	}
+	sort.Slice(searches, func(i, j int) bool {
+		return searches[i].Name < searches[j].Name
+	})
+	return searches
+}
+
+// put 新增或替换同名的搜索，返回保存后的结果
+func (s *savedSearchStore) put(search SavedSearch) (SavedSearch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	search.CreatedAt, search.UpdatedAt = now, now
+	if old, ok := s.Searches[search.Name]; ok {
+		search.CreatedAt = old.CreatedAt
+	}
+	s.Searches[search.Name] = search
+	return search, s.save()
+}
+
+// delete 删除保存的搜索，不存在时返回 false
+func (s *savedSearchStore) delete(name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.Searches[name]; !ok {
+		return false, nil
+	}
+	delete(s.Searches, name)
+	return true, s.save()
+}
+
+func (s *savedSearchStore) save() error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// applyView 按 view 参数把保存的搜索合并到查询中，view 为空时不做处理
+func (c *Api) applyView(r *gin.Context, query *SearchQuery, withSort bool) bool {
+	name := r.Query("view")
+	if name == "" {
+		name = r.PostForm("view")
+	}
+	if name == "" {
+		return true
+	}
+	search, ok := c.savedSearches.get(name)
+	if !ok {
+		r.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "保存的搜索不存在: " + name})
+		return false
+	}
+	search.apply(query, withSort)
+	return true
+}
+
+// listSavedSearches 保存的搜索列表
+func (c *Api) listSavedSearches(r *gin.Context) {
+	r.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": c.savedSearches.list(),
+	})
+}
+
+// saveSavedSearch 新增或替换保存的搜索，保存前检查查询语法、过滤表达式和排序
+func (c *Api) saveSavedSearch(r *gin.Context) {
+	var req SavedSearchRequest
+	if err := r.ShouldBindJSON(&req); err != nil {
+		r.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	search := SavedSearch{
+		Name:   strings.TrimSpace(req.Name),
+		Query:  strings.TrimSpace(req.Query),
+		Filter: strings.TrimSpace(req.Filter),
+		Sort:   req.Sort,
+	}
+	if err := validateSavedSearch(search); err != nil {
+		r.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	search, err := c.savedSearches.put(search)
+	if err != nil {
+		r.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error()})
+		return
+	}
+	r.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    search,
+	})
+}
+
+// deleteSavedSearch 删除保存的搜索
+func (c *Api) deleteSavedSearch(r *gin.Context) {
+	name := r.Param("name")
+	ok, err := c.savedSearches.delete(name)
+	if err != nil {
+		r.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error()})
+		return
+	}
+	if !ok {
+		r.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "保存的搜索不存在: " + name})
+		return
+	}
+	r.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+	})
+}
+
+func validateSavedSearch(search SavedSearch) error {
+	if search.Name == "" {
+		return fmt.Errorf("名称不能为空")
+	}
+	if search.Query == "" && search.Filter == "" {
+		return fmt.Errorf("query 和 filter 不能同时为空")
+	}
+	if _, err := parseQuery(search.Query); err != nil {
+		return err
+	}
+	if _, err := parseFilter(search.Filter); err != nil {
+		return fmt.Errorf("无效的过滤表达式: %w", err)
+	}
+	for _, s := range search.Sort {
+		field, order, ok := strings.Cut(s, ":")
+		if !ok || field == "" || (order != "asc" && order != "desc") {
+			return fmt.Errorf("无效的排序: %s，格式为 字段:asc 或 字段:desc", s)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package calibre
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSavedSearchStore(t *testing.T) {
+	dir := t.TempDir()
+	store := loadSavedSearchStore(dir)
+	first, err := store.put(SavedSearch{Name: "科幻", Query: "tag:科幻"})
+	assert.NoError(t, err)
+	_, err = store.put(SavedSearch{Name: "高分", Filter: "rating >= 4"})
+	assert.NoError(t, err)
+	updated, err := store.put(SavedSearch{Name: "科幻", Query: "tag:科幻", Sort: []string{"rating:desc"}})
+	assert.NoError(t, err)
+	assert.Equal(t, first.CreatedAt, updated.CreatedAt)
+
+	reloaded := loadSavedSearchStore(dir)
+	searches := reloaded.list()
+	assert.Len(t, searches, 2)
+	assert.Equal(t, "科幻", searches[0].Name)
+	assert.Equal(t, []string{"rating:desc"}, searches[0].Sort)
+
+	ok, err := reloaded.delete("高分")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, _ = reloaded.delete("高分")
+	assert.False(t, ok)
+	assert.Len(t, loadSavedSearchStore(dir).list(), 1)
+}
+
+func TestSavedSearchApply(t *testing.T) {
+	backend := newTestEmbeddedBackend(t)
+	view := SavedSearch{Query: "tag:科幻", Filter: "rating >= 3", Sort: []string{"id:desc"}}
+	tests := []struct {
+		name     string
+		query    SearchQuery
+		withSort bool
+		want     []int64
+	}{
+		{name: "view sort", query: SearchQuery{}, withSort: true, want: []int64{2, 1}},
+		{name: "request sort wins", query: SearchQuery{Sort: []string{"id:asc"}}, withSort: true, want: []int64{1, 2}},
+		{name: "request filter", query: SearchQuery{Query: "rating<5"}, withSort: true, want: []int64{2}},
+		{name: "without sort", query: SearchQuery{Query: "sort:rating"}, want: []int64{2, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			view.apply(&tt.query, tt.withSort)
+			assert.NoError(t, applyQuery(&tt.query))
+			assert.Equal(t, tt.want, searchIds(t, backend, &tt.query))
+		})
+	}
+}
+
+func TestValidateSavedSearch(t *testing.T) {
+	assert.NoError(t, validateSavedSearch(SavedSearch{Name: "a", Query: "author:刘慈欣", Sort: []string{"rating:desc"}}))
+	for _, s := range []SavedSearch{
+		{Query: "tag:科幻"},
+		{Name: "a"},
+		{Name: "a", Query: "year:abc"},
+		{Name: "a", Filter: "rating >="},
+		{Name: "a", Query: "tag:科幻", Sort: []string{"rating"}},
+	} {
+		assert.Error(t, validateSavedSearch(s), s)
+	}
+}
@@ -4,38 +4,87 @@ import "time"
 
 // SearchRequest 搜索请求参数
 type SearchRequest struct {
-	Q                       string `form:"q" json:"q" jsonschema:"description=搜索关键词,required"`
+	Q                       string `form:"q" json:"q" jsonschema:"description=搜索关键词，支持字段条件：author:刘慈欣 tag:科幻 publisher:xx series:xx lang:zho isbn:xx year:2000..2010 rating>=4，前缀 - 表示排除，sort:-rating 指定排序,required"`
 	Limit                   int    `form:"limit,default=20" json:"limit,omitempty" jsonschema:"description=每页结果数量,minimum=1,maximum=100"`
 	Offset                  int    `form:"offset,default=0" json:"offset,omitempty" jsonschema:"description=结果偏移量,minimum=0"`
 	Filter                  string `form:"filter" json:"filter,omitempty" jsonschema:"description=过滤条件"`
 	Sort                    string `form:"sort" json:"sort,omitempty" jsonschema:"description=排序字段"`
-	Facets                  string `form:"facets" json:"facets,omitempty" jsonschema:"description=分面搜索字段"`
+	Facets                  string `form:"facets" json:"facets,omitempty" jsonschema:"description=分面统计字段，逗号分隔，可选 authors/tags/publisher/languages/rating/series"`
 	Highlight               string `form:"highlight" json:"highlight,omitempty" jsonschema:"description=高亮字段"`
 	Attributes              string `form:"attributes" json:"attributes,omitempty" jsonschema:"description=返回属性"`
-	AttributesToHighlight   string `form:"attributesToHighlight" json:"attributesToHighlight,omitempty" jsonschema:"description=高亮属性"`
+	AttributesToHighlight   string `form:"attributesToHighlight" json:"attributesToHighlight,omitempty" jsonschema:"description=高亮属性，逗号分隔，结果的 highlight.fields 中返回用 <em> 标记的字段值"`
 	AttributesToCrop        string `form:"attributesToCrop" json:"attributesToCrop,omitempty" jsonschema:"description=裁剪属性"`
 	CropLength              int    `form:"cropLength,default=50" json:"cropLength,omitempty" jsonschema:"description=裁剪长度"`
 	AttributesToRetrieve    string `form:"attributesToRetrieve" json:"attributesToRetrieve,omitempty" jsonschema:"description=检索属性"`
-	ShowRankingScore        bool   `form:"showRankingScore" json:"showRankingScore,omitempty" jsonschema:"description=显示排名分数"`
+	ShowRankingScore        bool   `form:"showRankingScore" json:"showRankingScore,omitempty" jsonschema:"description=显示排名分数，结果的 score.value 为 0-1 的相关度"`
 	ShowRankingScoreDetails bool   `form:"showRankingScoreDetails" json:"showRankingScoreDetails,omitempty" jsonschema:"description=显示排名分数详情"`
+	ShowMatchesPosition     bool   `form:"showMatchesPosition" json:"showMatchesPosition,omitempty" jsonschema:"description=返回查询词在各字段中的位置"`
 	Vector                  string `form:"vector" json:"vector,omitempty" jsonschema:"description=向量搜索"`
 	Hybrid                  string `form:"hybrid" json:"hybrid,omitempty" jsonschema:"description=混合搜索参数"`
+	View                    string `form:"view" json:"view,omitempty" jsonschema:"description=保存的搜索名称，只在其范围内搜索"`
+}
+
+// FullTextSearchRequest 全文搜索请求参数
+type FullTextSearchRequest struct {
+	Q      string `form:"q" json:"q" binding:"required" jsonschema:"description=在书籍正文中搜索的关键词,required"`
+	BookID int64  `form:"book_id" json:"book_id,omitempty" jsonschema:"description=只搜索指定书籍"`
+	Limit  int64  `form:"limit" json:"limit,omitempty" jsonschema:"description=每页结果数量,minimum=1,maximum=100"`
+	Offset int64  `form:"offset" json:"offset,omitempty" jsonschema:"description=结果偏移量,minimum=0"`
+}
+
+// FacetsRequest 分面统计请求参数
+type FacetsRequest struct {
+	Facets string `form:"facets" json:"facets,omitempty" jsonschema:"description=分面字段，逗号分隔，可选 authors/tags/publisher/languages/rating/series，默认全部"`
+	Q      string `form:"q" json:"q,omitempty" jsonschema:"description=搜索关键词"`
+	Filter string `form:"filter" json:"filter,omitempty" jsonschema:"description=过滤条件"`
+	Limit  int    `form:"limit" json:"limit,omitempty" jsonschema:"description=每个分面返回的数量，0 表示全部,minimum=0"`
+}
+
+// SeriesListRequest 系列列表请求参数
+type SeriesListRequest struct {
+	Q      string `form:"q" json:"q,omitempty" jsonschema:"description=按系列名称筛选，不区分大小写"`
+	Limit  int    `form:"limit" json:"limit,omitempty" binding:"min=0" jsonschema:"description=结果数量限制，默认 50,minimum=1"`
+	Offset int    `form:"offset" json:"offset,omitempty" binding:"min=0" jsonschema:"description=结果偏移量,minimum=0"`
+}
+
+// SeriesBooksRequest 系列书籍请求参数
+type SeriesBooksRequest struct {
+	Name string `uri:"name" json:"name" jsonschema:"description=系列名称,required"`
 }
 
 // BookUpdateRequest 书籍更新请求参数
 type BookUpdateRequest struct {
-	Title       string            `json:"title,omitempty" jsonschema:"description=书籍标题"`
-	Authors     []string          `json:"authors,omitempty" jsonschema:"description=作者列表"`
-	AuthorSort  string            `json:"author_sort,omitempty" jsonschema:"description=作者排序"`
-	Comments    string            `json:"comments,omitempty" jsonschema:"description=书籍评论"`
-	Publisher   string            `json:"publisher,omitempty" jsonschema:"description=出版社"`
-	PubDate     time.Time         `json:"pubdate,omitempty" jsonschema:"description=出版日期"`
-	Isbn        string            `json:"isbn,omitempty" jsonschema:"description=ISBN号"`
-	Languages   []string          `json:"languages,omitempty" jsonschema:"description=语言列表"`
-	Tags        []string          `json:"tags,omitempty" jsonschema:"description=标签列表"`
-	SeriesIndex float64           `json:"series_index,omitempty" jsonschema:"description=系列索引"`
-	Rating      float64           `json:"rating,omitempty" jsonschema:"description=评分,minimum=0,maximum=5"`
-	Identifiers map[string]string `json:"identifiers,omitempty" jsonschema:"description=标识符映射"`
+	Title       string                 `json:"title,omitempty" jsonschema:"description=书籍标题"`
+	Authors     []string               `json:"authors,omitempty" jsonschema:"description=作者列表"`
+	AuthorSort  string                 `json:"author_sort,omitempty" jsonschema:"description=作者排序"`
+	Comments    string                 `json:"comments,omitempty" jsonschema:"description=书籍评论"`
+	Publisher   string                 `json:"publisher,omitempty" jsonschema:"description=出版社"`
+	PubDate     time.Time              `json:"pubdate,omitempty" jsonschema:"description=出版日期"`
+	Isbn        string                 `json:"isbn,omitempty" jsonschema:"description=ISBN号"`
+	Languages   []string               `json:"languages,omitempty" jsonschema:"description=语言列表"`
+	Tags        []string               `json:"tags,omitempty" jsonschema:"description=标签列表"`
+	Series      string                 `json:"series,omitempty" jsonschema:"description=系列名称"`
+	SeriesIndex float64                `json:"series_index,omitempty" jsonschema:"description=系列索引"`
+	Rating      float64                `json:"rating,omitempty" jsonschema:"description=评分,minimum=0,maximum=5"`
+	Identifiers map[string]string      `json:"identifiers,omitempty" jsonschema:"description=标识符映射"`
+	Custom      map[string]interface{} `json:"custom,omitempty" jsonschema:"description=自定义列的值，键为不带 # 的列名，如 {\"read\": true}，值为 null 时清空"`
+}
+
+// BookUploadRequest 上传书籍请求参数，文件放在 multipart 的 file 字段（可以有多个），
+// 其他字段为写入书籍的元数据，未填写的字段使用 calibre 从文件中读取的元数据
+type BookUploadRequest struct {
+	Duplicates  bool     `form:"duplicates" json:"duplicates,omitempty" jsonschema:"description=书库中已有同名书籍时仍然添加"`
+	Title       string   `form:"title" json:"title,omitempty" jsonschema:"description=书籍标题"`
+	Authors     []string `form:"authors" json:"authors,omitempty" jsonschema:"description=作者列表，多个作者可以用 & 分隔"`
+	Comments    string   `form:"comments" json:"comments,omitempty" jsonschema:"description=书籍简介"`
+	Publisher   string   `form:"publisher" json:"publisher,omitempty" jsonschema:"description=出版社"`
+	PubDate     string   `form:"pubdate" json:"pubdate,omitempty" jsonschema:"description=出版日期，如 2024-05-01"`
+	Isbn        string   `form:"isbn" json:"isbn,omitempty" jsonschema:"description=ISBN号"`
+	Languages   []string `form:"languages" json:"languages,omitempty" jsonschema:"description=语言列表，多个语言可以用逗号分隔"`
+	Tags        []string `form:"tags" json:"tags,omitempty" jsonschema:"description=标签列表，多个标签可以用逗号分隔"`
+	Series      string   `form:"series" json:"series,omitempty" jsonschema:"description=系列名称"`
+	SeriesIndex float64  `form:"series_index" json:"series_index,omitempty" jsonschema:"description=系列索引"`
+	Rating      float64  `form:"rating" json:"rating,omitempty" jsonschema:"description=评分,minimum=0,maximum=5"`
 }
 
 // MetadataSearchRequest 元数据搜索请求参数
@@ -46,7 +95,32 @@ type MetadataSearchRequest struct {
 
 // IndexUpdateRequest 索引更新请求参数
 type IndexUpdateRequest struct {
-	Force bool `form:"force" json:"force,omitempty" jsonschema:"description=强制更新索引"`
+	Force bool `form:"force" json:"force,omitempty" jsonschema:"description=强制全量重建索引，默认按 last_modified 增量同步"`
+}
+
+// IndexJobRequest 索引任务查询请求参数
+type IndexJobRequest struct {
+	ID string `uri:"id" json:"id" jsonschema:"description=索引任务ID,required"`
+}
+
+// FullTextIndexRequest 全文索引更新请求参数
+type FullTextIndexRequest struct {
+	IDs string `form:"ids" json:"ids,omitempty" jsonschema:"description=需要重新索引的书籍 ID，逗号分隔，为空时重建全部书籍的全文索引"`
+}
+
+// SynonymsUpdateRequest 同义词更新请求参数
+type SynonymsUpdateRequest struct {
+	Synonyms map[string][]string `json:"synonyms" jsonschema:"description=同义词，键为词语，值为等价的词语列表，会替换全部已有同义词,required"`
+}
+
+// StopWordsUpdateRequest 停用词更新请求参数
+type StopWordsUpdateRequest struct {
+	StopWords []string `json:"stopwords" jsonschema:"description=停用词列表，会替换全部已有停用词,required"`
+}
+
+// IndexExportRequest 索引导出请求参数
+type IndexExportRequest struct {
+	Gzip bool `form:"gzip" json:"gzip,omitempty" jsonschema:"description=使用 gzip 压缩导出文件"`
 }
 
 // IndexSwitchRequest 索引切换请求参数
@@ -62,14 +136,43 @@ type PublisherListRequest struct {
 
 // RecentlyBooksRequest 最近书籍请求参数
 type RecentlyBooksRequest struct {
-	Limit  int `form:"limit,default=10" json:"limit,omitempty" jsonschema:"description=结果数量限制,minimum=1,maximum=50"`
-	Offset int `form:"offset,default=0" json:"offset,omitempty" jsonschema:"description=结果偏移量,minimum=0"`
+	Limit  int    `form:"limit,default=10" json:"limit,omitempty" jsonschema:"description=结果数量限制,minimum=1,maximum=50"`
+	Offset int    `form:"offset,default=0" json:"offset,omitempty" jsonschema:"description=结果偏移量,minimum=0"`
+	View   string `form:"view" json:"view,omitempty" jsonschema:"description=保存的搜索名称，只返回其范围内的书籍"`
+	Sort   string `form:"sort" json:"sort,omitempty" jsonschema:"description=排序方式：added 添加时间（默认）、modified 修改时间、published 出版时间，均为倒序"`
+	Since  string `form:"since" json:"since,omitempty" jsonschema:"description=只返回该时间之后的书籍，时间字段与排序方式对应，如 7d、12h、2w、3m、1y 或 2024-01-01"`
 }
 
 // RandomBooksRequest 随机书籍请求参数
 type RandomBooksRequest struct {
-	Limit  int `form:"limit,default=10" json:"limit,omitempty" jsonschema:"description=结果数量限制,minimum=1,maximum=50"`
-	Offset int `form:"offset,default=0" json:"offset,omitempty" jsonschema:"description=结果偏移量,minimum=0"`
+	Limit  int      `form:"limit,default=10" json:"limit,omitempty" jsonschema:"description=结果数量限制,minimum=1,maximum=50"`
+	Offset int      `form:"offset,default=0" json:"offset,omitempty" jsonschema:"description=在同一 seed 的随机序列中的偏移量，用于翻页,minimum=0"`
+	Seed   int64    `form:"seed" json:"seed,omitempty" jsonschema:"description=随机种子，相同的种子返回相同的序列，不传时随机生成并在结果中返回"`
+	Q      string   `form:"q" json:"q,omitempty" jsonschema:"description=只在搜索结果中抽样，支持查询语法"`
+	Filter string   `form:"filter" json:"filter,omitempty" jsonschema:"description=过滤条件"`
+	Tag    []string `form:"tag" json:"tag,omitempty" jsonschema:"description=标签，可以传多个，需要同时满足"`
+	Lang   string   `form:"lang" json:"lang,omitempty" jsonschema:"description=语言，如 zho、eng"`
+	View   string   `form:"view" json:"view,omitempty" jsonschema:"description=保存的搜索名称，只返回其范围内的书籍"`
+}
+
+// SuggestRequest 输入联想请求参数
+type SuggestRequest struct {
+	Q     string `form:"q" json:"q" jsonschema:"description=输入的前缀，支持繁体、拼音全拼和拼音首字母,required"`
+	Types string `form:"types" json:"types,omitempty" jsonschema:"description=建议类型，逗号分隔，可选 title/author/tag/publisher/series，默认全部"`
+	Limit int    `form:"limit" json:"limit,omitempty" jsonschema:"description=结果数量，默认 10,minimum=1,maximum=50"`
+}
+
+// SavedSearchRequest 保存的搜索请求参数
+type SavedSearchRequest struct {
+	Name   string   `json:"name" binding:"required" jsonschema:"description=名称，同名时替换,required"`
+	Query  string   `json:"query,omitempty" jsonschema:"description=查询语法，例如 author:刘慈欣 tag:科幻"`
+	Filter string   `json:"filter,omitempty" jsonschema:"description=过滤条件"`
+	Sort   []string `json:"sort,omitempty" jsonschema:"description=排序，格式为 字段:asc 或 字段:desc，请求未指定排序时使用"`
+}
+
+// SavedSearchNameParam 保存的搜索名称路径参数
+type SavedSearchNameParam struct {
+	Name string `uri:"name" json:"name" jsonschema:"description=保存的搜索名称,required"`
 }
 
 // BookIDParam 书籍ID路径参数
@@ -116,7 +219,7 @@ type ProxyCoverRequest struct {
 
 // GetBookFileRequest 获取书籍文件请求参数
 type GetBookFileRequest struct {
-	ID string `uri:"id" json:"id" jsonschema:"description=书籍ID,required"`
+	ID string `uri:"id" json:"id" jsonschema:"description=书籍ID，可带格式后缀如 123.pdf，不带后缀时下载默认格式,required"`
 }
 
 // GetBookRequest 获取书籍信息请求参数
@@ -144,3 +247,11 @@ type BookContentByQueryRequest struct {
 type EnhancedToolRequest struct {
 	Args map[string]interface{} `json:"args" jsonschema:"description=工具参数"`
 }
+
+// DuplicatesRequest 重复书籍查询参数
+type DuplicatesRequest struct {
+	By        string  `form:"by" json:"by,omitempty" jsonschema:"description=查重方式，逗号分隔：isbn、identifiers、title，默认全部"`
+	Threshold float64 `form:"threshold" json:"threshold,omitempty" jsonschema:"description=书名相似度阈值（0-1），作者相同且书名相似度不低于阈值视为重复，默认 0.85,minimum=0,maximum=1"`
+	Limit     int     `form:"limit" json:"limit,omitempty" binding:"min=0" jsonschema:"description=返回的分组数量，默认 50,minimum=1"`
+	Offset    int     `form:"offset" json:"offset,omitempty" binding:"min=0" jsonschema:"description=分组偏移量，默认 0,minimum=0"`
+}
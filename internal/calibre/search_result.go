@@ -0,0 +1,134 @@
+package calibre
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/spf13/cast"
+)
+
+// SearchRecord 搜索结果中的一条记录，书籍字段之外附带高亮和相关度信息，
+// 只有请求了 attributesToHighlight、attributesToCrop、showMatchesPosition 或 showRankingScore 时才返回
+type SearchRecord struct {
+	Book
+	Highlight *SearchHighlight `json:"highlight,omitempty"`
+	Score     *SearchScore     `json:"score,omitempty"`
+}
+
+// SearchHighlight 命中字段的高亮信息
+type SearchHighlight struct {
+	// Fields 高亮或裁剪后的字段值，匹配的词项用 <em> 标记
+	Fields map[string]interface{} `json:"fields,omitempty"`
+	// Matches 查询词项在各字段中的位置
+	Matches map[string][]MatchPosition `json:"matches,omitempty"`
+}
+
+// MatchPosition 匹配位置，Start 和 Length 按 UTF-8 字节计算，数组字段的 Indices 为元素下标
+type MatchPosition struct {
+	Start   int   `json:"start"`
+	Length  int   `json:"length"`
+	Indices []int `json:"indices,omitempty"`
+}
+
+// SearchScore 相关度，Value 为 0-1 的得分，Details 为搜索引擎返回的各排序规则得分
+type SearchScore struct {
+	Value   float64                `json:"value"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// decodeSearchRecords 将命中结果转换为 SearchRecord，并把 _formatted、_matchesPosition、
+// _rankingScore 和 _rankingScoreDetails 转换为 highlight 和 score
+func decodeSearchRecords(hits []map[string]interface{}, query *SearchQuery) ([]SearchRecord, error) {
+	records := make([]SearchRecord, len(hits))
+	for i, hit := range hits {
+		if err := decodeDocument(hit, &records[i].Book); err != nil {
+			return nil, err
+		}
+		records[i].Highlight = searchHighlight(hit, query)
+		records[i].Score = searchScore(hit)
+	}
+	return records, nil
+}
+
+func searchHighlight(hit map[string]interface{}, query *SearchQuery) *SearchHighlight {
+	highlight := &SearchHighlight{}
+	if formatted, ok := hit["_formatted"].(map[string]interface{}); ok {
+		fields := append(append([]string(nil), query.AttributesToHighlight...), query.AttributesToCrop...)
+		all := slices.Contains(fields, "*")
+		for field, v := range formatted {
+			// 请求 * 时 Meilisearch 返回全部字段，只保留内容有变化的字段
+			if slices.Contains(fields, field) || (all && isFormatted(v)) {
+				if highlight.Fields == nil {
+					highlight.Fields = map[string]interface{}{}
+				}
+				highlight.Fields[field] = v
+			}
+		}
+	}
+	if positions, ok := hit["_matchesPosition"].(map[string][]interface{}); ok {
+		highlight.Matches = matchPositions(positions)
+	} else if positions, ok := hit["_matchesPosition"].(map[string]interface{}); ok {
+		converted := make(map[string][]interface{}, len(positions))
+		for field, v := range positions {
+			converted[field] = cast.ToSlice(v)
+		}
+		highlight.Matches = matchPositions(converted)
+	}
+	if highlight.Fields == nil && highlight.Matches == nil {
+		return nil
+	}
+	return highlight
+}
+
+// isFormatted 字段值中是否有高亮标记或裁剪标记
+func isFormatted(v interface{}) bool {
+	for _, s := range fieldStrings(v) {
+		if strings.Contains(s, highlightPreTag) || strings.Contains(s, cropMarker) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPositions(positions map[string][]interface{}) map[string][]MatchPosition {
+	matches := make(map[string][]MatchPosition, len(positions))
+	for field, list := range positions {
+		for _, item := range list {
+			m, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			position := MatchPosition{Start: cast.ToInt(m["start"]), Length: cast.ToInt(m["length"])}
+			if indices, ok := m["indices"]; ok {
+				position.Indices = cast.ToIntSlice(indices)
+			}
+			matches[field] = append(matches[field], position)
+		}
+	}
+	return matches
+}
+
+func searchScore(hit map[string]interface{}) *SearchScore {
+	v, ok := hit["_rankingScore"]
+	if !ok {
+		return nil
+	}
+	score := &SearchScore{Value: cast.ToFloat64(v)}
+	if details, ok := hit["_rankingScoreDetails"].(map[string]interface{}); ok {
+		score.Details = details
+	}
+	return score
+}
+
+// splitAttributes 拆分逗号分隔的字段列表，attributesToHighlight=title,authors 与重复传参等价
+func splitAttributes(values []string) []string {
+	var attrs []string
+	for _, v := range values {
+		for _, a := range strings.Split(v, ",") {
+			if a = strings.TrimSpace(a); a != "" {
+				attrs = append(attrs, a)
+			}
+		}
+	}
+	return attrs
+}
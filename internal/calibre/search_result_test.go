@@ -0,0 +1,61 @@
+package calibre
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeSearchRecords(t *testing.T) {
+	backend := newTestEmbeddedBackend(t)
+	query := &SearchQuery{
+		Query:                 "三体",
+		Limit:                 10,
+		AttributesToHighlight: []string{"title"},
+		ShowRankingScore:      true,
+		ShowMatchesPosition:   true,
+	}
+	result, err := backend.Search("books", query)
+	assert.NoError(t, err)
+	records, err := decodeSearchRecords(result.Hits, query)
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+
+	record := records[0]
+	assert.Equal(t, int64(1), record.ID)
+	assert.Equal(t, "三体", record.Title)
+	assert.Equal(t, map[string]interface{}{"title": "<em>三体</em>"}, record.Highlight.Fields)
+	assert.Equal(t, []MatchPosition{{Start: 0, Length: 6}}, record.Highlight.Matches["title"])
+	assert.Equal(t, 1.0, record.Score.Value)
+
+	// 未请求高亮和分数时不返回
+	records, err = decodeSearchRecords([]map[string]interface{}{{"id": 1, "title": "三体"}}, &SearchQuery{})
+	assert.NoError(t, err)
+	assert.Nil(t, records[0].Highlight)
+	assert.Nil(t, records[0].Score)
+}
+
+func TestDecodeSearchRecordsMeilisearch(t *testing.T) {
+	hit := map[string]interface{}{
+		"id":    float64(3),
+		"title": "The Three-Body Problem",
+		"_formatted": map[string]interface{}{
+			"id":      "3",
+			"title":   "The <em>Three</em>-Body Problem",
+			"authors": []interface{}{"Cixin Liu"},
+		},
+		"_matchesPosition": map[string]interface{}{
+			"title":   []interface{}{map[string]interface{}{"start": float64(4), "length": float64(5)}},
+			"authors": []interface{}{map[string]interface{}{"start": float64(0), "length": float64(5), "indices": []interface{}{float64(0)}}},
+		},
+		"_rankingScore":        0.75,
+		"_rankingScoreDetails": map[string]interface{}{"words": map[string]interface{}{"score": 1.0}},
+	}
+	records, err := decodeSearchRecords([]map[string]interface{}{hit}, &SearchQuery{AttributesToHighlight: []string{"*"}})
+	assert.NoError(t, err)
+	record := records[0]
+	assert.Equal(t, map[string]interface{}{"title": "The <em>Three</em>-Body Problem"}, record.Highlight.Fields)
+	assert.Equal(t, []MatchPosition{{Start: 0, Length: 5, Indices: []int{0}}}, record.Highlight.Matches["authors"])
+	assert.Equal(t, 0.75, record.Score.Value)
+	assert.Contains(t, record.Score.Details, "words")
+}
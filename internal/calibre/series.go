@@ -0,0 +1,79 @@
+package calibre
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxSeriesBooks 单个系列最多返回的书籍数量
+const maxSeriesBooks = 1000
+
+// listSeries 系列列表接口，按书籍数量降序返回系列名称
+func (c *Api) listSeries(r *gin.Context) {
+	var req SeriesListRequest
+	if err := r.ShouldBindQuery(&req); err != nil {
+		r.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = 50
+	}
+	_, facets, err := c.facetCounts(c.lib(r), "", nil, []string{"series"}, 0)
+	if err != nil {
+		r.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error()})
+		return
+	}
+
+	q := strings.ToLower(req.Q)
+	series := make([]FacetCount, 0)
+	for _, s := range facets["series"] {
+		if s.Value != "" && strings.Contains(strings.ToLower(s.Value), q) {
+			series = append(series, s)
+		}
+	}
+	total := len(series)
+	start := min(req.Offset, total)
+	end := min(start+req.Limit, total)
+	r.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"records": series[start:end],
+			"total":   total,
+			"limit":   req.Limit,
+			"offset":  req.Offset,
+		},
+	})
+}
+
+// getSeriesBooks 获取系列中的书籍，按 series_index 升序排列
+func (c *Api) getSeriesBooks(r *gin.Context) {
+	name := r.Param("name")
+	result, err := c.backend.Search(c.lib(r).currentIndex(), &SearchQuery{
+		Filter: "series = " + quoteFilterValue(name),
+		Sort:   []string{"series_index:asc", "id:asc"},
+		Limit:  maxSeriesBooks,
+	})
+	if err != nil {
+		r.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error()})
+		return
+	}
+	books, err := decodeBooks(result.Hits)
+	if err != nil {
+		r.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error()})
+		return
+	}
+	if len(books) == 0 {
+		r.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "series not found"})
+		return
+	}
+	r.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"name":    name,
+			"records": books,
+			"total":   result.Total,
+		},
+	})
+}
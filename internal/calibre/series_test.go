@@ -0,0 +1,61 @@
+package calibre
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListSeries(t *testing.T) {
+	backend, err := newEmbeddedBackend(t.TempDir())
+	assert.NoError(t, err)
+	_, err = backend.Upsert("books", []Book{
+		{ID: 1, Title: "三体", Series: "地球往事", SeriesIndex: 1},
+		{ID: 2, Title: "黑暗森林", Series: "地球往事", SeriesIndex: 2},
+		{ID: 3, Title: "哈利·波特与魔法石", Series: "哈利·波特", SeriesIndex: 1},
+		{ID: 4, Title: "活着"},
+	}, 10)
+	assert.NoError(t, err)
+	lib := newLibrary(defaultLibraryID, defaultLibraryID, true, "books")
+	api := &Api{backend: backend, libraries: map[string]*library{lib.id: lib}, defaultLibrary: lib.id}
+	router := gin.New()
+	router.GET("/api/series", api.listSeries)
+
+	tests := []struct {
+		name      string
+		query     string
+		wantCode  int
+		wantNames []string
+	}{
+		{"全部系列", "", http.StatusOK, []string{"地球往事", "哈利·波特"}},
+		{"分页", "?offset=1&limit=1", http.StatusOK, []string{"哈利·波特"}},
+		{"偏移超出范围", "?offset=5", http.StatusOK, []string{}},
+		{"负数偏移", "?offset=-1", http.StatusBadRequest, nil},
+		{"负数数量", "?limit=-5", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/series"+tt.query, nil))
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var resp struct {
+				Data struct {
+					Records []FacetCount `json:"records"`
+				} `json:"data"`
+			}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			names := []string{}
+			for _, s := range resp.Data.Records {
+				names = append(names, s.Value)
+			}
+			assert.Equal(t, tt.wantNames, names)
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package calibre
+
+import (
+	"slices"
+	"sort"
+
+	"github.com/jianyun8023/calibre-api/pkg/log"
+	"github.com/meilisearch/meilisearch-go"
+)
+
+// defaultIndexSettings 未配置 search.settings 时使用的索引设置
+func defaultIndexSettings() IndexSettings {
+	return IndexSettings{
+		FilterableAttributes: []string{"authors", "file_path", "id", "last_modified", "pubdate", "publisher", "isbn", "tags", "languages", "rating", "series", "pubyear", "added_at", "modified_at", "published_at", "custom"},
+		// 简体、拼音和首字母字段由 addSearchAliases 生成，权重低于原始字段
+		SearchableAttributes: []string{"title", "authors", "isbn", "publisher", "title_simplified", "authors_simplified", "title_pinyin", "authors_pinyin", "title_initials", "authors_initials"},
+		SortableAttributes:   []string{"author_sort", "id", "last_modified", "pubdate", "publisher", "series", "series_index", "rating", "timestamp"},
+		// 分面统计需要完整的取值分布，默认的 100 个对作者和标签不够用
+		MaxValuesPerFacet: 10000,
+		// Meilisearch 默认只能访问前 1000 条结果，随机抽样需要按位置访问全部书籍
+		MaxTotalHits: 1000000,
+	}
+}
+
+// withDefaults 用默认值补全未配置的设置项
+func (s IndexSettings) withDefaults() IndexSettings {
+	d := defaultIndexSettings()
+	if len(s.FilterableAttributes) == 0 {
+		s.FilterableAttributes = d.FilterableAttributes
+	}
+	if len(s.SearchableAttributes) == 0 {
+		s.SearchableAttributes = d.SearchableAttributes
+	}
+	if len(s.SortableAttributes) == 0 {
+		s.SortableAttributes = d.SortableAttributes
+	}
+	if s.MaxValuesPerFacet == 0 {
+		s.MaxValuesPerFacet = d.MaxValuesPerFacet
+	}
+	if s.MaxTotalHits == 0 {
+		s.MaxTotalHits = d.MaxTotalHits
+	}
+	return s
+}
+
+// settingsDelta 比较当前设置与期望设置，返回需要更新的部分。
+// filterable 和 sortable 与顺序无关，searchable 和 rankingRules 的顺序决定权重，需要按顺序比较。
+func settingsDelta(current *meilisearch.Settings, desired IndexSettings) (*meilisearch.Settings, bool) {
+	delta := &meilisearch.Settings{}
+	changed := false
+	if !sameSet(current.FilterableAttributes, desired.FilterableAttributes) {
+		delta.FilterableAttributes = desired.FilterableAttributes
+		changed = true
+	}
+	if !sameSet(current.SortableAttributes, desired.SortableAttributes) {
+		delta.SortableAttributes = desired.SortableAttributes
+		changed = true
+	}
+	if !slices.Equal(current.SearchableAttributes, desired.SearchableAttributes) {
+		delta.SearchableAttributes = desired.SearchableAttributes
+		changed = true
+	}
+	if len(desired.RankingRules) > 0 && !slices.Equal(current.RankingRules, desired.RankingRules) {
+		delta.RankingRules = desired.RankingRules
+		changed = true
+	}
+	if desired.MaxValuesPerFacet > 0 && (current.Faceting == nil || current.Faceting.MaxValuesPerFacet != desired.MaxValuesPerFacet) {
+		delta.Faceting = &meilisearch.Faceting{MaxValuesPerFacet: desired.MaxValuesPerFacet}
+		changed = true
+	}
+	if desired.MaxTotalHits > 0 && (current.Pagination == nil || current.Pagination.MaxTotalHits != desired.MaxTotalHits) {
+		delta.Pagination = &meilisearch.Pagination{MaxTotalHits: desired.MaxTotalHits}
+		changed = true
+	}
+	// 清空同义词和停用词需要调用 reset 接口，见 reconcileSettings
+	if len(desired.Synonyms) > 0 && !sameSynonyms(current.Synonyms, desired.Synonyms) {
+		delta.Synonyms = desired.Synonyms
+		changed = true
+	}
+	if len(desired.StopWords) > 0 && !sameSet(current.StopWords, desired.StopWords) {
+		delta.StopWords = desired.StopWords
+		changed = true
+	}
+	return delta, changed
+}
+
+// reconcileSettings 将索引设置调整为期望设置，只提交有差异的部分，返回提交的任务
+func reconcileSettings(index *meilisearch.Index, desired IndexSettings) ([]int64, error) {
+	current, err := index.GetSettings()
+	if err != nil {
+		return nil, err
+	}
+	var taskIds []int64
+	if len(desired.Synonyms) == 0 && len(current.Synonyms) > 0 {
+		log.Infof("Resetting synonyms for %q", index.UID)
+		task, err := index.ResetSynonyms()
+		if err != nil {
+			return nil, err
+		}
+		taskIds = append(taskIds, task.TaskUID)
+	}
+	if len(desired.StopWords) == 0 && len(current.StopWords) > 0 {
+		log.Infof("Resetting stop words for %q", index.UID)
+		task, err := index.ResetStopWords()
+		if err != nil {
+			return nil, err
+		}
+		taskIds = append(taskIds, task.TaskUID)
+	}
+	delta, changed := settingsDelta(current, desired)
+	if !changed {
+		log.Infof("Index settings for %q are up to date", index.UID)
+		return taskIds, nil
+	}
+	log.Infof("Updating index settings for %q: %+v", index.UID, *delta)
+	task, err := index.UpdateSettings(delta)
+	if err != nil {
+		return nil, err
+	}
+	return append(taskIds, task.TaskUID), nil
+}
+
+func sameSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	x := append([]string(nil), a...)
+	y := append([]string(nil), b...)
+	sort.Strings(x)
+	sort.Strings(y)
+	return slices.Equal(x, y)
+}
+
+// sameSynonyms 比较同义词设置，每个词的同义词列表与顺序无关
+func sameSynonyms(a, b map[string][]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for word, synonyms := range a {
+		other, ok := b[word]
+		if !ok || !sameSet(synonyms, other) {
+			return false
+		}
+	}
+	return true
+}
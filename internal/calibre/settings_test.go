@@ -0,0 +1,133 @@
+package calibre
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/meilisearch/meilisearch-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSettingsDelta(t *testing.T) {
+	desired := IndexSettings{}.withDefaults()
+	reversed := slices.Clone(desired.FilterableAttributes)
+	slices.Reverse(reversed)
+	withWords := desired
+	withWords.Synonyms = map[string][]string{"三体": {"地球往事", "三体问题"}}
+	withWords.StopWords = []string{"的", "了"}
+
+	tests := []struct {
+		name    string
+		current meilisearch.Settings
+		desired *IndexSettings
+		want    meilisearch.Settings
+		changed bool
+	}{
+		{
+			name: "up to date with different filterable order",
+			current: meilisearch.Settings{
+				FilterableAttributes: reversed,
+				SearchableAttributes: desired.SearchableAttributes,
+				SortableAttributes:   desired.SortableAttributes,
+				Faceting:             &meilisearch.Faceting{MaxValuesPerFacet: 10000},
+				Pagination:           &meilisearch.Pagination{MaxTotalHits: 1000000},
+			},
+		},
+		{
+			name: "misspelled sortable and default faceting and pagination",
+			current: meilisearch.Settings{
+				FilterableAttributes: desired.FilterableAttributes,
+				SearchableAttributes: desired.SearchableAttributes,
+				SortableAttributes:   []string{"authors_sort", "id", "last_modified", "pubdate", "publisher"},
+				Faceting:             &meilisearch.Faceting{MaxValuesPerFacet: 100},
+				Pagination:           &meilisearch.Pagination{MaxTotalHits: 1000},
+			},
+			want: meilisearch.Settings{
+				SortableAttributes: desired.SortableAttributes,
+				Faceting:           &meilisearch.Faceting{MaxValuesPerFacet: 10000},
+				Pagination:         &meilisearch.Pagination{MaxTotalHits: 1000000},
+			},
+			changed: true,
+		},
+		{
+			name: "searchable order matters",
+			current: meilisearch.Settings{
+				FilterableAttributes: desired.FilterableAttributes,
+				SearchableAttributes: []string{"authors", "title", "isbn", "publisher"},
+				SortableAttributes:   desired.SortableAttributes,
+				Faceting:             &meilisearch.Faceting{MaxValuesPerFacet: 10000},
+				Pagination:           &meilisearch.Pagination{MaxTotalHits: 1000000},
+			},
+			want:    meilisearch.Settings{SearchableAttributes: desired.SearchableAttributes},
+			changed: true,
+		},
+		{
+			name: "synonyms and stop words compare as sets",
+			current: meilisearch.Settings{
+				FilterableAttributes: desired.FilterableAttributes,
+				SearchableAttributes: desired.SearchableAttributes,
+				SortableAttributes:   desired.SortableAttributes,
+				Faceting:             &meilisearch.Faceting{MaxValuesPerFacet: 10000},
+				Pagination:           &meilisearch.Pagination{MaxTotalHits: 1000000},
+				Synonyms:             map[string][]string{"三体": {"三体问题", "地球往事"}},
+				StopWords:            []string{"了", "的"},
+			},
+			desired: &withWords,
+		},
+		{
+			name: "new synonym",
+			current: meilisearch.Settings{
+				FilterableAttributes: desired.FilterableAttributes,
+				SearchableAttributes: desired.SearchableAttributes,
+				SortableAttributes:   desired.SortableAttributes,
+				Faceting:             &meilisearch.Faceting{MaxValuesPerFacet: 10000},
+				Pagination:           &meilisearch.Pagination{MaxTotalHits: 1000000},
+				Synonyms:             map[string][]string{"三体": {"地球往事"}},
+				StopWords:            []string{"了", "的"},
+			},
+			desired: &withWords,
+			want:    meilisearch.Settings{Synonyms: withWords.Synonyms},
+			changed: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := desired
+			if tt.desired != nil {
+				settings = *tt.desired
+			}
+			delta, changed := settingsDelta(&tt.current, settings)
+			assert.Equal(t, tt.changed, changed)
+			if changed {
+				assert.Equal(t, tt.want, *delta)
+			}
+		})
+	}
+}
+
+// settingsBackend 每次应用设置返回一个任务，任务状态由 taskBackend 决定
+type settingsBackend struct {
+	taskBackend
+	ensured []string
+}
+
+func (b *settingsBackend) EnsureIndex(index string, settings IndexSettings) ([]int64, error) {
+	b.ensured = append(b.ensured, index)
+	return []int64{int64(len(b.ensured))}, nil
+}
+
+func TestApplyIndexSettings(t *testing.T) {
+	lib := newLibrary(defaultLibraryID, defaultLibraryID, true, "books")
+	backend := &settingsBackend{taskBackend: taskBackend{tasks: []BackendTask{
+		{UID: 1, Status: TaskStatusSucceeded},
+		{UID: 2, Status: TaskStatusSucceeded},
+	}}}
+	c := &Api{backend: backend, config: &Config{}}
+	assert.NoError(t, c.applyIndexSettings(lib))
+	assert.Equal(t, []string{"books", "books-bak"}, backend.ensured)
+
+	// 设置任务失败时返回错误，而不是当作已经生效
+	backend.ensured = nil
+	backend.tasks[1] = BackendTask{UID: 2, Status: TaskStatusFailed, Error: "invalid filterable attribute"}
+	assert.ErrorContains(t, c.applyIndexSettings(lib), "invalid filterable attribute")
+}
@@ -0,0 +1,248 @@
+package calibre
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jianyun8023/calibre-api/pkg/log"
+	"github.com/spf13/cast"
+)
+
+// exportPageSize 导出时每次从索引读取的文档数量
+const exportPageSize = 1000
+
+// exportIndex 以 NDJSON 格式导出服务索引中的全部文档，每行一本书，gzip=true 时压缩
+func (c *Api) exportIndex(r *gin.Context) {
+	var req IndexExportRequest
+	if err := r.ShouldBindQuery(&req); err != nil {
+		r.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	lib := c.lib(r)
+	index := lib.currentIndex()
+
+	filename := fmt.Sprintf("%s-%s.ndjson", index, time.Now().Format("20060102150405"))
+	contentType := "application/x-ndjson"
+	if req.Gzip {
+		filename += ".gz"
+		contentType = "application/gzip"
+	}
+	r.Header("Content-Type", contentType)
+	r.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	r.Status(http.StatusOK)
+
+	var w io.Writer = r.Writer
+	if req.Gzip {
+		gz := gzip.NewWriter(r.Writer)
+		defer gz.Close()
+		w = gz
+	}
+	// 响应头已经发出，导出中途失败只能中断输出，客户端通过文件不完整发现错误
+	if err := c.writeSnapshot(w, index); err != nil {
+		log.Warnf("export index %s error: %v", index, err)
+		r.Abort()
+	}
+}
+
+// writeSnapshot 按 id 顺序分页读取索引，逐行写出文档
+func (c *Api) writeSnapshot(w io.Writer, index string) error {
+	enc := json.NewEncoder(w)
+	for offset := int64(0); ; offset += exportPageSize {
+		docs, err := c.backend.Documents(index, offset, exportPageSize, nil)
+		if err != nil {
+			return err
+		}
+		for _, doc := range docs {
+			if err := enc.Encode(doc); err != nil {
+				return err
+			}
+		}
+		if int64(len(docs)) < exportPageSize {
+			return nil
+		}
+	}
+}
+
+// importIndex 上传 exportIndex 导出的文件（可以是 gzip 压缩的），写入暂存索引后与服务索引交换。
+// 文件先保存到 TmpDir 并检查格式，导入在后台任务中执行，返回任务 ID。
+func (c *Api) importIndex(r *gin.Context) {
+	lib := c.lib(r)
+	body, err := snapshotUpload(r)
+	if err != nil {
+		r.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	defer body.Close()
+
+	file, err := os.CreateTemp(c.baseDir, "index-import-*")
+	if err != nil {
+		r.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error()})
+		return
+	}
+	path := file.Name()
+	_, err = io.Copy(file, body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		r.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error()})
+		return
+	}
+
+	count, err := readSnapshot(path, func(map[string]interface{}) error { return nil })
+	if err == nil && count == 0 {
+		err = errors.New("快照文件中没有书籍")
+	}
+	if err != nil {
+		os.Remove(path)
+		r.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+
+	job, err := c.jobs.start(IndexJobModeImport, lib.id)
+	if err != nil {
+		os.Remove(path)
+		r.JSON(http.StatusConflict, gin.H{"code": 409, "message": err.Error()})
+		return
+	}
+	job.update(func(j *IndexJob) {
+		j.BooksTotal = count
+	})
+	go func() {
+		defer os.Remove(path)
+		err := c.applyIndexSettings(lib)
+		if err == nil {
+			err = c.importSnapshot(job, lib, path)
+		}
+		if err == nil {
+			if _, err := c.buildSuggestIndex(lib); err != nil {
+				log.Warnf("library %q: build suggest index error: %v", lib.id, err)
+			}
+		}
+		job.finish(err)
+	}()
+
+	r.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    job.snapshot(),
+	})
+}
+
+// snapshotUpload 读取上传的快照，支持 multipart 的 file 字段或直接作为请求体
+func snapshotUpload(r *gin.Context) (io.ReadCloser, error) {
+	if fh, err := r.FormFile("file"); err == nil {
+		return fh.Open()
+	} else if !errors.Is(err, http.ErrNotMultipart) && !errors.Is(err, http.ErrMissingFile) {
+		return nil, err
+	}
+	if r.Request.Body == nil || r.Request.ContentLength == 0 {
+		return nil, errors.New("缺少快照文件")
+	}
+	return r.Request.Body, nil
+}
+
+// importSnapshot 清空暂存索引，分批写入快照中的文档，全部成功后交换索引，
+// 并把同步水位设为快照中最大的 last_modified，之后的增量同步从这里继续。
+func (c *Api) importSnapshot(job *indexJob, lib *library, path string) error {
+	job.setPhase(IndexJobPhaseFetching)
+	index := lib.stagingIndex()
+	taskIds, err := c.backend.DeleteAll(index)
+	if err != nil {
+		return err
+	}
+	job.addTasks(taskIds...)
+
+	var batch []map[string]interface{}
+	var watermark time.Time
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		tasks, err := c.upsertBatch(job, index, batch, len(batch))
+		if err != nil {
+			return err
+		}
+		taskIds = append(taskIds, tasks...)
+		batch = nil
+		return nil
+	}
+	_, err = readSnapshot(path, func(doc map[string]interface{}) error {
+		if t := cast.ToTime(doc["last_modified"]); t.After(watermark) {
+			watermark = t
+		}
+		batch = append(batch, doc)
+		if len(batch) >= indexBatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	if err := waitForTask(c, job, lib, taskIds); err != nil {
+		return err
+	}
+	err = c.state.update(lib.index, func(s *IndexState) {
+		s.LastSync = time.Now()
+		s.LastBuild = s.LastSync
+		s.Watermark = watermark
+	})
+	if err != nil {
+		log.Warnf("save index state error: %v", err)
+	}
+	return nil
+}
+
+// readSnapshot 逐个读取快照中的文档，自动识别 gzip 压缩，返回文档数量。
+// 每个文档必须是带 id 的 JSON 对象。
+func readSnapshot(path string, fn func(doc map[string]interface{}) error) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	var reader io.Reader = br
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return 0, err
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	dec := json.NewDecoder(reader)
+	dec.UseNumber()
+	count := 0
+	for {
+		var doc map[string]interface{}
+		if err := dec.Decode(&doc); err == io.EOF {
+			return count, nil
+		} else if err != nil {
+			return count, fmt.Errorf("第 %d 个文档格式错误: %w", count+1, err)
+		}
+		if doc["id"] == nil {
+			return count, fmt.Errorf("第 %d 个文档缺少 id", count+1)
+		}
+		count++
+		if err := fn(doc); err != nil {
+			return count, err
+		}
+	}
+}
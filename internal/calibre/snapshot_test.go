@@ -0,0 +1,59 @@
+package calibre
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	source := newTestEmbeddedBackend(t)
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	assert.NoError(t, (&Api{backend: source}).writeSnapshot(gz, "books"))
+	assert.NoError(t, gz.Close())
+	path := filepath.Join(t.TempDir(), "books.ndjson.gz")
+	assert.NoError(t, os.WriteFile(path, buf.Bytes(), 0o644))
+
+	count, err := readSnapshot(path, func(map[string]interface{}) error { return nil })
+	assert.NoError(t, err)
+	assert.Equal(t, 4, count)
+
+	dir := t.TempDir()
+	backend, err := newEmbeddedBackend(dir)
+	assert.NoError(t, err)
+	c := &Api{backend: backend, state: loadStateStore(dir)}
+	lib := newLibrary("library", "library", true, "books")
+	_, err = backend.Upsert(lib.currentIndex(), []Book{{ID: 9, Title: "旧数据"}}, 10)
+	assert.NoError(t, err)
+	job, err := newJobManager().start(IndexJobModeImport, lib.id)
+	assert.NoError(t, err)
+
+	assert.NoError(t, c.importSnapshot(job, lib, path))
+	assert.Equal(t, []int64{1, 2, 3, 4}, searchIds(t, backend, &SearchQuery{Sort: []string{"id:asc"}}))
+	assert.Equal(t, 4, job.snapshot().BooksFetched)
+	var book Book
+	assert.NoError(t, backend.GetDocument(lib.currentIndex(), "1", &book))
+	assert.Equal(t, "三体", book.Title)
+	assert.Equal(t, []string{"科幻"}, book.Tags)
+	assert.False(t, c.state.get(lib.index).LastBuild.IsZero())
+}
+
+func TestReadSnapshotErrors(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"missing id": `{"id":1,"title":"a"}` + "\n" + `{"title":"b"}`,
+		"not json":   `{"id":1}` + "\nnot json",
+		"not object": `[1,2]`,
+	} {
+		path := filepath.Join(dir, strings.ReplaceAll(name, " ", "-"))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		_, err := readSnapshot(path, func(map[string]interface{}) error { return nil })
+		assert.Error(t, err, name)
+	}
+}
@@ -0,0 +1,246 @@
+package calibre
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jianyun8023/calibre-api/pkg/log"
+	"github.com/jianyun8023/calibre-api/pkg/zhconv"
+)
+
+// 联想建议的类型
+const (
+	SuggestTitle     = "title"
+	SuggestAuthor    = "author"
+	SuggestTag       = "tag"
+	SuggestPublisher = "publisher"
+	SuggestSeries    = "series"
+)
+
+const (
+	defaultSuggestLimit = 10
+	maxSuggestLimit     = 50
+	// maxSuggestScan 单次查询最多检查的前缀匹配数量，避免单个字母的查询遍历整个索引
+	maxSuggestScan = 2000
+)
+
+// suggestFields 建立联想索引需要读取的字段
+var suggestFields = []string{"id", "title", "authors", "tags", "publisher", "series"}
+
+// Suggestion 联想建议，Count 为包含该值的书籍数量
+type Suggestion struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+type suggestKey struct {
+	key   string
+	entry int
+}
+
+// suggestIndex 联想建议的前缀索引：每个取值生成若干个小写的查找键（原文、简体、拼音全拼、拼音首字母、
+// 各单词开头的后缀），所有键排序后通过二分查找定位前缀。建立后只读，可以并发查询。
+type suggestIndex struct {
+	entries []Suggestion
+	keys    []suggestKey
+}
+
+// newSuggestIndex 从书籍中统计书名、作者、标签、出版社和系列，建立前缀索引
+func newSuggestIndex(books []Book) *suggestIndex {
+	idx := &suggestIndex{}
+	entries := map[[2]string]int{}
+	add := func(typ, value string) {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return
+		}
+		k := [2]string{typ, value}
+		if i, ok := entries[k]; ok {
+			idx.entries[i].Count++
+			return
+		}
+		entries[k] = len(idx.entries)
+		idx.entries = append(idx.entries, Suggestion{Type: typ, Value: value, Count: 1})
+	}
+	for _, book := range books {
+		add(SuggestTitle, book.Title)
+		for _, author := range book.Authors {
+			add(SuggestAuthor, author)
+		}
+		for _, tag := range book.Tags {
+			add(SuggestTag, tag)
+		}
+		add(SuggestPublisher, book.Publisher)
+		add(SuggestSeries, book.Series)
+	}
+
+	for i, entry := range idx.entries {
+		for _, key := range suggestKeys(entry.Value) {
+			idx.keys = append(idx.keys, suggestKey{key: key, entry: i})
+		}
+	}
+	sort.Slice(idx.keys, func(i, j int) bool {
+		if idx.keys[i].key != idx.keys[j].key {
+			return idx.keys[i].key < idx.keys[j].key
+		}
+		return idx.keys[i].entry < idx.keys[j].entry
+	})
+	return idx
+}
+
+// suggestKeys 返回取值的查找键，The Three-Body Problem 可以通过 the、three、body 开头的输入找到，
+// 三體 可以通过 三体、santi、st 找到
+func suggestKeys(value string) []string {
+	seen := map[string]bool{}
+	var keys []string
+	add := func(key string) {
+		if key != "" && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	normalized := normalizeSuggest(value)
+	add(normalized)
+	prev := ' '
+	for i, r := range normalized {
+		if i > 0 && !isWordRune(prev) && isWordRune(r) && r < unicode.MaxASCII {
+			add(normalized[i:])
+		}
+		prev = r
+	}
+	if joined, spaced, initials := toPinyin(normalized); joined != "" {
+		add(joined)
+		add(spaced)
+		add(initials)
+	}
+	return keys
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// normalizeSuggest 查找键和查询统一转为简体小写
+func normalizeSuggest(s string) string {
+	return strings.ToLower(strings.TrimSpace(zhconv.ToSimplified(s)))
+}
+
+// lookup 返回以 q 开头的建议，完全匹配的排在前面，其余按书籍数量从多到少排序
+func (idx *suggestIndex) lookup(q string, types map[string]bool, limit int) []Suggestion {
+	q = normalizeSuggest(q)
+	if q == "" {
+		return []Suggestion{}
+	}
+	start := sort.Search(len(idx.keys), func(i int) bool {
+		return idx.keys[i].key >= q
+	})
+	exact := map[int]bool{}
+	var matched []int
+	scanned := 0
+	for i := start; i < len(idx.keys) && scanned < maxSuggestScan; i++ {
+		k := idx.keys[i]
+		if !strings.HasPrefix(k.key, q) {
+			break
+		}
+		// 先按类型过滤再计数，其他类型的键再多也不会挤掉要查询的类型
+		if len(types) > 0 && !types[idx.entries[k.entry].Type] {
+			continue
+		}
+		scanned++
+		if _, ok := exact[k.entry]; !ok {
+			matched = append(matched, k.entry)
+		}
+		exact[k.entry] = exact[k.entry] || k.key == q
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		a, b := idx.entries[matched[i]], idx.entries[matched[j]]
+		if exact[matched[i]] != exact[matched[j]] {
+			return exact[matched[i]]
+		}
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return len(a.Value) < len(b.Value)
+	})
+	if len(matched) > limit {
+		matched = matched[:limit]
+	}
+	suggestions := make([]Suggestion, 0, len(matched))
+	for _, i := range matched {
+		suggestions = append(suggestions, idx.entries[i])
+	}
+	return suggestions
+}
+
+// buildSuggestIndex 读取书库服务索引中的书籍，重新建立联想索引
+func (c *Api) buildSuggestIndex(lib *library) (*suggestIndex, error) {
+	books, err := c.indexedBooks(lib.currentIndex(), suggestFields)
+	if err != nil {
+		return nil, err
+	}
+	idx := newSuggestIndex(books)
+	lib.suggest.Store(idx)
+	log.Infof("library %q: built suggest index with %d entries", lib.id, len(idx.entries))
+	return idx, nil
+}
+
+// loadSuggestIndex 返回书库的联想索引，服务重启、切换索引或上传、修改、删除书籍后第一次查询时建立
+func (c *Api) loadSuggestIndex(lib *library) (*suggestIndex, error) {
+	if idx := lib.suggest.Load(); idx != nil {
+		return idx, nil
+	}
+	lib.suggestMu.Lock()
+	defer lib.suggestMu.Unlock()
+	if idx := lib.suggest.Load(); idx != nil {
+		return idx, nil
+	}
+	return c.buildSuggestIndex(lib)
+}
+
+// suggest 输入联想，返回匹配的书名、作者、标签、出版社和系列
+func (c *Api) suggest(r *gin.Context) {
+	var req SuggestRequest
+	if err := r.ShouldBindQuery(&req); err != nil {
+		r.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	types, err := parseSuggestTypes(req.Types)
+	if err != nil {
+		r.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	if req.Limit <= 0 {
+		req.Limit = defaultSuggestLimit
+	}
+	req.Limit = min(req.Limit, maxSuggestLimit)
+
+	idx, err := c.loadSuggestIndex(c.lib(r))
+	if err != nil {
+		r.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error()})
+		return
+	}
+	r.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": idx.lookup(req.Q, types, req.Limit),
+	})
+}
+
+func parseSuggestTypes(s string) (map[string]bool, error) {
+	types := map[string]bool{}
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(strings.ToLower(v))
+		switch v {
+		case "":
+		case SuggestTitle, SuggestAuthor, SuggestTag, SuggestPublisher, SuggestSeries:
+			types[v] = true
+		default:
+			return nil, fmt.Errorf("不支持的联想类型: %s", v)
+		}
+	}
+	return types, nil
+}
@@ -0,0 +1,58 @@
+package calibre
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSuggestIndexLookup(t *testing.T) {
+	idx := newSuggestIndex([]Book{
+		{ID: 1, Title: "三体", Authors: []string{"刘慈欣"}, Tags: []string{"科幻"}, Publisher: "重庆出版社", Series: "地球往事"},
+		{ID: 2, Title: "球状闪电", Authors: []string{"刘慈欣"}, Tags: []string{"科幻"}},
+		{ID: 3, Title: "The Three-Body Problem", Authors: []string{"Cixin Liu"}, Tags: []string{"Science Fiction"}},
+		{ID: 4, Title: "流浪地球", Authors: []string{"劉慈欣"}, Tags: []string{"科幻", "短篇"}},
+	})
+	values := func(s []Suggestion) []string {
+		var v []string
+		for _, x := range s {
+			v = append(v, x.Type+":"+x.Value)
+		}
+		return v
+	}
+
+	assert.Equal(t, []Suggestion{{Type: SuggestAuthor, Value: "刘慈欣", Count: 2}, {Type: SuggestAuthor, Value: "劉慈欣", Count: 1}},
+		idx.lookup("刘", nil, 10))
+	assert.Equal(t, []string{"author:刘慈欣", "author:劉慈欣"}, values(idx.lookup("lcx", nil, 10)))
+	assert.Equal(t, []string{"tag:科幻"}, values(idx.lookup("KE", nil, 10)))
+	assert.Equal(t, []string{"title:三体"}, values(idx.lookup("santi", nil, 10)))
+	assert.Equal(t, []string{"title:The Three-Body Problem"}, values(idx.lookup("body", nil, 10)))
+	assert.Equal(t, []string{"author:Cixin Liu"}, values(idx.lookup("cixin", map[string]bool{SuggestAuthor: true}, 10)))
+	// 完全匹配排在书籍数量更多的前缀匹配之前
+	assert.Equal(t, []string{"author:Cixin Liu", "author:刘慈欣", "author:劉慈欣", "title:流浪地球"}, values(idx.lookup("liu", nil, 10)))
+	assert.Len(t, idx.lookup("l", nil, 1), 1)
+	assert.Empty(t, idx.lookup(" ", nil, 10))
+}
+
+func TestSuggestIndexLookupTypes(t *testing.T) {
+	books := make([]Book, 0, maxSuggestScan+1)
+	for i := 0; i < maxSuggestScan; i++ {
+		books = append(books, Book{ID: int64(i + 1), Title: fmt.Sprintf("a%05d", i)})
+	}
+	books = append(books, Book{ID: maxSuggestScan + 1, Title: "其他", Publisher: "azure press"})
+	idx := newSuggestIndex(books)
+
+	// 书名的键超过扫描上限，按出版社查询仍然能找到排在后面的出版社
+	assert.Len(t, idx.lookup("a", nil, 10), 10)
+	assert.Equal(t, []Suggestion{{Type: SuggestPublisher, Value: "azure press", Count: 1}},
+		idx.lookup("a", map[string]bool{SuggestPublisher: true}, 10))
+}
+
+func TestParseSuggestTypes(t *testing.T) {
+	types, err := parseSuggestTypes("author, Tag")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{SuggestAuthor: true, SuggestTag: true}, types)
+	_, err = parseSuggestTypes("isbn")
+	assert.Error(t, err)
+}
@@ -0,0 +1,172 @@
+package calibre
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jianyun8023/calibre-api/pkg/log"
+)
+
+// indexSettings 返回当前的索引设置，未配置的项使用默认值
+func (c *Api) indexSettings() IndexSettings {
+	c.settingsMu.RLock()
+	defer c.settingsMu.RUnlock()
+	return c.config.Search.Settings.withDefaults()
+}
+
+// updateIndexSettings 修改索引设置并写回配置文件 search.settings.<key>，
+// 然后应用到所有书库的服务索引和暂存索引
+func (c *Api) updateIndexSettings(key string, value interface{}, fn func(s *IndexSettings)) error {
+	c.settingsMu.Lock()
+	settings := c.config.Search.Settings
+	fn(&settings)
+	if c.config.ConfigFile != "" {
+		if err := saveConfigValue(c.config.ConfigFile, []string{"search", "settings", key}, value); err != nil {
+			c.settingsMu.Unlock()
+			return err
+		}
+	} else {
+		log.Warnf("no config file loaded, index setting %q is not persisted", key)
+	}
+	c.config.Search.Settings = settings
+	c.settingsMu.Unlock()
+
+	c.libMu.RLock()
+	libraries := make([]*library, 0, len(c.libraries))
+	for _, lib := range c.libraries {
+		libraries = append(libraries, lib)
+	}
+	c.libMu.RUnlock()
+	for _, lib := range libraries {
+		if err := c.applyIndexSettings(lib); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyIndexSettings 把当前索引设置应用到书库的服务索引和暂存索引，
+// 等待设置任务完成，设置无效时返回后端的错误
+func (c *Api) applyIndexSettings(lib *library) error {
+	return c.ensureIndexes(c.indexSettings(), lib.currentIndex(), lib.stagingIndex())
+}
+
+// ensureIndexes 创建索引并应用设置，等待全部设置任务结束
+func (c *Api) ensureIndexes(settings IndexSettings, indexes ...string) error {
+	var taskIds []int64
+	for _, index := range indexes {
+		tasks, err := c.backend.EnsureIndex(index, settings)
+		if err != nil {
+			return err
+		}
+		taskIds = append(taskIds, tasks...)
+	}
+	if err := c.waitForTasksUntil(nil, taskIds, time.Now().Add(c.taskTimeout())); err != nil {
+		return fmt.Errorf("update index settings error: %w", err)
+	}
+	return nil
+}
+
+// getSynonyms 查询同义词设置
+func (c *Api) getSynonyms(r *gin.Context) {
+	synonyms := c.indexSettings().Synonyms
+	if synonyms == nil {
+		synonyms = map[string][]string{}
+	}
+	r.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": synonyms,
+	})
+}
+
+// updateSynonyms 替换全部同义词，传入空对象时清空
+func (c *Api) updateSynonyms(r *gin.Context) {
+	var req SynonymsUpdateRequest
+	if err := r.ShouldBindJSON(&req); err != nil {
+		r.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	// 配置文件中的键名会被 viper 转为小写，这里提前统一，避免重启后与索引中的设置不一致
+	synonyms := map[string][]string{}
+	for word, values := range req.Synonyms {
+		word = strings.ToLower(strings.TrimSpace(word))
+		if word == "" {
+			r.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "同义词不能为空"})
+			return
+		}
+		values = cleanWords(values)
+		if len(values) == 0 {
+			continue
+		}
+		synonyms[word] = cleanWords(append(synonyms[word], values...))
+	}
+
+	err := c.updateIndexSettings("synonyms", synonyms, func(s *IndexSettings) {
+		s.Synonyms = synonyms
+	})
+	if err != nil {
+		r.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error()})
+		return
+	}
+	r.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    synonyms,
+	})
+}
+
+// getStopWords 查询停用词设置
+func (c *Api) getStopWords(r *gin.Context) {
+	stopWords := c.indexSettings().StopWords
+	if stopWords == nil {
+		stopWords = []string{}
+	}
+	r.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": stopWords,
+	})
+}
+
+// updateStopWords 替换全部停用词，传入空数组时清空
+func (c *Api) updateStopWords(r *gin.Context) {
+	var req StopWordsUpdateRequest
+	if err := r.ShouldBindJSON(&req); err != nil {
+		r.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	stopWords := cleanWords(req.StopWords)
+	if stopWords == nil {
+		stopWords = []string{}
+	}
+
+	err := c.updateIndexSettings("stopwords", stopWords, func(s *IndexSettings) {
+		s.StopWords = stopWords
+	})
+	if err != nil {
+		r.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error()})
+		return
+	}
+	r.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    stopWords,
+	})
+}
+
+// cleanWords 去掉空白和重复的词语，保持原有顺序
+func cleanWords(words []string) []string {
+	var result []string
+	seen := map[string]bool{}
+	for _, w := range words {
+		w = strings.TrimSpace(w)
+		if w == "" || seen[w] {
+			continue
+		}
+		seen[w] = true
+		result = append(result, w)
+	}
+	return result
+}
@@ -3,6 +3,8 @@ package calibre
 import (
 	"database/sql"
 	"time"
+
+	"github.com/jianyun8023/calibre-api/pkg/client"
 )
 
 type Book struct {
@@ -17,12 +19,32 @@ type Book struct {
 	LastModified time.Time         `json:"last_modified"`
 	PubDate      time.Time         `json:"pubdate"`
 	Publisher    string            `json:"publisher"`
+	Series       string            `json:"series,omitempty"`
 	SeriesIndex  float64           `json:"series_index"`
 	Size         int64             `json:"size"`
 	Tags         []string          `json:"tags"`
 	Title        string            `json:"title"`
 	Rating       float64           `json:"rating"`
 	Identifiers  map[string]string `json:"identifiers"`
+	Formats      []string          `json:"formats,omitempty"`
+	// Timestamp 书籍添加到 calibre 书库的时间
+	Timestamp time.Time `json:"timestamp"`
+	// PubYear 出版年份，用于按年份过滤，calibre 未设置出版日期时为 0
+	PubYear int `json:"pubyear,omitempty"`
+	// 以下字段为对应时间的 Unix 秒数，用于按时间范围过滤，时间未设置时为 0
+	AddedAt     int64 `json:"added_at,omitempty"`
+	ModifiedAt  int64 `json:"modified_at,omitempty"`
+	PublishedAt int64 `json:"published_at,omitempty"`
+	// Custom 自定义列的值，键为不带 # 的列名，可以按 custom.<列名> 过滤，如 custom.read = true
+	Custom map[string]interface{} `json:"custom,omitempty"`
+
+	// 以下字段由 addSearchAliases 生成，用于繁体和拼音搜索
+	TitleSimplified   string   `json:"title_simplified,omitempty"`
+	TitlePinyin       []string `json:"title_pinyin,omitempty"`
+	TitleInitials     string   `json:"title_initials,omitempty"`
+	AuthorsSimplified []string `json:"authors_simplified,omitempty"`
+	AuthorsPinyin     []string `json:"authors_pinyin,omitempty"`
+	AuthorsInitials   []string `json:"authors_initials,omitempty"`
 }
 
 type BookRaw struct {
@@ -58,16 +80,59 @@ type Config struct {
 	Search    Search    `mapstructure:"search"`
 	Metadata  Metadata  `mapstructure:"metadata"`
 	MCP       MCPConfig `mapstructure:"mcp"`
+	// ConfigFile 加载的配置文件路径，通过接口修改的索引设置会写回这个文件
+	ConfigFile string `mapstructure:"-"`
 }
 
 type Content struct {
 	Server string `mapstructure:"server"`
+	// Auth 认证方式：auto（默认，按服务器的要求使用 digest 或 basic）、basic、digest
+	Auth     string `mapstructure:"auth"`
+	Username string `mapstructure:"username"`
+	// Password 和 Headers 可能包含密钥，不输出到启动日志
+	Password string `mapstructure:"password" json:"-"`
+	// Headers 每个请求都携带的预共享请求头，如反向代理校验的令牌
+	Headers map[string]string `mapstructure:"headers" json:"-"`
+}
+
+func (c Content) auth() client.Auth {
+	return client.Auth{
+		Type:     c.Auth,
+		Username: c.Username,
+		Password: c.Password,
+		Headers:  c.Headers,
+	}
 }
 
 type Search struct {
-	Host   string `mapstructure:"host"`
-	APIKey string `mapstructure:"apikey"`
-	Index  string `mapstructure:"index"`
+	// Backend 搜索后端：meilisearch（默认）或 embedded
+	Backend string `mapstructure:"backend"`
+	Host    string `mapstructure:"host"`
+	APIKey  string `mapstructure:"apikey"`
+	Index   string `mapstructure:"index"`
+	// DataDir embedded 后端的数据目录，默认为 TmpDir/search
+	DataDir string `mapstructure:"datadir"`
+	// FullText 是否启用书籍正文的全文索引，索引名称为 Index-fulltext
+	FullText bool `mapstructure:"fulltext"`
+	// TaskTimeout 等待一次索引任务中全部 Meilisearch 任务完成的最长时间（分钟），默认 60
+	TaskTimeout int `mapstructure:"tasktimeout"`
+	// Settings Meilisearch 索引设置，启动时与索引当前设置比对并更新差异
+	Settings IndexSettings `mapstructure:"settings"`
+}
+
+// IndexSettings 索引设置，未配置的项使用默认值
+type IndexSettings struct {
+	FilterableAttributes []string `mapstructure:"filterable"`
+	SearchableAttributes []string `mapstructure:"searchable"`
+	SortableAttributes   []string `mapstructure:"sortable"`
+	RankingRules         []string `mapstructure:"rankingrules"`
+	MaxValuesPerFacet    int64    `mapstructure:"maxvaluesperfacet"`
+	// MaxTotalHits 搜索结果可以翻页访问的最大数量，随机抽样需要访问整个索引
+	MaxTotalHits int64 `mapstructure:"maxtotalhits"`
+	// Synonyms 同义词，键为词语，值为与它等价的词语列表
+	Synonyms map[string][]string `mapstructure:"synonyms"`
+	// StopWords 搜索时忽略的停用词
+	StopWords []string `mapstructure:"stopwords"`
 }
 
 type MCPConfig struct {
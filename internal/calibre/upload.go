@@ -0,0 +1,207 @@
+package calibre
+
+import (
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jianyun8023/calibre-api/pkg/content"
+	"github.com/jianyun8023/calibre-api/pkg/log"
+	"github.com/spf13/cast"
+)
+
+// uploadFormats 允许上传的书籍格式
+var uploadFormats = []string{"epub", "azw3", "pdf"}
+
+// errDuplicateBook 书库中已有同名书籍，上传时没有指定 duplicates
+var errDuplicateBook = errors.New("书库中已有同名书籍，可以设置 duplicates=true 仍然添加")
+
+// UploadResult 单个文件的上传结果，添加成功但写入元数据或索引失败时 BookID 不为 0 且 Error 为失败原因
+type UploadResult struct {
+	Filename   string              `json:"filename"`
+	BookID     int64               `json:"book_id,omitempty"`
+	Book       *Book               `json:"book,omitempty"`
+	Duplicates []content.Duplicate `json:"duplicates,omitempty"`
+	Error      string              `json:"error,omitempty"`
+}
+
+// uploadBooks 上传书籍文件到 calibre，写入请求中的元数据后更新服务索引，
+// 新书立即出现在搜索和 /api/recently 中
+func (c *Api) uploadBooks(r *gin.Context) {
+	var req BookUploadRequest
+	if err := r.ShouldBind(&req); err != nil {
+		r.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	form, err := r.MultipartForm()
+	if err != nil {
+		r.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "需要 multipart/form-data 格式的上传: " + err.Error()})
+		return
+	}
+	files := form.File["file"]
+	if len(files) == 0 {
+		r.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "缺少上传文件"})
+		return
+	}
+	for _, fh := range files {
+		if err := checkUploadFormat(fh.Filename); err != nil {
+			r.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+			return
+		}
+	}
+	metadata, err := req.book()
+	if err != nil {
+		r.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+
+	lib := c.lib(r)
+	results := make([]UploadResult, 0, len(files))
+	var firstErr error
+	added := 0
+	for _, fh := range files {
+		result, err := c.uploadBook(lib, fh, req.Duplicates, metadata)
+		if result.BookID > 0 {
+			added++
+		}
+		if err != nil {
+			log.Warnf("upload book %s error: %v", fh.Filename, err)
+			result.Error = err.Error()
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		results = append(results, result)
+	}
+	// 至少添加了一本书时返回 200，每个文件的结果见 data
+	status, message := http.StatusOK, "success"
+	if added == 0 && firstErr != nil {
+		status, message = uploadErrorStatus(firstErr), firstErr.Error()
+	}
+	r.JSON(status, gin.H{
+		"code":    status,
+		"message": message,
+		"data":    results,
+	})
+}
+
+// uploadBook 添加一个文件，写入元数据并更新索引
+func (c *Api) uploadBook(lib *library, fh *multipart.FileHeader, addDuplicates bool, metadata *Book) (UploadResult, error) {
+	filename := filepath.Base(fh.Filename)
+	result := UploadResult{Filename: filename}
+	f, err := fh.Open()
+	if err != nil {
+		return result, err
+	}
+	defer f.Close()
+
+	added, err := c.contentApi.AddBook(filename, f, addDuplicates, lib.id)
+	if err != nil {
+		return result, err
+	}
+	if added.BookID == 0 {
+		result.Duplicates = added.Duplicates
+		return result, errDuplicateBook
+	}
+	result.BookID = added.BookID
+
+	book, err := c.indexNewBook(lib, added.BookID, metadata)
+	if err != nil {
+		return result, err
+	}
+	result.Book = book
+	return result, nil
+}
+
+// indexNewBook 写入请求中的元数据，然后读取书籍的完整元数据写入服务索引
+func (c *Api) indexNewBook(lib *library, id int64, metadata *Book) (*Book, error) {
+	books, err := c.fetchBooks(lib, id)
+	if err != nil {
+		return nil, err
+	}
+	if changes := parseParams(metadata, &books[0]); len(changes) > 0 {
+		_, err := c.contentApi.UpdateMetaData(strconv.FormatInt(id, 10), changes, lib.id)
+		if err := ignoreDecodeError(err); err != nil {
+			return nil, fmt.Errorf("书籍已添加，写入元数据失败: %w", err)
+		}
+		if books, err = c.fetchBooks(lib, id); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := c.backend.Upsert(lib.currentIndex(), books, len(books)); err != nil {
+		return nil, fmt.Errorf("书籍已添加，更新索引失败，请刷新索引: %w", err)
+	}
+	// 联想索引在下一次查询时按新数据重新建立
+	lib.suggest.Store(nil)
+	return &books[0], nil
+}
+
+func (c *Api) fetchBooks(lib *library, id int64) ([]Book, error) {
+	data, err := c.contentApi.GetBookMetaDatas([]int64{id}, lib.id, c.customColumns(lib)...)
+	if err := ignoreDecodeError(err); err != nil {
+		return nil, fmt.Errorf("书籍已添加，查询元数据失败: %w", err)
+	}
+	books, err := convertContentBooks(data, lib)
+	if err != nil {
+		return nil, err
+	}
+	if len(books) == 0 {
+		return nil, fmt.Errorf("书籍已添加，但是没有查询到书籍 %d", id)
+	}
+	return books, nil
+}
+
+// checkUploadFormat 检查上传文件的扩展名
+func checkUploadFormat(filename string) error {
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(filename)), ".")
+	for _, f := range uploadFormats {
+		if ext == f {
+			return nil
+		}
+	}
+	return fmt.Errorf("不支持的文件格式: %s，仅支持 %s", filename, strings.ToUpper(strings.Join(uploadFormats, "、")))
+}
+
+func uploadErrorStatus(err error) int {
+	if errors.Is(err, errDuplicateBook) {
+		return http.StatusConflict
+	}
+	return contentErrorStatus(err)
+}
+
+// book 将上传请求中的元数据转换为 Book，供 parseParams 生成修改内容
+func (req BookUploadRequest) book() (*Book, error) {
+	book := &Book{
+		Title:       strings.TrimSpace(req.Title),
+		Comments:    req.Comments,
+		Publisher:   strings.TrimSpace(req.Publisher),
+		Isbn:        strings.TrimSpace(req.Isbn),
+		Series:      strings.TrimSpace(req.Series),
+		SeriesIndex: req.SeriesIndex,
+		Rating:      req.Rating,
+	}
+	var authors []string
+	for _, v := range req.Authors {
+		for _, a := range strings.Split(v, "&") {
+			if a = strings.TrimSpace(a); a != "" {
+				authors = append(authors, a)
+			}
+		}
+	}
+	book.Authors = authors
+	book.Tags = splitAttributes(req.Tags)
+	book.Languages = splitAttributes(req.Languages)
+	if req.PubDate != "" {
+		pubDate, err := cast.ToTimeE(req.PubDate)
+		if err != nil {
+			return nil, fmt.Errorf("无效的出版日期: %q", req.PubDate)
+		}
+		book.PubDate = pubDate
+	}
+	return book, nil
+}
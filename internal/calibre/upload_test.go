@@ -0,0 +1,128 @@
+package calibre
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jianyun8023/calibre-api/pkg/client"
+	"github.com/jianyun8023/calibre-api/pkg/content"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeCalibre 模拟 calibre 的 add-book、set-fields、cmd/list 和 field-metadata 接口，新书的 ID 为 9
+func fakeCalibre(t *testing.T) *httptest.Server {
+	title := "文件中的书名"
+	tags := []string{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/cdb/add-book/0/n/dup.epub/library":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"title":      "dup",
+				"duplicates": []map[string]interface{}{{"title": "dup", "authors": []string{"佚名"}}},
+			})
+		case strings.HasPrefix(r.URL.Path, "/cdb/add-book/0/n/"):
+			body, _ := io.ReadAll(r.Body)
+			assert.Equal(t, "/cdb/add-book/0/n/新书.epub/library", r.URL.Path)
+			assert.Equal(t, "epub-data", string(body))
+			json.NewEncoder(w).Encode(map[string]interface{}{"title": title, "book_id": 9})
+		case r.URL.Path == "/cdb/set-fields/9/library":
+			var body struct {
+				Changes map[string]interface{} `json:"changes"`
+			}
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			title = body.Changes["title"].(string)
+			for _, tag := range body.Changes["tags"].([]interface{}) {
+				tags = append(tags, tag.(string))
+			}
+			w.Write([]byte("{}"))
+		case r.URL.Path == "/ajax/field-metadata/library":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"title": map[string]interface{}{"datatype": "text", "is_custom": false},
+				"#read": map[string]interface{}{"name": "Read", "datatype": "bool", "is_custom": true, "is_editable": true, "is_multiple": map[string]interface{}{}},
+				"#shelf": map[string]interface{}{"name": "Shelf", "datatype": "text", "is_custom": true, "is_editable": true,
+					"is_multiple": map[string]interface{}{"cache_to_list": ","}},
+			})
+		case r.URL.Path == "/cdb/cmd/list/0":
+			json.NewEncoder(w).Encode(map[string]interface{}{"result": map[string]interface{}{
+				"book_ids": []int{9},
+				"data": map[string]interface{}{
+					"title":       map[string]interface{}{"9": title},
+					"authors":     map[string]interface{}{"9": []string{"佚名"}},
+					"tags":        map[string]interface{}{"9": tags},
+					"pubdate":     map[string]interface{}{"9": map[string]interface{}{}},
+					"timestamp":   map[string]interface{}{"9": map[string]interface{}{"v": "2024-05-01T12:00:00+00:00"}},
+					"identifiers": map[string]interface{}{"9": map[string]interface{}{}},
+					"formats":     map[string]interface{}{"9": []string{"EPUB"}},
+					"#read":       map[string]interface{}{"9": true},
+					"#shelf":      map[string]interface{}{"9": []string{}},
+				},
+			}})
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func uploadRequest(t *testing.T, filename string, fields map[string]string) *http.Request {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", filename)
+	assert.NoError(t, err)
+	fw.Write([]byte("epub-data"))
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/books/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestUploadBooks(t *testing.T) {
+	server := fakeCalibre(t)
+	defer server.Close()
+	contentApi, err := content.NewClient(server.URL, client.Auth{})
+	assert.NoError(t, err)
+	contentApi.SetRetryCount(0)
+
+	lib := newLibrary(defaultLibraryID, defaultLibraryID, true, "books")
+	api := &Api{
+		backend:        newTestEmbeddedBackend(t),
+		contentApi:     &contentApi,
+		libraries:      map[string]*library{lib.id: lib},
+		defaultLibrary: lib.id,
+	}
+	router := gin.New()
+	router.POST("/api/books/upload", api.uploadBooks)
+
+	lib.suggest.Store(newSuggestIndex(nil))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, uploadRequest(t, "新书.epub", map[string]string{"title": "新书", "tags": "科幻,小说"}))
+	assert.Equal(t, http.StatusOK, w.Code)
+	// 上传后联想索引失效，下一次查询时包含新书
+	assert.Nil(t, lib.suggest.Load())
+	var book Book
+	assert.NoError(t, api.backend.GetDocument("books", "9", &book))
+	assert.Equal(t, "新书", book.Title)
+	assert.Equal(t, []string{"科幻", "小说"}, book.Tags)
+	assert.NotZero(t, book.AddedAt)
+	assert.Equal(t, map[string]interface{}{"read": true}, book.Custom)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, uploadRequest(t, "dup.epub", nil))
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), `"duplicates"`)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, uploadRequest(t, "notes.docx", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -50,6 +50,11 @@ func main() {
 			"/favicon.ico",
 			"/assets/*",
 			"/api/book/:id/delete",
+			// 索引快照是整个索引的文件，不适合作为 MCP 工具
+			"/api/index/export",
+			"/api/index/import",
+			// 上传书籍需要 multipart 文件
+			"/api/books/upload",
 		},
 	})
 
@@ -64,9 +69,13 @@ func main() {
 
 // registerMCPSchemas 为 gin-mcp 注册 API 参数模式
 func registerMCPSchemas(mcp *ginmcp.GinMCP) {
+	// 书库列表接口
+	mcp.RegisterSchema("GET", "/api/libraries", nil, nil)
+
 	// 搜索相关接口
 	mcp.RegisterSchema("GET", "/api/search", calibre.SearchRequest{}, nil)
 	mcp.RegisterSchema("POST", "/api/search", nil, calibre.SearchRequest{})
+	mcp.RegisterSchema("GET", "/api/search/fulltext", calibre.FullTextSearchRequest{}, nil)
 
 	// 书籍管理相关接口
 	mcp.RegisterSchema("POST", "/api/book/:id/update", nil, calibre.BookUpdateRequest{})
@@ -76,11 +85,39 @@ func registerMCPSchemas(mcp *ginmcp.GinMCP) {
 
 	// 索引管理相关接口
 	mcp.RegisterSchema("POST", "/api/index/update", nil, calibre.IndexUpdateRequest{})
+	mcp.RegisterSchema("GET", "/api/index/jobs/:id", calibre.IndexJobRequest{}, nil)
+	mcp.RegisterSchema("GET", "/api/index/status", nil, nil)
+	mcp.RegisterSchema("POST", "/api/index/fulltext", nil, calibre.FullTextIndexRequest{})
 	mcp.RegisterSchema("POST", "/api/index/switch", nil, calibre.IndexSwitchRequest{})
+	mcp.RegisterSchema("GET", "/api/index/synonyms", nil, nil)
+	mcp.RegisterSchema("PUT", "/api/index/synonyms", nil, calibre.SynonymsUpdateRequest{})
+	mcp.RegisterSchema("GET", "/api/index/stopwords", nil, nil)
+	mcp.RegisterSchema("PUT", "/api/index/stopwords", nil, calibre.StopWordsUpdateRequest{})
 
 	// 出版社列表接口
 	mcp.RegisterSchema("GET", "/api/publisher", calibre.PublisherListRequest{}, nil)
 
+	// 分面统计接口
+	mcp.RegisterSchema("GET", "/api/facets", calibre.FacetsRequest{}, nil)
+
+	// 系列相关接口
+	mcp.RegisterSchema("GET", "/api/series", calibre.SeriesListRequest{}, nil)
+	mcp.RegisterSchema("GET", "/api/series/:name", calibre.SeriesBooksRequest{}, nil)
+
+	// 重复书籍接口
+	mcp.RegisterSchema("GET", "/api/duplicates", calibre.DuplicatesRequest{}, nil)
+
+	// 输入联想接口
+	mcp.RegisterSchema("GET", "/api/suggest", calibre.SuggestRequest{}, nil)
+
+	// 保存的搜索接口
+	mcp.RegisterSchema("GET", "/api/saved-searches", nil, nil)
+	mcp.RegisterSchema("POST", "/api/saved-searches", nil, calibre.SavedSearchRequest{})
+	mcp.RegisterSchema("DELETE", "/api/saved-searches/:name", calibre.SavedSearchNameParam{}, nil)
+
+	// 自定义列接口
+	mcp.RegisterSchema("GET", "/api/custom-columns", nil, nil)
+
 	// 最近书籍接口
 	mcp.RegisterSchema("GET", "/api/recently", calibre.RecentlyBooksRequest{}, nil)
 
@@ -170,6 +207,14 @@ func initConfig() *calibre.Config {
 	viper.SetDefault("staticDir", "./static")
 	viper.SetDefault("tmpDir", "/tmp")
 
+	// content 认证默认值，使 CALIBRE_CONTENT_USERNAME 等环境变量生效
+	viper.SetDefault("content.auth", "")
+	viper.SetDefault("content.username", "")
+	viper.SetDefault("content.password", "")
+
+	// 等待 Meilisearch 索引任务的超时时间（分钟）
+	viper.SetDefault("search.tasktimeout", 60)
+
 	// MCP defaults
 	viper.SetDefault("mcp.enabled", false)
 	viper.SetDefault("mcp.server_name", "calibre-mcp-server")
@@ -188,6 +233,7 @@ func initConfig() *calibre.Config {
 	if err := viper.Unmarshal(&conf); err != nil {
 		panic(fmt.Errorf("bind config failed! %w", err))
 	}
+	conf.ConfigFile = viper.ConfigFileUsed()
 	marshal, _ := json.Marshal(conf)
 	log.Infof("loaded config %s", marshal)
 	return &conf
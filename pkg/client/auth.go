@@ -0,0 +1,284 @@
+package client
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// ErrUnauthorized is returned when the server rejects the configured credentials.
+var ErrUnauthorized = errors.New("unauthorized, check the username, password or auth headers")
+
+const (
+	AuthAuto   = "auto"   // Answer whichever Digest or Basic challenge the server sends.
+	AuthBasic  = "basic"  // Send the basic credentials with every request.
+	AuthDigest = "digest" // Only answer the Digest challenge.
+)
+
+// Auth is the credential for the servers which require authentication, such as a calibre
+// content server started with --enable-auth. The credentials are only sent to Config.Host.
+type Auth struct {
+	Type     string            // One of auto, basic and digest, default to auto.
+	Username string            // The username, leave it empty if the server doesn't need one.
+	Password string            // The password for the username.
+	Headers  map[string]string // Pre-shared headers sent with every request, such as a token checked by a reverse proxy.
+}
+
+func (a Auth) enabled() bool {
+	return a.Username != "" || len(a.Headers) > 0
+}
+
+func (a Auth) validate() error {
+	switch strings.ToLower(a.Type) {
+	case "", AuthAuto, AuthBasic, AuthDigest:
+		return nil
+	}
+	return fmt.Errorf("unsupported auth type %q, we only support auto, basic or digest", a.Type)
+}
+
+// CheckAuth returns ErrUnauthorized if the server responded with 401.
+// The responses requested with SetDoNotParseResponse skip the response middleware and should be checked manually.
+func CheckAuth(resp *resty.Response) error {
+	if resp == nil || resp.StatusCode() != http.StatusUnauthorized {
+		return nil
+	}
+	return fmt.Errorf("%s %s: %w", resp.Request.Method, resp.Request.URL, ErrUnauthorized)
+}
+
+// authTransport adds the credentials to the requests for the given host and answers the auth challenges.
+type authTransport struct {
+	host string
+	auth Auth
+	next http.RoundTripper
+
+	mu        sync.Mutex
+	challenge *digestChallenge // The last digest challenge, reused until the server marks it stale.
+	basic     bool             // The server asked for basic auth before.
+}
+
+func newAuthTransport(host string, auth Auth, next http.RoundTripper) *authTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	auth.Type = strings.ToLower(auth.Type)
+	if auth.Type == "" {
+		auth.Type = AuthAuto
+	}
+	return &authTransport{host: host, auth: auth, next: next}
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != t.host {
+		return t.next.RoundTrip(req)
+	}
+	// The credentials are sent up front once the scheme is known, so only the first request
+	// and the stale nonces need to be answered by sending the request again.
+	resp, err := t.next.RoundTrip(t.prepare(req))
+	if err != nil || t.auth.Username == "" || resp.StatusCode != http.StatusUnauthorized || !t.accept(resp) {
+		return resp, err
+	}
+
+	// The body has been consumed, get a fresh one instead of buffering every request.
+	// The body which can't be replayed is not sent again and the 401 is returned.
+	retry := t.prepare(req)
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return resp, nil
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		retry.Body = body
+	}
+	resp.Body.Close()
+	return t.next.RoundTrip(retry)
+}
+
+// prepare clones the request with the auth headers.
+func (t *authTransport) prepare(req *http.Request) *http.Request {
+	r := req.Clone(req.Context())
+	for k, v := range t.auth.Headers {
+		r.Header.Set(k, v)
+	}
+	if t.auth.Username == "" {
+		return r
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch {
+	case t.auth.Type == AuthBasic || (t.basic && t.auth.Type == AuthAuto):
+		r.SetBasicAuth(t.auth.Username, t.auth.Password)
+	case t.challenge != nil:
+		t.challenge.count++
+		r.Header.Set("Authorization", t.challenge.authorize(r, t.auth.Username, t.auth.Password))
+	}
+	return r
+}
+
+// accept records the challenge in the 401 response, returns false if we can't answer it.
+func (t *authTransport) accept(resp *http.Response) bool {
+	if t.auth.Type == AuthBasic {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, header := range resp.Header.Values("WWW-Authenticate") {
+		scheme, params, _ := strings.Cut(strings.TrimSpace(header), " ")
+		switch {
+		case strings.EqualFold(scheme, "Digest"):
+			c, err := parseDigestChallenge(params)
+			if err != nil {
+				return false
+			}
+			t.challenge, t.basic = c, false
+			return true
+		case strings.EqualFold(scheme, "Basic") && t.auth.Type == AuthAuto:
+			t.challenge, t.basic = nil, true
+			return true
+		}
+	}
+	return false
+}
+
+// digestChallenge is the digest access authentication challenge defined in RFC 7616.
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+	count     int
+}
+
+func parseDigestChallenge(s string) (*digestChallenge, error) {
+	params := parseAuthParams(s)
+	c := &digestChallenge{
+		realm:     params["realm"],
+		nonce:     params["nonce"],
+		opaque:    params["opaque"],
+		algorithm: params["algorithm"],
+	}
+	if c.nonce == "" {
+		return nil, errors.New("digest challenge without nonce")
+	}
+	if qop, ok := params["qop"]; ok {
+		for _, q := range strings.Split(qop, ",") {
+			if strings.TrimSpace(q) == "auth" {
+				c.qop = "auth"
+			}
+		}
+		if c.qop == "" {
+			return nil, fmt.Errorf("unsupported digest qop %q", qop)
+		}
+	}
+	switch strings.ToUpper(c.algorithm) {
+	case "", "MD5", "MD5-SESS", "SHA-256", "SHA-256-SESS":
+	default:
+		return nil, fmt.Errorf("unsupported digest algorithm %q", c.algorithm)
+	}
+	return c, nil
+}
+
+// authorize computes the Authorization header value for the request.
+func (c *digestChallenge) authorize(req *http.Request, username, password string) string {
+	newHash := md5.New
+	algorithm := strings.ToUpper(c.algorithm)
+	if strings.HasPrefix(algorithm, "SHA-256") {
+		newHash = sha256.New
+	}
+	h := func(parts ...string) string {
+		return hashHex(newHash, strings.Join(parts, ":"))
+	}
+
+	uri := req.URL.RequestURI()
+	nc := fmt.Sprintf("%08x", c.count)
+	cnonce := randomHex(8)
+	ha1 := h(username, c.realm, password)
+	if strings.HasSuffix(algorithm, "-SESS") {
+		ha1 = h(ha1, c.nonce, cnonce)
+	}
+	ha2 := h(req.Method, uri)
+
+	var response string
+	if c.qop == "" {
+		response = h(ha1, c.nonce, ha2)
+	} else {
+		response = h(ha1, c.nonce, nc, cnonce, c.qop, ha2)
+	}
+
+	fields := []string{
+		fmt.Sprintf("username=%q", username),
+		fmt.Sprintf("realm=%q", c.realm),
+		fmt.Sprintf("nonce=%q", c.nonce),
+		fmt.Sprintf("uri=%q", uri),
+		fmt.Sprintf("response=%q", response),
+	}
+	if c.algorithm != "" {
+		fields = append(fields, "algorithm="+c.algorithm)
+	}
+	if c.opaque != "" {
+		fields = append(fields, fmt.Sprintf("opaque=%q", c.opaque))
+	}
+	if c.qop != "" {
+		fields = append(fields, "qop="+c.qop, "nc="+nc, fmt.Sprintf("cnonce=%q", cnonce))
+	}
+	return "Digest " + strings.Join(fields, ", ")
+}
+
+// parseAuthParams parses the comma separated key=value pairs, the values may be quoted.
+func parseAuthParams(s string) map[string]string {
+	params := map[string]string{}
+	for s = strings.TrimSpace(s); s != ""; {
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		rest = strings.TrimSpace(rest)
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			var b strings.Builder
+			i := 1
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+				}
+				b.WriteByte(rest[i])
+			}
+			value, rest = b.String(), rest[min(i+1, len(rest)):]
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+			rest = "," + rest
+		}
+		params[key] = strings.TrimSpace(value)
+
+		_, rest, _ = strings.Cut(rest, ",")
+		s = strings.TrimSpace(rest)
+	}
+	return params
+}
+
+func hashHex(newHash func() hash.Hash, s string) string {
+	h := newHash()
+	h.Write([]byte(s))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
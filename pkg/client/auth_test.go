@@ -0,0 +1,143 @@
+package client
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// digestServer mocks a calibre server started with --enable-auth, which checks the MD5 digest with qop=auth.
+func digestServer(t *testing.T, username, password string) *httptest.Server {
+	t.Helper()
+	md5Hex := func(s string) string {
+		sum := md5.Sum([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if strings.HasPrefix(auth, "Digest ") {
+			p := parseAuthParams(strings.TrimPrefix(auth, "Digest "))
+			ha1 := md5Hex(username + ":" + p["realm"] + ":" + password)
+			ha2 := md5Hex(r.Method + ":" + p["uri"])
+			want := md5Hex(strings.Join([]string{ha1, p["nonce"], p["nc"], p["cnonce"], p["qop"], ha2}, ":"))
+			if p["username"] == username && p["response"] == want && p["uri"] == r.URL.RequestURI() {
+				body, _ := io.ReadAll(r.Body)
+				w.Write(append([]byte("ok:"), body...))
+				return
+			}
+		}
+		w.Header().Set("WWW-Authenticate", `Digest realm="calibre", nonce="abc,123", qop="auth", algorithm="MD5", opaque="xyz"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+}
+
+func newTestClient(t *testing.T, server *httptest.Server, auth Auth) *Client {
+	t.Helper()
+	u, _ := url.Parse(server.URL)
+	c, err := New(&Config{Host: u.Host, Auth: auth})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetRetryCount(0)
+	return c
+}
+
+func TestDigestAuth(t *testing.T) {
+	server := digestServer(t, "reader", "secret")
+	defer server.Close()
+
+	c := newTestClient(t, server, Auth{Username: "reader", Password: "secret"})
+	for _, body := range []string{"", "first", "second"} {
+		resp, err := c.R().SetBody(body).Post("/cdb/cmd/list/0?library_id=library")
+		assert.NoError(t, err)
+		assert.Equal(t, "ok:"+body, resp.String())
+	}
+
+	c = newTestClient(t, server, Auth{Username: "reader", Password: "wrong"})
+	_, err := c.R().Get("/ajax/library-info")
+	assert.ErrorIs(t, err, ErrUnauthorized)
+}
+
+func TestBasicAuthAndHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "reader" || password != "secret" || r.Header.Get("X-Token") != "t0k3n" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("Authorization"), "credentials sent to another host")
+		assert.Empty(t, r.Header.Get("X-Token"), "credentials sent to another host")
+	}))
+	defer other.Close()
+
+	c := newTestClient(t, server, Auth{Type: "basic", Username: "reader", Password: "secret", Headers: map[string]string{"X-Token": "t0k3n"}})
+	resp, err := c.R().Get("/get/cover/1/library")
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", resp.String())
+	_, err = c.R().Get(other.URL + "/v2/book/isbn/1")
+	assert.NoError(t, err)
+
+	_, err = New(&Config{Host: "localhost", Auth: Auth{Type: "ntlm", Username: "reader"}})
+	assert.Error(t, err)
+}
+
+func TestCheckAuthOnlyForHost(t *testing.T) {
+	unauthorized := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	server := httptest.NewServer(unauthorized)
+	defer server.Close()
+	other := httptest.NewServer(unauthorized)
+	defer other.Close()
+
+	c := newTestClient(t, server, Auth{})
+	_, err := c.R().Get("/ajax/library-info")
+	assert.ErrorIs(t, err, ErrUnauthorized)
+
+	// The 401 from another host, such as the metadata source, is not a calibre credentials error.
+	resp, err := c.R().Get(other.URL + "/v2/book/isbn/1")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode())
+}
+
+// onlyReader hides the concrete type so that http.NewRequest can't replay the body.
+type onlyReader struct {
+	io.Reader
+}
+
+func TestDigestAuthStreamingBody(t *testing.T) {
+	server := digestServer(t, "reader", "secret")
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	transport := newAuthTransport(u.Host, Auth{Username: "reader", Password: "secret"}, nil)
+
+	post := func(body io.Reader) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/cdb/add-book/0/n/book.epub/library", body)
+		assert.NoError(t, err)
+		resp, err := transport.RoundTrip(req)
+		assert.NoError(t, err)
+		return resp
+	}
+
+	// The body can't be sent twice before the scheme is known.
+	resp := post(onlyReader{strings.NewReader("upload")})
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// Then the credentials are sent up front with the streaming body.
+	resp = post(onlyReader{strings.NewReader("upload")})
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "ok:upload", string(body))
+}
@@ -36,6 +36,7 @@ type Config struct {
 	UserAgent  string // Custom user agent for mocking as the browser client.
 	Proxy      string // The proxy address, such as the http://127.0.0.1:7890, socks://127.0.0.1:7890
 	ConfigRoot string // The root config path for whole bookhunter download service.
+	Auth       Auth   // The credentials for the servers which require authentication.
 
 	// The custom redirect function.
 	Redirect resty.RedirectPolicy `json:"-"`
@@ -171,5 +172,20 @@ func New(c *Config) (*Client, error) {
 		client.SetProxy(c.Proxy)
 	}
 
+	// The auth transport wraps the http.Transport, so it must be set after the proxy.
+	if c.Auth.enabled() {
+		if err := c.Auth.validate(); err != nil {
+			return nil, err
+		}
+		client.SetTransport(newAuthTransport(c.Host, c.Auth, client.GetClient().Transport))
+	}
+	// Only the 401 from Config.Host means the credentials are wrong, other hosts such as the metadata sources are left to the callers.
+	client.OnAfterResponse(func(_ *resty.Client, resp *resty.Response) error {
+		if resp.Request.RawRequest == nil || resp.Request.RawRequest.URL.Host != c.Host {
+			return nil
+		}
+		return CheckAuth(resp)
+	})
+
 	return &Client{Client: client, Config: c}, nil
 }
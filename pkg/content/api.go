@@ -1,22 +1,27 @@
 package content
 
 import (
-	"errors"
+	"encoding/json"
 	"fmt"
+	"github.com/go-resty/resty/v2"
 	"github.com/jianyun8023/calibre-api/pkg/client"
 	"github.com/jianyun8023/calibre-api/pkg/log"
-	"github.com/spf13/cast"
 	"io"
+	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
+// Api calibre content server 客户端。请求失败时返回 *Error，可以用 errors.Is 判断 ErrNotFound、ErrAuth 和 ErrServer；
+// 响应中部分记录无法解析时返回其余记录和 *DecodeError。
 type Api struct {
 	*client.Client
 }
 
-func NewClient(baseUrl string) (Api, error) {
+// NewClient 创建 calibre content server 客户端，auth 为服务器开启 --enable-auth 时使用的凭据
+func NewClient(baseUrl string, auth client.Auth) (Api, error) {
 
 	parsedURL, err := url.Parse(baseUrl)
 	if err != nil {
@@ -25,11 +30,12 @@ func NewClient(baseUrl string) (Api, error) {
 	api, err := client.New(&client.Config{
 		Host:  parsedURL.Host,
 		HTTPS: parsedURL.Scheme == "https",
+		Auth:  auth,
 	})
-	api.BaseURL = baseUrl
 	if err != nil {
 		return Api{}, err
 	}
+	api.BaseURL = baseUrl
 	return Api{
 		Client: api,
 	}, nil
@@ -42,23 +48,90 @@ func (a *Api) DeleteBooks(bookIds []string, library string) error {
 	///cdb/delete-books/264728/library
 	ids := strings.Join(bookIds, ",")
 	resp, err := a.R().SetPathParam("ids", ids).SetPathParam("library", library).Post("/cdb/delete-books/{ids}/{library}")
-	log.Infof(resp.Request.URL + " " + resp.Status())
-	return err
+	return checkResponse("delete books "+ids, resp, err)
+}
+
+// AddBook 将文件作为新书添加到书库，calibre 根据 filename 的扩展名识别格式并从文件中读取元数据。
+// addDuplicates 为 false 时书库中已有同名书籍不会添加，返回结果的 Duplicates 为这些书籍。
+// data 直接作为请求体发送，摘要认证的 nonce 过期需要重发时会 Seek 到开头重新读取。
+func (a *Api) AddBook(filename string, data io.ReadSeeker, addDuplicates bool, library string) (*AddBookResult, error) {
+	if library == "" {
+		library = "library"
+	}
+	///cdb/add-book/{job_id}/{add_duplicates}/{filename}/{library_id}
+	duplicates := "n"
+	if addDuplicates {
+		duplicates = "y"
+	}
+	op := "add book " + filename
+	size, err := data.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, &Error{Op: op, Kind: ErrServer, Err: err}
+	}
+	u := strings.TrimSuffix(a.BaseURL, "/") + "/cdb/add-book/0/" + duplicates + "/" + url.PathEscape(filename) + "/" + url.PathEscape(library)
+	req, err := http.NewRequest(http.MethodPost, u, nil)
+	if err != nil {
+		return nil, &Error{Op: op, Kind: ErrServer, Err: err}
+	}
+	// resty 会把请求体整个读入内存，这里直接从文件发送；认证质询需要重发请求时从头读取文件
+	req.GetBody = func() (io.ReadCloser, error) {
+		if _, err := data.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return io.NopCloser(data), nil
+	}
+	if req.Body, err = req.GetBody(); err != nil {
+		return nil, &Error{Op: op, Kind: ErrServer, Err: err}
+	}
+	req.ContentLength = size
+	for k := range a.Header {
+		req.Header.Set(k, a.Header.Get(k))
+	}
+
+	resp, err := a.GetClient().Do(req)
+	if err != nil {
+		return nil, statusError(op, 0, "", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	log.Infof("%s %s", req.URL, resp.Status)
+	if err := statusError(op, resp.StatusCode, string(body), err); err != nil {
+		return nil, err
+	}
+	var result AddBookResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, &Error{Op: op, Status: resp.StatusCode, Kind: ErrServer, Err: err}
+	}
+	return &result, nil
 }
 
+// UpdateMetaData 修改书籍的字段，返回 calibre 中受影响的书籍（书籍 ID 到元数据）
 func (a *Api) UpdateMetaData(id string, metadata map[string]interface{}, library string) (map[string]Content, error) {
 	if library == "" {
 		library = "library"
 	}
-	///cdb/delete-books/264728/library
+	///cdb/set-fields/264728/library
 	body := map[string]interface{}{
 		"changes": metadata,
 	}
 
-	var data map[string]Content
-	resp, err := a.R().SetResult(&data).SetPathParam("id", id).SetPathParam("library", library).SetBody(body).Post("/cdb/set-fields/{id}/{library}")
-	log.Infof(resp.Request.URL + " " + resp.Status())
-	return data, err
+	var raw map[string]json.RawMessage
+	resp, err := a.R().SetResult(&raw).SetPathParam("id", id).SetPathParam("library", library).SetBody(body).Post("/cdb/set-fields/{id}/{library}")
+	op := "set fields of book " + id
+	if err := checkResponse(op, resp, err); err != nil {
+		return nil, err
+	}
+	data := make(map[string]Content, len(raw))
+	var errs []error
+	for bookId, v := range raw {
+		var c Content
+		if err := json.Unmarshal(v, &c); err != nil {
+			errs = append(errs, fmt.Errorf("book %s: %w", bookId, err))
+			continue
+		}
+		data[bookId] = c
+	}
+	return data, decodeErrors(op, errs)
 }
 
 func (a *Api) GetCover(id string, library string) (int64, io.ReadCloser, error) {
@@ -67,196 +140,213 @@ func (a *Api) GetCover(id string, library string) (int64, io.ReadCloser, error)
 	}
 	///get/cover/269220/library
 	resp, err := a.R().SetDoNotParseResponse(true).SetPathParam("id", id).SetPathParam("library", library).Get("/get/cover/{id}/{library}")
-	if err != nil {
-
-		return 0, nil, err
-	}
-	response := resp.RawResponse
-	log.Infof(resp.Request.URL + " " + resp.Status())
-	return response.ContentLength, response.Body, err
+	return rawBody("get cover "+id, resp, err)
 }
 
+// GetBook 下载书籍的 EPUB 文件
 func (a *Api) GetBook(id string, library string) (int64, io.ReadCloser, error) {
+	return a.GetBookFormat(id, "EPUB", library)
+}
+
+// GetBookFormat 下载书籍指定格式的文件，format 为 calibre 中的格式名称，如 EPUB、AZW3、PDF
+func (a *Api) GetBookFormat(id, format, library string) (int64, io.ReadCloser, error) {
 	if library == "" {
 		library = "library"
 	}
 	///get/EPUB/269220/library
-	resp, err := a.R().SetDoNotParseResponse(true).SetPathParam("id", id).SetPathParam("library", library).Get("/get/EPUB/{id}/{library}")
-	if err != nil {
+	resp, err := a.R().SetDoNotParseResponse(true).
+		SetPathParam("format", format).
+		SetPathParam("id", id).
+		SetPathParam("library", library).
+		Get("/get/{format}/{id}/{library}")
+	return rawBody(fmt.Sprintf("get book %s format %s", id, format), resp, err)
+}
 
+// rawBody 返回未解析的响应体，请求失败时关闭响应体
+func rawBody(op string, resp *resty.Response, err error) (int64, io.ReadCloser, error) {
+	if err := checkResponse(op, resp, err); err != nil {
+		if resp != nil && resp.RawResponse != nil {
+			resp.RawResponse.Body.Close()
+		}
 		return 0, nil, err
 	}
-	response := resp.RawResponse
-	log.Infof(resp.Request.URL + " " + resp.Status())
-	return response.ContentLength, response.Body, err
+	return resp.RawResponse.ContentLength, resp.RawResponse.Body, nil
+}
+
+// GetLibraries 查询 calibre 服务器上的书库
+func (a *Api) GetLibraries() (*LibraryInfo, error) {
+	///ajax/library-info
+	var info LibraryInfo
+	resp, err := a.R().SetResult(&info).Get("/ajax/library-info")
+	if err := checkResponse("get library info", resp, err); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
 
+func (a *Api) GetAllBooksIds(library string) ([]int64, error) {
+	return a.SearchBooksIds("", library)
 }
 
-func (a *Api) GetAllBooksIds() ([]int64, error) {
+// SearchBooksIds 按 calibre 搜索表达式查询书籍 ID，query 为空时返回全部书籍
+func (a *Api) SearchBooksIds(query string, library string) ([]int64, error) {
+	if library == "" {
+		library = "library"
+	}
 	///ajax/search/library?num=10&offset=0&sort=id&sort_order=desc&query
-	var data map[string]interface{}
+	var data searchResponse
 	resp, err := a.R().SetResult(&data).
 		SetQueryParam("num", "9999999").
 		SetQueryParam("offset", "0").
 		SetQueryParam("sort", "id").
 		SetQueryParam("sort_order", "asc").
-		SetQueryParam("query", "").
-		Get("/ajax/search/library")
-	log.Infof(resp.Request.URL + " " + resp.Status())
-	if err != nil {
+		SetQueryParam("query", query).
+		SetPathParam("library", library).
+		Get("/ajax/search/{library}")
+	if err := checkResponse("search books", resp, err); err != nil {
 		return nil, err
 	}
-	bookIds := make([]int64, 0)
-	bookIdsInterface := data["book_ids"].([]interface{})
-	for _, id := range bookIdsInterface {
-		bookIds = append(bookIds, int64(id.(float64)))
+	if data.BookIDs == nil {
+		return []int64{}, nil
 	}
-	return bookIds, nil
+	return data.BookIDs, nil
 }
 
-func (a *Api) GetAllPublisher() ([]string, error) {
+func (a *Api) GetAllPublisher(library string) ([]string, error) {
+	if library == "" {
+		library = "library"
+	}
 	///interface-data/field-names/publisher?library_id=library
 	var publishers []string
 	resp, err := a.R().SetResult(&publishers).
-		SetQueryParam("library_id", "library").
+		SetQueryParam("library_id", library).
 		Get("/interface-data/field-names/publisher")
-	log.Infof(resp.Request.URL + " " + resp.Status())
-	return publishers, err
+	if err := checkResponse("get publishers", resp, err); err != nil {
+		return nil, err
+	}
+	return publishers, nil
 }
 
-func (a *Api) GetBookMetaDatas(ids []int64, library string) ([]Book, error) {
+// GetBookMetaDatas 查询 ids 范围内的书籍元数据，columns 为需要同时读取的自定义列
+func (a *Api) GetBookMetaDatas(ids []int64, library string, columns ...CustomColumn) ([]Book, error) {
+	if len(ids) == 0 {
+		return []Book{}, nil
+	}
+	return a.listBooks("id:>="+strconv.FormatInt(ids[0], 10)+" and id:<="+strconv.FormatInt(ids[len(ids)-1], 10), library, columns)
+}
+
+// GetBookMetaDatasSince 查询 last_modified 不早于 since 的书籍元数据。
+// calibre 的日期搜索按天比较，因此结果会包含 since 当天的全部修改。
+func (a *Api) GetBookMetaDatasSince(since time.Time, library string, columns ...CustomColumn) ([]Book, error) {
+	return a.listBooks("last_modified:>="+since.Format("2006-01-02"), library, columns)
+}
+
+// listBooks 查询书籍元数据。某本书的字段无法解析时跳过该字段，书籍仍然返回，错误汇总在 *DecodeError 中。
+func (a *Api) listBooks(query string, library string, columns []CustomColumn) ([]Book, error) {
 	///cdb/cmd/list/0
 	if library == "" {
 		library = "library"
 	}
+	fields := []string{
+		"id",
+		"title",
+		"authors",
+		"comments",
+		"size",
+		"publisher",
+		"pubdate",
+		"last_modified",
+		"timestamp",
+		"isbn",
+		"tags",
+		"rating",
+		"identifiers",
+		"languages",
+		"series",
+		"series_index",
+		"formats",
+	}
+	for _, column := range columns {
+		fields = append(fields, column.listField())
+	}
 	body := []interface{}{
-		[]string{
-			"id",
-			"title",
-			"authors",
-			"comments",
-			"size",
-			"publisher",
-			"pubdate",
-			"isbn",
-			"tags",
-			"rating",
-			"identifiers",
-			"languages",
-		},
+		fields,
 		"id",
 		"True",
-		"id:>=" + strconv.FormatInt(ids[0], 10) + " and id:<=" + strconv.FormatInt(ids[len(ids)-1], 10),
+		query,
 		-1,
 	}
 
-	var data map[string]interface{}
-	resp, err := a.R().SetResult(&data).SetBody(body).Post("/cdb/cmd/list/0")
-	log.Infof(resp.Request.URL + " " + resp.Status())
-	if err != nil {
+	var data listResponse
+	resp, err := a.R().SetResult(&data).SetBody(body).SetQueryParam("library_id", library).Post("/cdb/cmd/list/0")
+	op := "list books " + query
+	if err := checkResponse(op, resp, err); err != nil {
 		return nil, err
 	}
-
-	if data["err"] != nil {
-		errMsg := data["err"].(string)
-		log.Warn("error: " + errMsg)
-		return nil, errors.New("error: " + errMsg)
+	if data.Err != "" {
+		return nil, &Error{Op: op, Status: resp.StatusCode(), Kind: ErrServer, Err: fmt.Errorf("%s", data.Err)}
 	}
 
-	data = data["result"].(map[string]interface{})
-
-	books := make([]Book, 0)
-	bookIdsInterface := data["book_ids"].([]interface{})
-
-	bookData := data["data"].(map[string]interface{})
-	titleMap := cast.ToStringMapString(bookData["title"])
-	authorsMap := cast.ToStringMapStringSlice(bookData["authors"])
-	commentsMap := cast.ToStringMapString(bookData["comments"])
-	sizeMap := cast.ToStringMapInt64(bookData["size"])
-	publisherMap := cast.ToStringMapString(bookData["publisher"])
-
-	pubdateMap := bookData["pubdate"].(map[string]interface{})
-
-	isbnMap := cast.ToStringMapString(bookData["isbn"])
-
-	tagsMap := cast.ToStringMapStringSlice(bookData["tags"])
-	ratingMap := cast.ToStringMap(bookData["rating"])
-
-	identifiersMap := bookData["identifiers"].(map[string]interface{})
-	languagesMap := cast.ToStringMapStringSlice(bookData["languages"])
-	for _, id := range bookIdsInterface {
-		book := Book{}
-		book.ID = int64(id.(float64))
-		strId := strconv.FormatInt(book.ID, 10)
-		book.Title = titleMap[strId]
-		book.Authors = authorsMap[strId]
-		book.Comments = commentsMap[strId]
-		book.Size = sizeMap[strId]
-		book.Publisher = publisherMap[strId]
-		m := pubdateMap[strId].(map[string]interface{})
-		if m["v"] != nil {
-			book.PubDate = cast.ToTime(m["v"])
-		}
-		book.Isbn = isbnMap[strId]
-		book.Tags = tagsMap[strId]
-		book.Rating = cast.ToFloat64(ratingMap[strId])
-		book.Identifiers = cast.ToStringMapString(identifiersMap[strId])
-		book.Languages = languagesMap[strId]
+	books := make([]Book, 0, len(data.Result.BookIDs))
+	var errs []error
+	for _, id := range data.Result.BookIDs {
+		book, bookErrs := decodeBook(id, data.Result.Data, columns)
+		errs = append(errs, bookErrs...)
 		books = append(books, book)
 	}
-	return books, nil
+	return books, decodeErrors(op, errs)
 }
 
-func convertIntMap(input map[string]interface{}) (map[string]int, error) {
-	result := make(map[string]int)
-	for k, v := range input {
-
-		if v == nil {
-			result[k] = 0
-		} else {
-			floatVal, ok := v.(float64)
-			if !ok {
-				return nil, fmt.Errorf("value for key %s is not of type float64", k)
-			}
-			result[k] = int(floatVal)
+// decodeBook 从 cmd/list 的结果中解析一本书，返回无法解析的字段的错误
+func decodeBook(id int64, data map[string]map[string]json.RawMessage, columns []CustomColumn) (Book, []error) {
+	strId := strconv.FormatInt(id, 10)
+	var errs []error
+	field := func(name string, v interface{}) {
+		raw, ok := data[name][strId]
+		if !ok || string(raw) == "null" {
+			return
 		}
-	}
-	return result, nil
-}
-
-func convertStringMap(input map[string]interface{}) (map[string]string, error) {
-
-	result := make(map[string]string)
-	for k, v := range input {
-		if v == nil {
-			result[k] = ""
-			continue
-		} else {
-			strVal, ok := v.(string)
-			if !ok {
-				return nil, fmt.Errorf("value for key %s is not of type string", k)
-			}
-			result[k] = strVal
+		if err := json.Unmarshal(raw, v); err != nil {
+			errs = append(errs, fmt.Errorf("book %d field %s: %w", id, name, err))
 		}
 	}
-	return result, nil
-}
-
-func convertInt64Map(input map[string]interface{}) (map[string]int64, error) {
+	date := func(name string) time.Time {
+		var t calibreTime
+		field(name, &t)
+		return t.Time
+	}
 
-	result := make(map[string]int64)
-	for k, v := range input {
-		if v == nil {
-			result[k] = 0
-			continue
-		} else {
-			float64Val, ok := v.(float64)
-			if !ok {
-				return nil, fmt.Errorf("value for key %s is not of type int64", k)
+	book := Book{ID: id}
+	field("title", &book.Title)
+	field("authors", &book.Authors)
+	field("comments", &book.Comments)
+	field("size", &book.Size)
+	field("publisher", &book.Publisher)
+	book.PubDate = date("pubdate")
+	book.LastModified = date("last_modified")
+	book.Timestamp = date("timestamp")
+	field("isbn", &book.Isbn)
+	field("tags", &book.Tags)
+	field("rating", &book.Rating)
+	field("identifiers", &book.Identifiers)
+	if book.Identifiers == nil {
+		book.Identifiers = map[string]string{}
+	}
+	field("languages", &book.Languages)
+	field("series", &book.Series)
+	if book.Series != "" {
+		field("series_index", &book.SeriesIndex)
+	}
+	field("formats", &book.Formats)
+	for _, column := range columns {
+		var raw interface{}
+		field(column.Key, &raw)
+		if v := column.Value(raw); v != nil {
+			if book.Custom == nil {
+				book.Custom = map[string]interface{}{}
 			}
-			result[k] = int64(float64Val)
+			book.Custom[column.Label] = v
 		}
 	}
-	return result, nil
-
+	return book, errs
 }
@@ -0,0 +1,144 @@
+package content
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jianyun8023/calibre-api/pkg/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestApi(t *testing.T, handler http.HandlerFunc) Api {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	api, err := NewClient(server.URL, client.Auth{})
+	assert.NoError(t, err)
+	return api
+}
+
+func TestListBooksDecodeError(t *testing.T) {
+	api := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"result": {"book_ids": [1, 2, 3], "data": {
+			"title": {"1": "三体", "2": "球状闪电", "3": 42},
+			"pubdate": {"1": {"t": "datetime", "v": "2008-01-01T00:00:00+00:00"}, "2": {"t": "datetime", "v": "not a date"}, "3": null},
+			"identifiers": {"1": {"isbn": "9787536692930"}},
+			"series": {"1": "地球往事"},
+			"series_index": {"1": 1.0, "2": 3.0},
+			"#read": {"1": true}
+		}}}`))
+	})
+
+	books, err := api.GetBookMetaDatas([]int64{1, 3}, "", CustomColumn{Key: "#read", Label: "read", Datatype: "bool"})
+	var decodeErr *DecodeError
+	assert.True(t, errors.As(err, &decodeErr))
+	assert.Len(t, decodeErr.Records, 2)
+
+	assert.Len(t, books, 3)
+	assert.Equal(t, "三体", books[0].Title)
+	assert.Equal(t, time.Date(2008, 1, 1, 0, 0, 0, 0, time.UTC), books[0].PubDate.UTC())
+	assert.Equal(t, "9787536692930", books[0].Identifiers["isbn"])
+	assert.Equal(t, 1.0, books[0].SeriesIndex)
+	assert.Equal(t, true, books[0].Custom["read"])
+
+	assert.Equal(t, "球状闪电", books[1].Title)
+	assert.True(t, books[1].PubDate.IsZero())
+	assert.Equal(t, 0.0, books[1].SeriesIndex)
+	assert.NotNil(t, books[1].Identifiers)
+
+	assert.Equal(t, int64(3), books[2].ID)
+	assert.Empty(t, books[2].Title)
+}
+
+func TestListBooksServerError(t *testing.T) {
+	api := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"err": "Invalid search expression", "tb": "..."}`))
+	})
+	_, err := api.GetBookMetaDatasSince(time.Now(), "")
+	assert.ErrorIs(t, err, ErrServer)
+	assert.ErrorContains(t, err, "Invalid search expression")
+}
+
+func TestResponseErrors(t *testing.T) {
+	tests := []struct {
+		status int
+		want   error
+	}{
+		{http.StatusNotFound, ErrNotFound},
+		{http.StatusUnauthorized, ErrAuth},
+		{http.StatusForbidden, ErrAuth},
+		{http.StatusInternalServerError, ErrServer},
+	}
+	for _, tt := range tests {
+		api := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "no book with id: 7", tt.status)
+		})
+		_, _, err := api.GetBookFormat("7", "EPUB", "")
+		assert.ErrorIs(t, err, tt.want, tt.status)
+		_, err = api.SearchBooksIds("", "")
+		assert.ErrorIs(t, err, tt.want, tt.status)
+		_, err = api.UpdateMetaData("7", map[string]interface{}{"title": "x"}, "")
+		assert.ErrorIs(t, err, tt.want, tt.status)
+	}
+
+	api := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"7": {"title": "三体"}, "8": {"title": ["x"]}}`))
+	})
+	data, err := api.UpdateMetaData("7", map[string]interface{}{"title": "三体"}, "")
+	assert.Equal(t, "三体", data["7"].Title)
+	var decodeErr *DecodeError
+	assert.True(t, errors.As(err, &decodeErr))
+	assert.Len(t, decodeErr.Records, 1)
+}
+
+func TestAddBookStaleNonce(t *testing.T) {
+	// 模拟 calibre 的摘要认证：每个 nonce 只接受一次，之后返回 stale=true 和新的 nonce
+	var mu sync.Mutex
+	nonce, used := 1, map[int]bool{}
+	var uploads []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		body, _ := io.ReadAll(r.Body)
+		auth := r.Header.Get("Authorization")
+		current := fmt.Sprintf(`nonce="n%d"`, nonce)
+		if strings.HasPrefix(auth, "Digest ") && strings.Contains(auth, current) && !used[nonce] {
+			used[nonce] = true
+			if r.URL.Path == "/cdb/add-book/0/n/书.epub/library" {
+				uploads = append(uploads, string(body))
+				w.Write([]byte(`{"title":"书","book_id":7}`))
+				return
+			}
+			w.Write([]byte(`{"library_map":{"library":"Library"},"default_library":"library"}`))
+			return
+		}
+		stale := used[nonce]
+		if stale {
+			nonce++
+		}
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Digest realm="calibre", nonce="n%d", qop="auth", stale=%t`, nonce, stale))
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+	api, err := NewClient(server.URL, client.Auth{Username: "reader", Password: "secret"})
+	assert.NoError(t, err)
+	api.SetRetryCount(0)
+
+	// 第一个请求拿到 nonce，上传时 nonce 已经用过，需要带着文件重发一次
+	_, err = api.GetLibraries()
+	assert.NoError(t, err)
+	result, err := api.AddBook("书.epub", strings.NewReader("epub-data"), false, "")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), result.BookID)
+	assert.Equal(t, []string{"epub-data"}, uploads)
+}
@@ -0,0 +1,86 @@
+package content
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/spf13/cast"
+)
+
+// GetCustomColumns 查询书库的自定义列定义，按 Key 排序
+func (a *Api) GetCustomColumns(library string) ([]CustomColumn, error) {
+	if library == "" {
+		library = "library"
+	}
+	///ajax/field-metadata/library
+	var fields map[string]map[string]interface{}
+	resp, err := a.R().SetResult(&fields).SetPathParam("library", library).Get("/ajax/field-metadata/{library}")
+	if err := checkResponse("get field metadata", resp, err); err != nil {
+		return nil, err
+	}
+
+	columns := make([]CustomColumn, 0)
+	for key, field := range fields {
+		if !strings.HasPrefix(key, "#") || !cast.ToBool(field["is_custom"]) {
+			continue
+		}
+		// calibre 为系列列额外生成 #name_index 字段，它不是独立的列
+		if strings.HasSuffix(key, "_index") && fields[strings.TrimSuffix(key, "_index")] != nil {
+			continue
+		}
+		columns = append(columns, CustomColumn{
+			Key:        key,
+			Label:      strings.TrimPrefix(key, "#"),
+			Name:       cast.ToString(field["name"]),
+			Datatype:   cast.ToString(field["datatype"]),
+			IsMultiple: len(cast.ToStringMap(field["is_multiple"])) > 0,
+			IsEditable: cast.ToBool(field["is_editable"]) && field["datatype"] != "composite",
+		})
+	}
+	sort.Slice(columns, func(i, j int) bool {
+		return columns[i].Key < columns[j].Key
+	})
+	return columns, nil
+}
+
+// listField cdb/cmd/list 请求自定义列时使用 * 代替 #
+func (c CustomColumn) listField() string {
+	return "*" + c.Label
+}
+
+// Value 按列的类型转换 calibre 返回的值：bool 为 bool，int 为 int64，float 和 rating 为 float64，
+// datetime 为 unix 时间戳（秒），多值列为 []string，其他为 string。没有值时返回 nil。
+func (c CustomColumn) Value(v interface{}) interface{} {
+	if m, ok := v.(map[string]interface{}); ok {
+		v = m["v"]
+	}
+	if v == nil {
+		return nil
+	}
+	switch c.Datatype {
+	case "bool":
+		return cast.ToBool(v)
+	case "int":
+		return cast.ToInt64(v)
+	case "float", "rating":
+		return cast.ToFloat64(v)
+	case "datetime":
+		t, err := cast.ToTimeE(v)
+		// calibre 使用 0101 年表示未设置的日期
+		if err != nil || t.Year() <= 101 {
+			return nil
+		}
+		return t.Unix()
+	}
+	if c.IsMultiple {
+		values := cast.ToStringSlice(v)
+		if len(values) == 0 {
+			return nil
+		}
+		return values
+	}
+	if s := cast.ToString(v); s != "" {
+		return s
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package content
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/jianyun8023/calibre-api/pkg/client"
+	"github.com/jianyun8023/calibre-api/pkg/log"
+)
+
+var (
+	// ErrNotFound 书籍、书库或文件不存在
+	ErrNotFound = errors.New("calibre: not found")
+	// ErrAuth calibre 拒绝了认证信息，需要检查 content 的认证配置
+	ErrAuth = errors.New("calibre: authentication failed")
+	// ErrServer calibre 无法访问、返回了错误或无法解析的响应
+	ErrServer = errors.New("calibre: server error")
+)
+
+// Error content server 请求失败，Kind 为 ErrNotFound、ErrAuth 或 ErrServer，可以用 errors.Is 判断
+type Error struct {
+	Op     string // 请求的操作，如 list books
+	Status int    // HTTP 状态码，请求没有得到响应时为 0
+	Kind   error
+	Err    error // 原始错误或 calibre 返回的错误信息
+}
+
+func (e *Error) Error() string {
+	msg := e.Op + ": " + e.Kind.Error()
+	if e.Status != 0 {
+		msg += fmt.Sprintf(" (%d)", e.Status)
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// DecodeError 响应中部分记录无法解析，其余记录照常返回，Records 为每条记录的错误
+type DecodeError struct {
+	Op      string
+	Records []error
+}
+
+func (e *DecodeError) Error() string {
+	const maxShown = 3
+	shown := make([]string, 0, maxShown)
+	for _, err := range e.Records[:min(len(e.Records), maxShown)] {
+		shown = append(shown, err.Error())
+	}
+	msg := fmt.Sprintf("%s: %d records failed to decode: %s", e.Op, len(e.Records), strings.Join(shown, "; "))
+	if len(e.Records) > maxShown {
+		msg += "; ..."
+	}
+	return msg
+}
+
+// decodeErrors 没有解析失败的记录时返回 nil
+func decodeErrors(op string, records []error) error {
+	if len(records) == 0 {
+		return nil
+	}
+	return &DecodeError{Op: op, Records: records}
+}
+
+// checkResponse 记录请求日志，把请求错误和失败的响应转换为 *Error
+func checkResponse(op string, resp *resty.Response, err error) error {
+	if resp == nil || resp.RawResponse == nil {
+		return statusError(op, 0, "", err)
+	}
+	log.Infof("%s %s", resp.Request.URL, resp.Status())
+	return statusError(op, resp.StatusCode(), resp.String(), err)
+}
+
+// statusError 把请求错误和失败的状态码转换为 *Error，body 为响应体，SetDoNotParseResponse 的请求没有读取响应体
+func statusError(op string, status int, body string, err error) error {
+	switch {
+	case errors.Is(err, client.ErrUnauthorized):
+		return &Error{Op: op, Status: status, Kind: ErrAuth, Err: err}
+	case err != nil:
+		return &Error{Op: op, Status: status, Kind: ErrServer, Err: err}
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return &Error{Op: op, Status: status, Kind: ErrAuth}
+	case status == http.StatusNotFound:
+		return &Error{Op: op, Status: status, Kind: ErrNotFound, Err: responseMessage(body)}
+	case status >= http.StatusBadRequest:
+		return &Error{Op: op, Status: status, Kind: ErrServer, Err: responseMessage(body)}
+	}
+	return nil
+}
+
+// responseMessage calibre 在响应体中返回错误原因
+func responseMessage(body string) error {
+	msg := strings.TrimSpace(body)
+	if msg == "" {
+		return nil
+	}
+	if len(msg) > 200 {
+		msg = strings.ToValidUTF8(msg[:200], "") + "..."
+	}
+	return errors.New(msg)
+}
@@ -1,6 +1,11 @@
 package content
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/spf13/cast"
+)
 
 type Content struct {
 	Formats             []string          `json:"formats"`
@@ -13,6 +18,7 @@ type Content struct {
 	Comments            string            `json:"comments"`
 	LastModified        time.Time         `json:"last_modified"`
 	PubDate             time.Time         `json:"pubdate"`
+	Series              string            `json:"series"`
 	SeriesIndex         float64           `json:"series_index"`
 	Sort                string            `json:"sort"`
 	Size                int64             `json:"size"`
@@ -36,13 +42,50 @@ type Book struct {
 	Languages    []string          `json:"languages"`
 	LastModified time.Time         `json:"last_modified"`
 	PubDate      time.Time         `json:"pubdate"`
+	Timestamp    time.Time         `json:"timestamp"`
 	Publisher    string            `json:"publisher"`
+	Series       string            `json:"series"`
 	SeriesIndex  float64           `json:"series_index"`
 	Size         int64             `json:"size"`
 	Tags         []string          `json:"tags"`
 	Rating       float64           `json:"rating"`
 	Title        string            `json:"title"`
 	Identifiers  map[string]string `json:"identifiers"`
+	Formats      []string          `json:"formats"`
+	// Custom 自定义列的值，键为不带 # 的列名，见 CustomColumn.Value
+	Custom map[string]interface{} `json:"custom,omitempty"`
+}
+
+// CustomColumn calibre 自定义列的定义，Key 为带 # 的字段名，如 #read，Label 为不带 # 的列名
+type CustomColumn struct {
+	Key        string `json:"key"`
+	Label      string `json:"label"`
+	Name       string `json:"name"`
+	Datatype   string `json:"datatype"`
+	IsMultiple bool   `json:"is_multiple"`
+	IsEditable bool   `json:"is_editable"`
+}
+
+// LibraryInfo calibre 服务器的书库信息，LibraryMap 为书库 ID 到名称的映射
+type LibraryInfo struct {
+	LibraryMap     map[string]string `json:"library_map"`
+	DefaultLibrary string            `json:"default_library"`
+}
+
+// AddBookResult /cdb/add-book 的返回结果，BookID 为 0 时表示书库中已有同名书籍，Duplicates 为这些书籍
+type AddBookResult struct {
+	Title      string      `json:"title"`
+	Authors    []string    `json:"authors"`
+	Languages  []string    `json:"languages"`
+	Filename   string      `json:"filename"`
+	BookID     int64       `json:"book_id"`
+	Duplicates []Duplicate `json:"duplicates"`
+}
+
+// Duplicate 书库中与上传文件同名的书籍
+type Duplicate struct {
+	Title   string   `json:"title"`
+	Authors []string `json:"authors"`
 }
 
 type FormatSizes struct {
@@ -56,3 +99,43 @@ type Identifiers struct {
 type LangNames struct {
 	Zho string `json:"zho"`
 }
+
+// listResponse /cdb/cmd/list 的响应，Err 不为空表示 calibre 执行失败。
+// Data 为字段名到书籍 ID 到字段值的映射，字段值按书籍逐个解析，单个书籍的错误不影响其他书籍。
+type listResponse struct {
+	Err    string `json:"err"`
+	Result struct {
+		BookIDs []int64                               `json:"book_ids"`
+		Data    map[string]map[string]json.RawMessage `json:"data"`
+	} `json:"result"`
+}
+
+// searchResponse /ajax/search 的响应
+type searchResponse struct {
+	TotalNum int64   `json:"total_num"`
+	BookIDs  []int64 `json:"book_ids"`
+}
+
+// calibreTime cmd/list 中的日期，远程调用时为 {"t": "datetime", "v": "..."}，也兼容直接返回的字符串
+type calibreTime struct {
+	time.Time
+}
+
+func (t *calibreTime) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	if m, ok := v.(map[string]interface{}); ok {
+		v = m["v"]
+	}
+	if v == nil {
+		return nil
+	}
+	parsed, err := cast.ToTimeE(v)
+	if err != nil {
+		return err
+	}
+	t.Time = parsed
+	return nil
+}
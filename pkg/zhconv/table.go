@@ -0,0 +1,95 @@
+package zhconv
+
+// t2s 繁体字到简体字的单字映射，每两个字符为一组（繁体、简体），按繁体字的码位排序。
+// 收录《简化字总表》中的常用字以及常见的异体字，一繁对多简且需要依赖上下文的字（如“乾”“著”）不做转换。
+const t2s = "" +
+	"佈布佔占併并來来俠侠倆俩倉仓個个們们倖幸倫伦偉伟側侧偵侦偽伪傑杰傖伧傘伞備备傭佣" +
+	"傳传傴伛債债傷伤傾倾僂偻僅仅僑侨僕仆僥侥僨偾僱雇價价儀仪儂侬億亿儈侩儉俭儐傧儔俦" +
+	"儕侪儘尽償偿優优儲储儷俪儺傩儻傥儼俨兇凶兌兑兒儿兗兖內内兩两冊册冪幂凈净凍冻凜凛" +
+	"凱凯別别刪删剄刭則则剋克剎刹剗刬剛刚剮剐剴剀創创剷铲劃划劇剧劉刘劊刽劌刿劍剑劑剂" +
+	"勁劲動动務务勛勋勝胜勞劳勢势勱劢勳勋勵励勸劝勻匀匭匦匯汇匱匮區区協协卹恤卻却厙厍" +
+	"厠厕厭厌厲厉厴厣參参叢丛吳吴吶呐呂吕咼呙員员唄呗唚吣問问啞哑啟启喚唤喪丧喬乔單单" +
+	"喲哟嗆呛嗇啬嗎吗嗚呜嗩唢嘆叹嘍喽嘔呕嘖啧嘗尝嘩哗嘮唠嘯啸嘰叽嘵哓嘸呒噁恶噓嘘噝咝" +
+	"噠哒噥哝噦哕噯嗳噲哙噴喷噸吨噹当嚀咛嚇吓嚌哜嚐尝嚕噜嚦呖嚨咙嚮向嚳喾嚴严嚶嘤嚻嚣" +
+	"囀啭囁嗫囂嚣囅冁囈呓囉啰囌苏囑嘱囪囱圇囵國国圍围園园圓圆圖图團团執执堅坚堊垩堖垴" +
+	"堝埚堯尧報报場场塊块塋茔塏垲塒埘塗涂塢坞塤埙塵尘塹堑墊垫墜坠墮堕墳坟墻墙墾垦壇坛" +
+	"壎埙壓压壘垒壙圹壚垆壞坏壟垄壢坜壩坝壯壮壺壶壽寿夠够夢梦夥伙夾夹奐奂奧奥奩奁奪夺" +
+	"奬奖奮奋奼姹妝妆妳你姍姗姦奸娛娱婁娄婦妇婭娅媧娲媯妫媼媪媽妈嫗妪嫵妩嫻娴嬈娆嬋婵" +
+	"嬌娇嬙嫱嬡嫒嬤嬷嬪嫔嬰婴嬸婶孃娘孌娈孫孙學学孿孪寢寝實实寧宁審审寫写寬宽寵宠寶宝" +
+	"將将專专尋寻對对導导尷尴屆届屍尸屓屃屜屉屢屡層层屨屦屬属岡冈峴岘島岛峽峡崍崃崑昆" +
+	"崗岗崢峥崬岽嵐岚嶁嵝嶄崭嶇岖嶔嵚嶗崂嶠峤嶧峄嶴岙嶸嵘嶺岭嶼屿巋岿巒峦巔巅巖岩巰巯" +
+	"帥帅師师帳帐帶带幀帧幃帏幗帼幘帻幟帜幣币幫帮幬帱幹干幾几庫库廁厕廂厢廄厩廈厦廚厨" +
+	"廝厮廟庙廠厂廡庑廢废廣广廩廪廬庐廳厅弒弑弔吊弳弪張张強强彆别彈弹彊强彌弥彎弯彙汇" +
+	"彥彦彫雕後后徑径從从徠徕復复徬彷徵征徹彻恆恒恥耻悅悦悵怅悶闷悽凄惡恶惱恼惲恽惻恻" +
+	"愛爱愜惬愨悫愴怆愷恺愾忾慄栗慇殷態态慍愠慘惨慚惭慟恸慣惯慪怄慫怂慮虑慳悭慶庆慼戚" +
+	"慾欲憂忧憊惫憐怜憑凭憒愦憖慭憚惮憤愤憫悯憮怃憲宪憶忆懇恳應应懌怿懍懔懟怼懣懑懨恹" +
+	"懲惩懶懒懷怀懸悬懺忏懼惧懾慑戀恋戇戆戩戬戯戏戰战戲戏戶户拋抛挾挟捨舍捫扪捲卷掃扫" +
+	"掄抡掙挣掛挂採采揀拣揚扬換换揮挥揹背損损搖摇搗捣搵揾搶抢摑掴摜掼摟搂摯挚摳抠摶抟" +
+	"摻掺撈捞撏挦撐撑撓挠撚捻撟挢撢掸撣掸撥拨撫抚撲扑撳揿撻挞撾挝撿捡擁拥擄掳擇择擊击" +
+	"擋挡擔担據据擠挤擬拟擰拧擱搁擲掷擴扩擷撷擺摆擻擞擼撸擾扰攄摅攆撵攏拢攔拦攖撄攙搀" +
+	"攛撺攜携攝摄攢攒攣挛攤摊攪搅攬揽敍叙敗败敘叙敵敌數数斂敛斃毙斕斓斬斩斷断於于旂旗" +
+	"旛幡昇升時时晉晋晝昼暈晕暉晖暢畅暫暂暱昵曄晔曆历曇昙曉晓曖暧曠旷曨昽曬晒書书會会" +
+	"朧胧朮术東东枴拐柵栅桿杆梔栀梘枧條条梟枭棄弃棖枨棗枣棟栋棧栈棲栖楊杨楓枫楨桢業业" +
+	"極极榪杩榮荣榿桤構构槍枪槓杠槧椠槳桨樁桩樂乐樅枞樓楼標标樞枢樣样樸朴樹树樺桦橈桡" +
+	"橋桥機机橢椭檔档檜桧檢检檣樯檯台檳槟檸柠櫃柜櫓橹櫚榈櫛栉櫥橱櫧槠櫨栌櫸榉櫻樱欄栏" +
+	"權权欏椤欒栾欖榄欞棂歐欧歟欤歡欢歲岁歷历歸归殘残殤殇殫殚殮殓殯殡殲歼殺杀殼壳毀毁" +
+	"毆殴氈毡氣气氫氢氬氩氳氲汙污決决沒没沖冲況况洩泄洶汹涇泾涼凉淒凄淚泪淥渌淪沦淵渊" +
+	"淶涞淺浅渙涣減减渦涡測测渾浑湊凑湞浈湧涌湯汤溈沩準准溝沟溫温溼湿滄沧滅灭滌涤滎荥" +
+	"滬沪滯滞滷卤滸浒滻浐滾滚滿满漁渔漊溇漚沤漢汉漣涟漬渍漲涨漵溆漸渐漿浆潁颍潑泼潔洁" +
+	"潛潜潤润潯浔潰溃澀涩澆浇澗涧澠渑澤泽澦滪澮浍澱淀濁浊濃浓濕湿濘泞濟济濤涛濫滥濰潍" +
+	"濱滨濺溅濼泺濾滤瀅滢瀆渎瀉泻瀋沈瀏浏瀕濒瀘泸瀝沥瀟潇瀧泷瀨濑瀾澜灃沣灄滠灑洒灘滩" +
+	"灝灏灣湾灤滦灧滟災灾為为烏乌烴烃無无煉炼煒炜煙烟煢茕煩烦熒荧熗炝熱热燁烨燈灯燉炖" +
+	"燒烧燙烫燜焖營营燦灿燭烛燴烩燼烬燾焘爍烁爐炉爛烂爭争爲为爺爷爾尔牆墙牘牍牽牵犖荦" +
+	"犛牦犢犊犧牺狀状狹狭狽狈猙狰猶犹猻狲獁犸獃呆獄狱獅狮獎奖獨独獲获獵猎獷犷獸兽獻献" +
+	"獼猕玨珏現现琺珐琿珲瑋玮瑣琐瑤瑶瑪玛璉琏璣玑璦瑷環环璽玺瓊琼瓏珑瓔璎甌瓯甕瓮產产" +
+	"畝亩畢毕畫画異异當当疇畴疊叠痙痉瘋疯瘓痪瘞瘗瘡疮瘧疟瘺瘘療疗癆痨癇痫癉瘅癒愈癘疠" +
+	"癟瘪癡痴癢痒癤疖癥症癧疬癩癞癬癣癮瘾癰痈癱瘫癲癫發发皚皑皸皲皺皱盃杯盜盗盞盏盡尽" +
+	"監监盤盘盧卢盪荡眥眦眾众睏困睜睁睞睐瞇眯瞞瞒瞼睑矓眬矚瞩矯矫砲炮碩硕碭砀確确碼码" +
+	"磚砖磯矶礎础礙碍礦矿礪砺礫砾礬矾祕秘祿禄禍祸禎祯禦御禪禅禮礼禱祷禿秃秈籼稅税稈秆" +
+	"稜棱稟禀種种稱称穀谷穌稣積积穎颖穩稳穫获窩窝窪洼窮穷窯窑竄窜竅窍竇窦竊窃竪竖競竞" +
+	"筆笔筍笋筧笕箇个箋笺箏筝節节範范築筑篋箧篤笃篩筛篳筚簍篓簞箪簡简簫箫簽签簾帘籃篮" +
+	"籌筹籜箨籟籁籠笼籤签籬篱糞粪糧粮糰团糴籴糶粜糹纟糾纠紀纪紂纣約约紅红紇纥紈纨紉纫" +
+	"紋纹納纳紐纽紓纾純纯紗纱紙纸級级紛纷紜纭紡纺紬绸紮扎細细紳绅紹绍紺绀紼绋絀绌終终" +
+	"組组絆绊絎绗結结絕绝絞绞絡络給给絨绒統统絲丝絳绛絹绢綁绑綃绡綈绨綏绥經经綜综綠绿" +
+	"綢绸綫线綬绶維维綰绾綱纲網网綴缀綸纶綹绺綺绮綻绽綾绫綿绵緄绲緊紧緋绯緒绪緗缃緘缄" +
+	"緙缂線线緝缉緞缎締缔緡缗緣缘緦缌編编緩缓緬缅緯纬緱缑緲缈練练緶缏緻致縈萦縉缙縊缢" +
+	"縐绉縑缣縛缚縝缜縞缟縟缛縣县縫缝縭缡縮缩縱纵縵缦縷缕縹缥總总績绩繃绷繅缫繆缪繒缯" +
+	"織织繕缮繚缭繞绕繡绣繢缋繩绳繪绘繭茧繯缳繰缲繳缴繹绎繼继繽缤纈缬纊纩續续纏缠纓缨" +
+	"纔才纖纤纘缵纜缆罈坛罰罚罵骂罷罢羅罗羆罴羈羁羋芈羥羟羨羡義义習习翬翚翹翘耮耢聖圣" +
+	"聞闻聯联聰聪聲声聳耸聶聂職职聹聍聽听肅肃脅胁脈脉脹胀腎肾腦脑腫肿腳脚膃腽膚肤膠胶" +
+	"膩腻膽胆膾脍膿脓臉脸臍脐臏膑臘腊臚胪臟脏臨临臺台與与興兴舉举舊旧舖铺艙舱艤舣艦舰" +
+	"艫舻艱艰艷艳芻刍茲兹荊荆莊庄莖茎莢荚莧苋華华萇苌萊莱萬万萵莴葉叶蒔莳蒼苍蓀荪蓋盖" +
+	"蓮莲蓯苁蓽荜蔔卜蔞蒌蔣蒋蔥葱蔦茑蔭荫蕁荨蕎荞蕓芸蕕莸蕘荛蕩荡蕭萧薈荟薊蓟薌芗薑姜" +
+	"薔蔷薟莶薦荐薩萨薺荠藍蓝藎荩藝艺藥药藪薮藶苈藹蔼藺蔺蘄蕲蘆芦蘇苏蘊蕴蘋苹蘚藓蘭兰" +
+	"蘿萝處处虛虚虜虏號号虧亏蛺蛱蛻蜕蜆蚬蝕蚀蝟猬蝦虾蝸蜗螄蛳螞蚂螢萤螻蝼蟈蝈蟣虮蟬蝉" +
+	"蟯蛲蟲虫蠅蝇蠍蝎蠐蛴蠑蝾蠔蚝蠟蜡蠣蛎蠶蚕蠻蛮衆众衊蔑術术衛卫衝冲袞衮裏里補补裝装" +
+	"裡里製制複复褲裤褳裢褸褛襖袄襝裣襠裆襤褴襪袜襬摆襯衬襲袭見见規规覓觅視视覡觋覦觎" +
+	"親亲覬觊覲觐覷觑覺觉覽览觀观觴觞觸触訂订訃讣計计訊讯訌讧討讨訐讦訓训訕讪託托記记" +
+	"訛讹訝讶訟讼訣诀訥讷訪访設设許许訴诉診诊詁诂詆诋詎讵詐诈詒诒詔诏評评詘诎詛诅詞词" +
+	"詠咏詢询詣诣試试詩诗詫诧詬诟詭诡詮诠詰诘話话該该詳详誄诔誅诛誆诓誇夸誌志認认誑诳" +
+	"誒诶誕诞誚诮語语誠诚誡诫誣诬誤误誥诰誦诵誨诲說说誰谁課课誶谇誼谊調调諂谄諄谆談谈" +
+	"諉诿請请諏诹諑诼諒谅論论諗谂諛谀諜谍諞谝諢诨諤谔諧谐諫谏諭谕諮谘諱讳諳谙諶谌諷讽" +
+	"諸诸諺谚諼谖諾诺謀谋謁谒謂谓謄誊謅诌謊谎謎谜謐谧謔谑謖谡謗谤謙谦講讲謝谢謠谣謨谟" +
+	"謫谪謬谬謳讴謹谨譁哗證证譎谲譏讥譖谮識识譙谯譚谭譜谱譫谵譯译議议譴谴護护譽誉譾谫" +
+	"讀读變变讎雠讒谗讓让讕谰讖谶讚赞讜谠讞谳豈岂豎竖豐丰豔艳豬猪貍狸貓猫貝贝負负財财" +
+	"貢贡貧贫貨货販贩貪贪貫贯責责貯贮貲赀貳贰貴贵貶贬買买貸贷費费貼贴貽贻貿贸賀贺賁贲" +
+	"賂赂賃赁賄贿賅赅資资賈贾賊贼賑赈賒赊賓宾賕赇賙赒賜赐賞赏賠赔賡赓賢贤賣卖賤贱賦赋" +
+	"質质賬账賭赌賴赖賺赚賻赙購购賽赛贄贽贅赘贇赟贈赠贊赞贍赡贏赢贐赆贓赃贖赎贗赝贛赣" +
+	"趕赶趙赵趨趋跡迹踐践踴踊蹌跄蹕跸蹟迹蹣蹒蹤踪蹺跷躂跶躉趸躊踌躋跻躍跃躑踯躒跞躓踬" +
+	"躚跹躡蹑躥蹿躦躜躪躏軀躯車车軋轧軌轨軍军軒轩軔轫軛轭軟软軫轸軲轱軸轴軻轲軼轶較较" +
+	"輅辂輇辁載载輊轾輒辄輓挽輔辅輕轻輛辆輝辉輟辍輥辊輦辇輩辈輪轮輯辑輸输輻辐輾辗輿舆" +
+	"轀辒轂毂轄辖轅辕轆辘轉转轍辙轎轿轔辚轟轰轡辔轢轹辦办辭辞辮辫辯辩農农迴回逕径這这" +
+	"連连週周進进運运過过遙遥遜逊遝沓遞递遠远適适遯遁遲迟遷迁選选遺遗遼辽邁迈還还邊边" +
+	"邏逻郵邮鄆郓鄉乡鄒邹鄔邬鄖郧鄧邓鄭郑鄰邻鄲郸鄴邺鄶郐鄺邝酈郦醜丑醞酝醫医醬酱醱酦" +
+	"釀酿釁衅釋释釐厘釕钌釗钊釘钉針针釣钓鈀钯鈉钠鈍钝鈔钞鈕钮鈞钧鈣钙鈦钛鈴铃鈷钴鈸钹" +
+	"鈺钰鉅巨鉛铅鉤钩銀银銅铜銘铭銳锐銷销鋁铝鋒锋鋤锄鋪铺鋸锯鋼钢錄录錘锤錢钱錦锦錫锡" +
+	"錯错鍊炼鍋锅鍛锻鍵键鍾钟鎖锁鎗枪鎮镇鏈链鏟铲鏡镜鏽锈鐘钟鐮镰鐵铁鑄铸鑑鉴鑒鉴鑰钥" +
+	"鑼锣鑽钻鑾銮長长門门閃闪閉闭開开閏闰閑闲閒闲間间閘闸閣阁閥阀閨闺閩闽閱阅閻阎闆板" +
+	"闊阔闌阑闔阖闕阙闖闯關关闡阐陝陕陣阵陰阴陳陈陸陆陽阳隊队階阶際际隨随險险隱隐隸隶" +
+	"隻只雖虽雙双雛雏雜杂雞鸡離离難难雲云電电霧雾靂雳靈灵靜静韋韦韓韩韻韵響响頁页頂顶" +
+	"項项順顺須须頌颂預预頒颁頓顿頗颇領领頭头頰颊頸颈頹颓頻频顆颗題题額额顏颜願愿顛颠" +
+	"類类顧顾顫颤顯显風风颱台颳刮颺飏飄飘飛飞飢饥飪饪飯饭飲饮飼饲飽饱飾饰餃饺餅饼養养" +
+	"餓饿餘余餚肴餞饯餡馅館馆餵喂饅馒饑饥饒饶饞馋馬马馮冯駁驳駐驻駕驾駛驶駝驼駱骆騎骑" +
+	"騙骗騰腾騷骚驅驱驕骄驗验驚惊驛驿驟骤驢驴驪骊髒脏體体髮发鬆松鬍胡鬚须鬥斗鬧闹鬱郁" +
+	"魚鱼魯鲁鮮鲜鯉鲤鯨鲸鰻鳗鱷鳄鳥鸟鳳凤鳴鸣鴛鸳鴦鸯鴨鸭鴻鸿鴿鸽鵝鹅鵡鹉鵬鹏鵰雕鶴鹤" +
+	"鷗鸥鷹鹰鷺鹭鸚鹦鹽盐麗丽麥麦麵面麼么黃黄點点黨党黴霉齊齐齒齿齡龄龍龙龐庞龔龚龜龟"
@@ -0,0 +1,36 @@
+// Package zhconv 繁体中文到简体中文的逐字转换
+package zhconv
+
+import "strings"
+
+var t2sMap = func() map[rune]rune {
+	runes := []rune(t2s)
+	m := make(map[rune]rune, len(runes)/2)
+	for i := 0; i+1 < len(runes); i += 2 {
+		m[runes[i]] = runes[i+1]
+	}
+	return m
+}()
+
+// ToSimplified 把繁体字逐字转换为简体字，其他字符保持不变
+func ToSimplified(s string) string {
+	if !HasTraditional(s) {
+		return s
+	}
+	return strings.Map(func(r rune) rune {
+		if v, ok := t2sMap[r]; ok {
+			return v
+		}
+		return r
+	}, s)
+}
+
+// HasTraditional 字符串中是否包含可以转换的繁体字
+func HasTraditional(s string) bool {
+	for _, r := range s {
+		if _, ok := t2sMap[r]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package zhconv
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToSimplified(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"三體", "三体"},
+		{"紅樓夢", "红楼梦"},
+		{"倚天屠龍記 金庸", "倚天屠龙记 金庸"},
+		{"三体", "三体"},
+		{"Harry Potter 2", "Harry Potter 2"},
+		// 依赖上下文的字保持不变
+		{"乾隆", "乾隆"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, ToSimplified(tt.in), tt.in)
+	}
+}
+
+func TestTable(t *testing.T) {
+	runes := []rune(t2s)
+	assert.Equal(t, 0, len(runes)%2)
+	for trad, simp := range t2sMap {
+		assert.NotEqual(t, trad, simp)
+		_, chained := t2sMap[simp]
+		assert.False(t, chained, "%c -> %c", trad, simp)
+	}
+}